@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.risoftinc.com/elsa/constants"
+	migrator "go.risoftinc.com/elsa/migrate"
+)
+
+var (
+	bundleCmd = &cobra.Command{
+		Use:   "bundle",
+		Short: "Package migrations into a bundle for deploys",
+		Long: `Package the ddl and dml migrations into one archive together with a manifest.json that lists
+every migration ID with the checksums of its files. Running with --source tar://<bundle> or zip://<bundle>
+refuses a bundle that does not match its manifest, so the reviewed set is exactly what gets applied.
+
+The format follows the file name: .tar.gz or .tgz, .tar or .zip.
+
+Examples:
+  elsa migration bundle                                  # Write migrations.tar.gz
+  elsa migration bundle -o release/migrations.zip        # Write a zip bundle
+  elsa migration up ddl --source tar://migrations.tar.gz # Apply the bundled DDL migrations`,
+		Args:         cobra.NoArgs,
+		RunE:         runBundle,
+		SilenceUsage: true,
+	}
+
+	bundleOutput     string
+	bundleCustomPath string
+)
+
+func init() {
+	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", constants.DefaultBundleFile, "Bundle file to write (.tar.gz, .tgz, .tar or .zip)")
+	bundleCmd.Flags().StringVarP(&bundleCustomPath, "path", "p", "", "Custom migration path")
+}
+
+func runBundle(cmd *cobra.Command, args []string) error {
+	format := migrator.BundleFormat(bundleOutput)
+	if format == "" {
+		return fmt.Errorf(constants.ErrInvalidBundleFormat, bundleOutput)
+	}
+
+	// Write the archive only once it is complete, a failed run leaves no half-written bundle behind
+	var buf bytes.Buffer
+	manifest, err := migrator.WriteBundle(&buf, os.DirFS(migrationBaseDir(bundleCustomPath)), format)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(bundleOutput, buf.Bytes(), constants.BundleFilePerm); err != nil {
+		return fmt.Errorf(constants.ErrFailedWriteBundle, err)
+	}
+
+	counts := make(map[string]int)
+	for _, migration := range manifest.Migrations {
+		counts[migration.Type]++
+	}
+	fmt.Printf(constants.SuccessBundled, counts[constants.MigrationTypeDDL], counts[constants.MigrationTypeDML], bundleOutput)
+	return nil
+}
@@ -4,15 +4,28 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
-	"strconv"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+	stub "go.risoftinc.com/elsa/internal/make"
 )
 
+// migrationTableNamePattern infers the table from names such as create_users_table, add_email_to_users_table or orders_table
+var migrationTableNamePattern = regexp.MustCompile(`^(?:(?:.+_(?:to|from|in|on)_|(?:create|drop|alter|update|rename)_)(.+?)(?:_table)?|(.+)_table)$`)
+
+// migrationTemplateData is what .stub/migration templates can use
+type migrationTemplateData struct {
+	ID     string // migration ID, timestamp or sequence number
+	Name   string // migration name as given, e.g. create_orders_table
+	Table  string // table inferred from the name, e.g. orders
+	Type   string // ddl or dml
+	Driver string // driver of the configured connection, empty when none is configured
+}
+
 var (
 	createCmd = &cobra.Command{
 		Use:   "create [ddl|dml] [migration_name]",
@@ -24,7 +37,8 @@ Examples:
   elsa migration create ddl create_users_table          			# Uses timestamp with milliseconds (default)
   elsa migration create dml seed_users_data             			# Uses timestamp with milliseconds (default)
   elsa migration create ddl create_table --sequential   			# Uses sequential format
-  elsa migration create ddl create_table --path custom/migrations  	# Custom folder path`,
+  elsa migration create ddl create_table --path custom/migrations  	# Custom folder path
+  elsa migration create dml backfill_password_hashes --go         	# Go migration for logic SQL cannot express`,
 		Args: cobra.ExactArgs(2),
 		RunE: runCreate,
 	}
@@ -32,12 +46,14 @@ Examples:
 	useTimestamp  bool
 	useSequential bool
 	customPath    string
+	createGo      bool
 )
 
 func init() {
 	createCmd.Flags().BoolVarP(&useTimestamp, constants.TimestampFormatName, "t", true, "Use timestamp format (YYYYMMDDHHMMSSmmm) with milliseconds - default")
 	createCmd.Flags().BoolVarP(&useSequential, constants.SequentialFormatName, "s", false, "Use sequential format (00001, 00002, etc.) instead of timestamp")
 	createCmd.Flags().StringVarP(&customPath, "path", "p", "", "Custom folder path for migrations (default: database/migration/[ddl|dml])")
+	createCmd.Flags().BoolVar(&createGo, "go", false, "Scaffold a Go migration registered with elsa.RegisterMigration instead of SQL files")
 }
 
 func runCreate(cmd *cobra.Command, args []string) error {
@@ -50,27 +66,50 @@ func runCreate(cmd *cobra.Command, args []string) error {
 	}
 
 	// Determine migration directory
-	var migrationDir string
-	if customPath != "" {
-		// Use custom path with migration type subfolder
-		migrationDir = filepath.Join(customPath, migrationType)
-	} else {
-		// Use default path
-		migrationDir = filepath.Join(constants.DefaultMigrationBaseDir, constants.DefaultMigrationDir, migrationType)
+	migrationDir := GetMigrationPath(migrationType, customPath)
+
+	migrationID, err := newMigrationID(migrationDir, useSequential)
+	if err != nil {
+		return err
 	}
 
-	// Validate folder format consistency
-	if err := validateFolderFormatConsistency(migrationDir, useSequential); err != nil {
+	// Create migration directory if not exists
+	if err := os.MkdirAll(migrationDir, constants.MigrationDirPerm); err != nil {
+		return fmt.Errorf(constants.ErrFailedCreateDir, err)
+	}
+
+	if createGo {
+		return createGoMigration(migrationDir, migrationType, migrationID, migrationName)
+	}
+
+	data := newMigrationTemplateData(migrationID, migrationType, migrationName)
+
+	upContent, err := renderMigrationContent(data, constants.DirectionUp)
+	if err != nil {
+		return err
+	}
+	downContent, err := renderMigrationContent(data, constants.DirectionDown)
+	if err != nil {
 		return err
 	}
 
+	return writeMigrationFiles(migrationDir, migrationID, migrationName, upContent, downContent)
+}
+
+// newMigrationID generates the ID of a new migration in migrationDir, keeping the format the folder already uses
+func newMigrationID(migrationDir string, sequential bool) (string, error) {
+	// Validate folder format consistency
+	if err := validateFolderFormatConsistency(migrationDir, sequential); err != nil {
+		return "", err
+	}
+
 	// Generate migration ID
 	var migrationID string
-	if useSequential {
+	if sequential {
 		// Use sequential format: 00001, 00002, etc.
-		nextSeq, err := getNextSequentialNumber(migrationType)
+		nextSeq, err := getNextSequentialNumber(migrationDir)
 		if err != nil {
-			return fmt.Errorf(constants.ErrFailedGetSequential, err)
+			return "", fmt.Errorf(constants.ErrFailedGetSequential, err)
 		}
 		migrationID = fmt.Sprintf(constants.SequentialFormat, nextSeq)
 		fmt.Printf(constants.InfoUsingSequential, migrationID)
@@ -80,11 +119,11 @@ func runCreate(cmd *cobra.Command, args []string) error {
 		fmt.Printf(constants.InfoUsingTimestamp, migrationID)
 	}
 
-	// Create migration directory if not exists
-	if err := os.MkdirAll(migrationDir, constants.MigrationDirPerm); err != nil {
-		return fmt.Errorf(constants.ErrFailedCreateDir, err)
-	}
+	return migrationID, nil
+}
 
+// writeMigrationFiles writes the up and down SQL files of a migration into an existing folder
+func writeMigrationFiles(migrationDir, migrationID, migrationName, upContent, downContent string) error {
 	// Generate file names
 	upFileName := fmt.Sprintf(constants.MigrationNameFormat+constants.UpMigrationExtension, migrationID, migrationName)
 	downFileName := fmt.Sprintf(constants.MigrationNameFormat+constants.DownMigrationExtension, migrationID, migrationName)
@@ -93,13 +132,11 @@ func runCreate(cmd *cobra.Command, args []string) error {
 	downFilePath := filepath.Join(migrationDir, downFileName)
 
 	// Create up migration file
-	upContent := generateUpMigrationContent(migrationType, migrationName)
 	if err := os.WriteFile(upFilePath, []byte(upContent), constants.MigrationFilePerm); err != nil {
 		return fmt.Errorf(constants.ErrFailedCreateFile, err)
 	}
 
 	// Create down migration file
-	downContent := generateDownMigrationContent(migrationType, migrationName)
 	if err := os.WriteFile(downFilePath, []byte(downContent), constants.MigrationFilePerm); err != nil {
 		return fmt.Errorf(constants.ErrFailedCreateFile, err)
 	}
@@ -112,16 +149,24 @@ func runCreate(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func getNextSequentialNumber(migrationType string) (int, error) {
-	var migrationDir string
-	if customPath != "" {
-		// Use custom path with migration type subfolder
-		migrationDir = filepath.Join(customPath, migrationType)
-	} else {
-		// Use default path
-		migrationDir = filepath.Join("database", "migration", migrationType)
+// createGoMigration scaffolds a Go migration that registers its up and down functions
+func createGoMigration(migrationDir, migrationType, migrationID, migrationName string) error {
+	fileName := fmt.Sprintf(constants.MigrationNameFormat+constants.GoMigrationExtension, migrationID, migrationName)
+	filePath := filepath.Join(migrationDir, fileName)
+
+	content := fmt.Sprintf(constants.GoMigrationTemplate, migrationType, migrationID, migrationName)
+	if err := os.WriteFile(filePath, []byte(content), constants.MigrationFilePerm); err != nil {
+		return fmt.Errorf(constants.ErrFailedCreateFile, err)
 	}
 
+	fmt.Printf("✅ Created Go migration file:\n")
+	fmt.Printf("   Folder: %s\n", migrationDir)
+	fmt.Printf("   File: %s\n", filePath)
+
+	return nil
+}
+
+func getNextSequentialNumber(migrationDir string) (int, error) {
 	// Check if directory exists
 	if _, err := os.Stat(migrationDir); os.IsNotExist(err) {
 		return 1, nil
@@ -135,7 +180,7 @@ func getNextSequentialNumber(migrationType string) (int, error) {
 
 	maxSeq := 0
 	for _, file := range files {
-		if file.IsDir() || filepath.Ext(file.Name()) != ".sql" {
+		if file.IsDir() || (filepath.Ext(file.Name()) != ".sql" && !database.IsGoMigrationFile(file.Name()) && database.FixtureExtension(file.Name()) == "") {
 			continue
 		}
 
@@ -151,6 +196,53 @@ func getNextSequentialNumber(migrationType string) (int, error) {
 	return maxSeq + 1, nil
 }
 
+// newMigrationTemplateData collects the template data of a new migration
+func newMigrationTemplateData(migrationID, migrationType, migrationName string) migrationTemplateData {
+	data := migrationTemplateData{
+		ID:    migrationID,
+		Name:  migrationName,
+		Table: inferMigrationTable(migrationName),
+		Type:  migrationType,
+	}
+
+	// Templates may differ per database, but creating files must not require one to be configured
+	if config, err := resolveDatabaseConfig(""); err == nil {
+		data.Driver = strings.ToLower(config.Driver)
+	}
+
+	return data
+}
+
+// inferMigrationTable returns the table a migration name refers to, empty when the name does not follow a known pattern
+func inferMigrationTable(migrationName string) string {
+	match := migrationTableNamePattern.FindStringSubmatch(migrationName)
+	if match == nil {
+		return ""
+	}
+	if match[1] != "" {
+		return match[1]
+	}
+	return match[2]
+}
+
+// renderMigrationContent renders the project template for the migration type and direction,
+// falling back to the built-in commented example when the project has none
+func renderMigrationContent(data migrationTemplateData, direction string) (string, error) {
+	content, found, err := stub.NewTemplateManager().RenderStub(fmt.Sprintf(constants.MigrationStubTemplate, data.Type, direction), data)
+	if err != nil {
+		return "", fmt.Errorf(constants.ErrFailedRenderMigrationStub, err)
+	}
+	if found {
+		fmt.Printf(constants.InfoUsingMigrationStub, direction)
+		return string(content), nil
+	}
+
+	if direction == constants.DirectionUp {
+		return generateUpMigrationContent(data.Type, data.Name), nil
+	}
+	return generateDownMigrationContent(data.Type, data.Name), nil
+}
+
 func generateUpMigrationContent(migrationType, migrationName string) string {
 	switch migrationType {
 	case constants.MigrationTypeDDL:
@@ -187,10 +279,10 @@ func validateFolderFormatConsistency(migrationDir string, useSequential bool) er
 		return fmt.Errorf("failed to read migration directory: %v", err)
 	}
 
-	// Filter only .sql files
+	// Filter only .sql and fixture files
 	var sqlFiles []string
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".sql") {
+		if !file.IsDir() && (strings.HasSuffix(file.Name(), ".sql") || database.FixtureExtension(file.Name()) != "") {
 			sqlFiles = append(sqlFiles, file.Name())
 		}
 	}
@@ -227,8 +319,9 @@ func validateFolderFormatConsistency(migrationDir string, useSequential bool) er
 
 // determineMigrationFormat determines if a migration file uses sequential or timestamp format
 func determineMigrationFormat(fileName string) string {
-	// Remove .up.sql or .down.sql suffix
+	// Remove .up.sql, .down.sql or fixture suffix
 	baseName := strings.TrimSuffix(strings.TrimSuffix(fileName, ".up.sql"), constants.DownMigrationExtension)
+	baseName = strings.TrimSuffix(baseName, database.FixtureExtension(baseName))
 
 	// Extract the ID part (before first underscore)
 	parts := strings.Split(baseName, "_")
@@ -254,61 +347,35 @@ func determineMigrationFormat(fileName string) string {
 	return "unknown"
 }
 
-// GetMigrationPath returns the migration directory path for a given type
+// GetMigrationPath returns the migration directory path for a given type, inside the active target's folder when one is selected
 // This function can be used by other migration commands to get the correct path
 func GetMigrationPath(migrationType string, customPath string) string {
+	return filepath.Join(migrationBaseDir(customPath), migrationType)
+}
+
+// migrationBaseDir returns the folder holding the ddl and dml folders: the custom path,
+// the folder of the active target or database/migration
+func migrationBaseDir(customPath string) string {
 	if customPath != "" {
-		return filepath.Join(customPath, migrationType)
+		return customPath
+	}
+	if activeTarget != nil {
+		return activeTarget.Path
 	}
-	return filepath.Join(constants.DefaultMigrationBaseDir, constants.DefaultMigrationDir, migrationType)
+	return filepath.Join(constants.DefaultMigrationBaseDir, constants.DefaultMigrationDir)
 }
 
-// GetAvailableMigrationsWithPath returns available migrations from a specific path
+// GetAvailableMigrationsWithPath returns available migrations from a specific path, sorted by ID
 // This function can be used by other migration commands to get migrations with custom path
 func GetAvailableMigrationsWithPath(migrationType string, customPath string) ([]Migration, error) {
-	migrationDir := GetMigrationPath(migrationType, customPath)
-
-	if _, err := os.Stat(migrationDir); os.IsNotExist(err) {
-		return []Migration{}, nil
-	}
-
-	files, err := os.ReadDir(migrationDir)
+	_, migrations, err := listMigrations(migrationType, customPath)
 	if err != nil {
 		return nil, err
 	}
 
-	var migrations []Migration
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), constants.UpMigrationExtension) {
-			continue
-		}
-
-		// Parse filename: 00001_create_table.up.sql
-		parts := strings.Split(strings.TrimSuffix(file.Name(), constants.UpMigrationExtension), "_")
-		if len(parts) < 2 {
-			continue
-		}
-
-		migrationID := parts[0]
-		migrationName := strings.Join(parts[1:], "_")
-
-		migrations = append(migrations, Migration{
-			ID:   migrationID,
-			Name: migrationName,
-			Path: filepath.Join(migrationDir, file.Name()),
-		})
+	// The library reports paths inside the migration FS, the commands show paths on disk or inside the bundle
+	for i := range migrations {
+		migrations[i].Path = migrationFilePath(customPath, migrations[i].Path)
 	}
-
-	// Sort migrations by ID
-	sort.Slice(migrations, func(i, j int) bool {
-		// Handle both sequential and timestamp formats
-		if isSequentialID(migrations[i].ID) && isSequentialID(migrations[j].ID) {
-			seqI, _ := strconv.Atoi(migrations[i].ID)
-			seqJ, _ := strconv.Atoi(migrations[j].ID)
-			return seqI < seqJ
-		}
-		return migrations[i].ID < migrations[j].ID
-	})
-
 	return migrations, nil
 }
@@ -0,0 +1,24 @@
+package migrate
+
+import (
+	"github.com/spf13/cobra"
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+// migrationTags selects tagged migrations for up, down, refresh, redo and status; untagged migrations always run
+var migrationTags []string
+
+func init() {
+	for _, cmd := range []*cobra.Command{upCmd, downCmd, refreshCmd, redoCmd, statusCmd} {
+		cmd.Flags().StringSliceVar(&migrationTags, "tags", nil, constants.TagsFlagUsage)
+	}
+}
+
+// activeProfileName returns the --env profile for messages
+func activeProfileName() string {
+	if profile := database.ActiveProfile(); profile != "" {
+		return profile
+	}
+	return constants.NoEnvProfile
+}
@@ -0,0 +1,135 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+	migrator "go.risoftinc.com/elsa/migrate"
+)
+
+// goMigrationRunner runs the Go migrations the elsa binary does not contain: a small runner program
+// that imports the migration package is generated inside the project and started with `go run`
+func goMigrationRunner(executor *database.MigrationExecutor, base string) migrator.GoRunner {
+	return func(run migrator.GoRun) (time.Duration, error) {
+		script := database.MigrationScript{
+			ID:         run.Migration.ID,
+			Name:       run.Migration.Name,
+			Type:       run.Type,
+			Content:    run.Content,
+			Batch:      run.Batch,
+			OutOfOrder: run.OutOfOrder,
+		}
+
+		migrationDir := filepath.Dir(filepath.Join(base, filepath.FromSlash(run.Migration.Path)))
+		limits := database.ExecLimits{StatementTimeout: run.StatementTimeout, LockTimeout: run.LockTimeout, Retries: run.Retries}
+		executionTime, err := runGoMigrationRunner(executor, script, limits, migrationDir, run.Direction)
+		return time.Duration(executionTime) * time.Millisecond, err
+	}
+}
+
+// runGoMigrationRunner hands the migration to a generated runner program and reads back its result
+func runGoMigrationRunner(executor *database.MigrationExecutor, script database.MigrationScript, limits database.ExecLimits, migrationDir, direction string) (int64, error) {
+	config := executor.Config()
+	if config == nil {
+		return 0, fmt.Errorf(constants.ErrGoMigrationNoConnection)
+	}
+
+	runnerDir, err := writeGoMigrationRunner(migrationDir)
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(runnerDir)
+
+	payload, err := json.Marshal(database.GoMigrationRequest{
+		Connection: config.GetConnectionString(),
+		Table:      executor.Table(),
+		Direction:  direction,
+		Script:     script,
+		Limits:     limits,
+	})
+	if err != nil {
+		return 0, fmt.Errorf(constants.ErrFailedRunGoMigration, err)
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("go", "run", "./"+filepath.ToSlash(runnerDir))
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf(constants.ErrFailedRunGoMigration, err)
+	}
+
+	var result database.GoMigrationResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return 0, fmt.Errorf(constants.ErrFailedRunGoMigration, err)
+	}
+
+	return result.ExecutionTime, nil
+}
+
+// writeGoMigrationRunner generates a temporary main package that imports the migration package
+func writeGoMigrationRunner(migrationDir string) (string, error) {
+	modulePath, err := readModulePath()
+	if err != nil {
+		return "", err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf(constants.ErrFailedGenerateGoRunner, err)
+	}
+
+	absDir, err := filepath.Abs(migrationDir)
+	if err != nil {
+		return "", fmt.Errorf(constants.ErrFailedGenerateGoRunner, err)
+	}
+
+	relDir, err := filepath.Rel(workingDir, absDir)
+	if err != nil || strings.HasPrefix(relDir, "..") {
+		return "", fmt.Errorf(constants.ErrGoMigrationOutsideModule, migrationDir)
+	}
+
+	runnerDir, err := os.MkdirTemp(".", constants.GoMigrationRunnerDir)
+	if err != nil {
+		return "", fmt.Errorf(constants.ErrFailedGenerateGoRunner, err)
+	}
+
+	importPath := path.Join(modulePath, filepath.ToSlash(relDir))
+	source := fmt.Sprintf(constants.GoMigrationRunnerTmpl, importPath)
+	if err := os.WriteFile(filepath.Join(runnerDir, constants.GoMigrationRunnerFile), []byte(source), constants.MigrationFilePerm); err != nil {
+		os.RemoveAll(runnerDir)
+		return "", fmt.Errorf(constants.ErrFailedGenerateGoRunner, err)
+	}
+
+	return runnerDir, nil
+}
+
+// readModulePath reads the module path from go.mod in the current directory
+func readModulePath() (string, error) {
+	file, err := os.Open(constants.GoModFile)
+	if err != nil {
+		return "", fmt.Errorf(constants.ErrGoModNotFound, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, constants.GoModModulePrefix) {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, constants.GoModModulePrefix)), "\""), nil
+		}
+	}
+
+	return "", fmt.Errorf(constants.ErrGoModNotFound, "module directive missing")
+}
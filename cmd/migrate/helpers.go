@@ -1,159 +1,217 @@
 package migrate
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"go.risoftinc.com/elsa/constants"
 	"go.risoftinc.com/elsa/internal/database"
+	migrator "go.risoftinc.com/elsa/migrate"
 )
 
 // getAppliedMigrationsWithConnection retrieves applied migrations using connection string
 func getAppliedMigrationsWithConnection(migrationType, connectionString string) ([]string, error) {
-	var config *database.DatabaseConfig
-	var err error
+	executor, err := openMigrationExecutor(connectionString)
+	if err != nil {
+		return nil, err
+	}
 
-	// If connection string is provided, use it directly
-	if connectionString != "" {
-		config = database.ParseConnectionString(connectionString)
-		if config == nil {
-			return nil, fmt.Errorf(constants.ErrInvalidConnectionString, connectionString)
-		}
-	} else {
-		// Get database configuration using helper function
-		config, err = GetDatabaseConnection()
-		if err != nil {
-			return nil, err
+	// Get applied migrations
+	return executor.GetAppliedMigrations(migrationType)
+}
+
+// runContext returns the context of a run that holds the migration lock. SIGINT, SIGTERM and SIGPIPE cancel it,
+// so the running statement is cancelled and the lock still released; a second SIGINT or SIGTERM terminates at once.
+func runContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGPIPE)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(os.Stderr, constants.InfoInterrupted, sig)
+			// Broken pipes stay ignored until the run ends, a write to a closed stdout must not kill it before the lock is released
+			signal.Reset(os.Interrupt, syscall.SIGTERM)
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		signal.Stop(signals)
 	}
+}
 
-	// Connect to database
-	db, err := database.Connect(config)
+// openMigrationExecutor connects to the database and returns an executor with the migrations table ready
+func openMigrationExecutor(connectionString string) (*database.MigrationExecutor, error) {
+	executor, err := connectMigrationExecutor(connectionString)
 	if err != nil {
-		return nil, fmt.Errorf(constants.ErrFailedConnectDB, err)
+		return nil, err
 	}
 
-	// Get migration executor
-	executor := database.NewMigrationExecutor(db)
-
 	// Ensure migration table exists
 	if err := executor.EnsureMigrationTable(); err != nil {
 		return nil, fmt.Errorf(constants.ErrFailedEnsureTable, err)
 	}
 
-	// Get applied migrations
-	return executor.GetAppliedMigrations(migrationType)
+	return executor, nil
 }
 
-// applyMigrationWithConnection applies a migration using connection string
-func applyMigrationWithConnection(migration Migration, migrationType, connectionString string) error {
-	// Read migration file
-	content, err := os.ReadFile(migration.Path)
+// connectMigrationExecutor connects to the database without creating the migrations table
+func connectMigrationExecutor(connectionString string) (*database.MigrationExecutor, error) {
+	config, err := resolveDatabaseConfig(connectionString)
 	if err != nil {
-		return fmt.Errorf(constants.ErrFailedReadFile, err)
+		return nil, err
 	}
 
-	var config *database.DatabaseConfig
+	// Connect to database
+	db, err := database.Connect(config)
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedConnectDB, err)
+	}
+
+	return database.NewMigrationExecutor(db).WithConfig(config).WithTable(migrationTable()), nil
+}
+
+// resolveDatabaseConfig picks the connection a command uses.
+// The --connection flag wins over the selected target, which wins over MIGRATE_CONNECTION.
+func resolveDatabaseConfig(connectionString string) (*database.DatabaseConfig, error) {
+	if connectionString == "" && activeTarget != nil {
+		connectionString = activeTarget.Connection
+	}
 
 	// If connection string is provided, use it directly
 	if connectionString != "" {
-		config = database.ParseConnectionString(connectionString)
+		config := database.ParseConnectionString(connectionString)
 		if config == nil {
-			return fmt.Errorf(constants.ErrInvalidConnectionString, connectionString)
+			return nil, fmt.Errorf(constants.ErrInvalidConnectionString, connectionString)
 		}
-	} else {
-		// Load database configuration from .env
-		config = database.LoadFromEnv()
+		return config, nil
 	}
 
-	// Connect to database
-	db, err := database.Connect(config)
-	if err != nil {
-		return fmt.Errorf(constants.ErrFailedConnectDB, err)
-	}
+	// Get database configuration using helper function
+	return GetDatabaseConnection()
+}
 
-	// Get migration executor
-	executor := database.NewMigrationExecutor(db)
+// printConnectionContext shows the profile, target and host a command is pointed at,
+// so nobody runs against production by accident
+func printConnectionContext(connectionString string) {
+	profile, host := connectionContext(connectionString)
 
-	// Ensure migration table exists
-	if err := executor.EnsureMigrationTable(); err != nil {
-		return fmt.Errorf(constants.ErrFailedEnsureTable, err)
+	if activeTarget != nil {
+		fmt.Printf(constants.InfoConnectionContextTarget, profile, activeTarget.Name, host)
+	} else {
+		fmt.Printf(constants.InfoConnectionContext, profile, host)
 	}
 
-	// Execute migration
-	startTime := time.Now()
-	if err := executor.ExecuteMigration(string(content), migrationType); err != nil {
-		return fmt.Errorf(constants.ErrFailedExecuteMigration, err)
+	if migrationSource != "" {
+		fmt.Printf(constants.InfoUsingSource, migrationSource)
 	}
-	executionTime := time.Since(startTime).Milliseconds()
+}
 
-	// Record migration as applied
-	checksum := database.GetMigrationChecksum(string(content))
-	if err := executor.RecordMigration(migration.ID, migration.Name, migrationType, checksum, executionTime); err != nil {
-		return fmt.Errorf(constants.ErrFailedRecordMigration, err)
+// connectionContext returns the active profile and the host of the database a command is pointed at
+func connectionContext(connectionString string) (string, string) {
+	profile := database.ActiveProfile()
+	if profile == "" {
+		profile = constants.DefaultProfileName
 	}
 
-	fmt.Printf(constants.SuccessExecuted, executionTime)
+	host := constants.ConnectionNotConfigured
+	if config, err := resolveDatabaseConfig(connectionString); err == nil {
+		host = config.DisplayHost()
+	}
 
-	return nil
+	return profile, host
 }
 
-// rollbackMigrationWithConnection rolls back a migration using connection string
-func rollbackMigrationWithConnection(migration Migration, migrationType, connectionString string) error {
-	// Read down migration file
-	downFilePath := strings.Replace(migration.Path, constants.UpMigrationExtension, constants.DownMigrationExtension, 1)
-
-	content, err := os.ReadFile(downFilePath)
+// withMigrationLock runs fn while holding the database migration lock,
+// so concurrent runs cannot apply or roll back the same migrations twice
+func withMigrationLock(executor *database.MigrationExecutor, wait time.Duration, fn func() error) error {
+	lock, err := executor.AcquireLock(wait)
 	if err != nil {
-		return fmt.Errorf(constants.ErrFailedReadFile, err)
+		return err
 	}
 
-	var config *database.DatabaseConfig
-
-	// If connection string is provided, use it directly
-	if connectionString != "" {
-		config = database.ParseConnectionString(connectionString)
-		if config == nil {
-			return fmt.Errorf("invalid connection string: %s", connectionString)
-		}
-	} else {
-		// Get database configuration using helper function
-		var err error
-		config, err = GetDatabaseConnection()
-		if err != nil {
-			return err
-		}
+	runErr := fn()
+	if err := lock.Release(); err != nil && runErr == nil {
+		return err
 	}
 
-	// Connect to database
-	db, err := database.Connect(config)
+	return runErr
+}
+
+// newMigrator returns the library Migrator over the migrations of a command, the migration folder or --source,
+// selecting migrations with --env and --tags, running the configured hooks and printing its progress
+func newMigrator(executor *database.MigrationExecutor, customPath string, opts ...migrator.Option) (*migrator.Migrator, error) {
+	fsys, err := migrationFS(customPath)
 	if err != nil {
-		return fmt.Errorf(constants.ErrFailedConnectDB, err)
+		return nil, err
 	}
 
-	// Get migration executor
-	executor := database.NewMigrationExecutor(db)
-
-	// Ensure migration table exists
-	if err := executor.EnsureMigrationTable(); err != nil {
-		return fmt.Errorf(constants.ErrFailedEnsureTable, err)
+	goRunner := bundleGoMigrationRunner
+	if dir := migrationSourceDir(customPath); dir != "" {
+		goRunner = goMigrationRunner(executor, dir)
 	}
 
-	// Execute rollback migration
-	startTime := time.Now()
-	if err := executor.ExecuteMigration(string(content), migrationType); err != nil {
-		return fmt.Errorf(constants.ErrFailedRollbackMigration, err)
+	hookOpts, err := migrationHookOptions()
+	if err != nil {
+		return nil, err
 	}
-	executionTime := time.Since(startTime).Milliseconds()
 
-	// Remove migration record
-	if err := executor.RemoveMigration(migration.ID); err != nil {
-		return fmt.Errorf(constants.ErrFailedRemoveRecord, err)
-	}
+	opts = append(append([]migrator.Option{
+		migrator.WithTable(executor.Table()),
+		migrator.WithEnv(database.ActiveProfile()),
+		migrator.WithTags(migrationTags...),
+		migrator.WithGoRunner(goRunner),
+		migrator.WithObserver(printMigrationEvent),
+	}, append(migrationLimitOptions(), hookOpts...)...), opts...)
 
-	fmt.Printf(constants.SuccessRolledBack, executionTime)
+	return migrator.New(executor.DB(), fsys, opts...), nil
+}
 
-	return nil
+// printMigrationEvent prints the progress of a Migrator run
+func printMigrationEvent(event migrator.Event) {
+	migrationType := strings.ToUpper(event.Type)
+
+	switch event.Kind {
+	case migrator.EventSkipped:
+		fmt.Printf(constants.InfoSkippedMigrations, event.Count, migrationType, activeProfileName())
+	case migrator.EventReconciled:
+		fmt.Printf(constants.InfoSquashReconciled, event.Count, event.Migration.ID, event.Migration.Name)
+	case migrator.EventChecksumsUpgraded:
+		fmt.Printf(constants.InfoChecksumsUpgraded, event.Count, migrationType)
+	case migrator.EventOutOfOrder:
+		fmt.Printf(constants.InfoWarningOutOfOrder, event.Count, event.Newest)
+	case migrator.EventApplying:
+		fmt.Printf(constants.InfoApplyingMigrationsBatch, event.Count, migrationType, event.Batch)
+	case migrator.EventRollingBack:
+		fmt.Printf(constants.InfoRollingBackMigrations, event.Count, migrationType)
+	case migrator.EventRedoing:
+		fmt.Printf(constants.InfoRedoingMigrations, event.Count, migrationType)
+	case migrator.EventApplied:
+		fmt.Printf(constants.SuccessExecuted, event.Duration.Milliseconds())
+		fmt.Printf("✅ Applied: %s_%s\n", event.Migration.ID, event.Migration.Name)
+	case migrator.EventRolledBack:
+		fmt.Printf(constants.SuccessRolledBack, event.Duration.Milliseconds())
+		fmt.Printf("✅ Rolled back: %s_%s\n", event.Migration.ID, event.Migration.Name)
+	case migrator.EventMissingFile:
+		fmt.Printf(constants.InfoWarningFileNotFound, event.Migration.ID)
+	case migrator.EventNonTransactional:
+		fmt.Printf(constants.InfoWarningNonTransactional, event.Driver)
+	case migrator.EventHook:
+		fmt.Printf(constants.InfoRunningHook, event.HookPoint, event.Hook)
+	case migrator.EventRetrying:
+		fmt.Printf(constants.InfoRetryingMigration, event.Migration.ID, event.Migration.Name, event.Count, event.Duration)
+	case migrator.EventBatchResumed:
+		fmt.Printf(constants.InfoBatchResumed, event.Migration.ID, event.Migration.Name, event.Count, event.Total)
+	case migrator.EventBatchProgress, migrator.EventBatchFinished:
+		printBatchProgress(event)
+	}
 }
@@ -0,0 +1,47 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+	migrator "go.risoftinc.com/elsa/migrate"
+)
+
+// migrationHookOptions registers the hooks declared under migration.hooks in .elsa-config.yaml
+func migrationHookOptions() ([]migrator.Option, error) {
+	hookSets, err := database.LoadHooks()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []migrator.Option
+	for migrationType, set := range hookSets {
+		for point, hooks := range set.Points() {
+			for _, hook := range hooks {
+				opts = append(opts, migrator.WithHook(migrationType, migrator.HookPoint(point), configuredHook(hook)))
+			}
+		}
+	}
+	return opts, nil
+}
+
+// configuredHook turns a hook of .elsa-config.yaml into a Migrator hook.
+// SQL files are read when the hook runs, relative to the project root like every other path in the config.
+func configuredHook(hook database.HookConfig) migrator.Hook {
+	if hook.Command != "" {
+		return migrator.CommandHook(hook.Command)
+	}
+
+	return migrator.Hook{
+		Name: hook.SQL,
+		Run: func(run migrator.HookRun) error {
+			content, err := os.ReadFile(hook.SQL)
+			if err != nil {
+				return fmt.Errorf(constants.ErrFailedReadHookFile, err)
+			}
+			return run.Exec(string(content))
+		},
+	}
+}
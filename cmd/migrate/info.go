@@ -2,7 +2,7 @@ package migrate
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -19,19 +19,63 @@ Examples:
   elsa migration info                    # Show info of all migrations
   elsa migration info ddl               # Show info of DDL migrations
   elsa migration info dml               # Show info of DML migrations
-  elsa migration info ddl --path custom/migrations  # Use custom migration path`,
+  elsa migration info ddl --path custom/migrations  # Use custom migration path
+  elsa migration info ddl --output yaml  # One YAML object per migration
+  elsa migration info --check-pending    # Exit with code 3 when migrations are pending`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: runInfo,
 	}
 
-	infoCustomPath string
-	infoConnection string
+	infoCustomPath   string
+	infoConnection   string
+	infoOutput       string
+	infoCheckPending bool
 )
 
 func runInfo(cmd *cobra.Command, args []string) error {
+	if err := validateReportOutput(infoOutput); err != nil {
+		return err
+	}
+
+	migrationTypes := []string{constants.MigrationTypeDDL, constants.MigrationTypeDML}
+	if len(args) > 0 {
+		if args[0] != constants.MigrationTypeDDL && args[0] != constants.MigrationTypeDML {
+			return fmt.Errorf(constants.ErrInvalidMigrationType, args[0])
+		}
+		migrationTypes = args[:1]
+	}
+
+	if infoOutput == constants.ReportOutputText {
+		if err := showInfoText(args); err != nil {
+			return err
+		}
+		if !infoCheckPending {
+			return nil
+		}
+	}
+
+	reports, err := buildMigrationReports(migrationTypes, infoCustomPath, infoConnection)
+	if err != nil {
+		return err
+	}
+	if infoOutput != constants.ReportOutputText {
+		if err := printMigrationReports(reports, infoOutput); err != nil {
+			return err
+		}
+	}
+	if infoCheckPending {
+		return checkPendingReports(cmd, reports)
+	}
+	return nil
+}
+
+// showInfoText prints the detailed, human-readable migration information
+func showInfoText(args []string) error {
+	printConnectionContext(infoConnection)
+
 	if len(args) == 0 {
 		// Show info for both DDL and DML
-		fmt.Println(constants.InfoOverviewHeader)
+		fmt.Print(constants.InfoOverviewHeader)
 		fmt.Println(strings.Repeat("=", 50))
 
 		if err := showMigrationInfo("ddl"); err != nil {
@@ -46,17 +90,14 @@ func runInfo(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	migrationType := args[0]
-	if migrationType != constants.MigrationTypeDDL && migrationType != constants.MigrationTypeDML {
-		return fmt.Errorf(constants.ErrInvalidMigrationType, migrationType)
-	}
-
-	return showMigrationInfo(migrationType)
+	return showMigrationInfo(args[0])
 }
 
 func init() {
 	infoCmd.Flags().StringVarP(&infoCustomPath, "path", "p", "", "Custom migration path")
 	infoCmd.Flags().StringVarP(&infoConnection, "connection", "c", "", "Database connection string")
+	infoCmd.Flags().StringVarP(&infoOutput, "output", "o", constants.ReportOutputText, "Output format (text|json|yaml)")
+	infoCmd.Flags().BoolVar(&infoCheckPending, "check-pending", false, "Exit with code 3 when any migration is pending")
 }
 
 func showMigrationInfo(migrationType string) error {
@@ -64,7 +105,7 @@ func showMigrationInfo(migrationType string) error {
 	fmt.Printf(constants.InfoDDLSeparator, strings.Repeat("-", 40))
 
 	// Get available migrations
-	migrations, err := GetAvailableMigrationsWithPath(migrationType, infoCustomPath)
+	fsys, migrations, err := listMigrations(migrationType, infoCustomPath)
 	if err != nil {
 		return fmt.Errorf(constants.ErrFailedShowInfo, err)
 	}
@@ -110,22 +151,34 @@ func showMigrationInfo(migrationType string) error {
 
 		// Show file paths
 		upPath := migration.Path
-		downPath := strings.Replace(upPath, ".up.sql", constants.DownMigrationExtension, 1)
+		if migration.Kind == constants.MigrationKindGo {
+			fmt.Printf("   Go File: %s\n", migrationFilePath(infoCustomPath, upPath))
+			if size, err := getFileSize(fsys, upPath); err == nil {
+				fmt.Printf("   Go File Size: %d bytes\n", size)
+			}
+		} else if migration.Kind == constants.MigrationKindFixture {
+			fmt.Printf("   Fixture File: %s\n", migrationFilePath(infoCustomPath, upPath))
+			if size, err := getFileSize(fsys, upPath); err == nil {
+				fmt.Printf("   Fixture File Size: %d bytes\n", size)
+			}
+		} else {
+			downPath := migration.DownPath()
 
-		fmt.Printf("   Up File: %s\n", upPath)
-		fmt.Printf("   Down File: %s\n", downPath)
+			fmt.Printf("   Up File: %s\n", migrationFilePath(infoCustomPath, upPath))
+			fmt.Printf("   Down File: %s\n", migrationFilePath(infoCustomPath, downPath))
 
-		// Show file sizes
-		if upSize, err := getFileSize(upPath); err == nil {
-			fmt.Printf("   Up File Size: %d bytes\n", upSize)
-		}
+			// Show file sizes
+			if upSize, err := getFileSize(fsys, upPath); err == nil {
+				fmt.Printf("   Up File Size: %d bytes\n", upSize)
+			}
 
-		if downSize, err := getFileSize(downPath); err == nil {
-			fmt.Printf("   Down File Size: %d bytes\n", downSize)
+			if downSize, err := getFileSize(fsys, downPath); err == nil {
+				fmt.Printf("   Down File Size: %d bytes\n", downSize)
+			}
 		}
 
 		// Show preview of migration content
-		if content, err := os.ReadFile(upPath); err == nil {
+		if content, err := fs.ReadFile(fsys, upPath); err == nil {
 			preview := string(content)
 			if len(preview) > 200 {
 				preview = preview[:200] + "..."
@@ -147,8 +200,8 @@ func showMigrationInfo(migrationType string) error {
 	return nil
 }
 
-func getFileSize(filePath string) (int64, error) {
-	info, err := os.Stat(filePath)
+func getFileSize(fsys fs.FS, name string) (int64, error) {
+	info, err := fs.Stat(fsys, name)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,33 @@
+package migrate
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.risoftinc.com/elsa/constants"
+	migrator "go.risoftinc.com/elsa/migrate"
+)
+
+var (
+	// statementTimeout, lockTimeout and migrationRetries bound the statements of up, down, refresh and redo
+	statementTimeout time.Duration
+	lockTimeout      time.Duration
+	migrationRetries int
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{upCmd, downCmd, refreshCmd, redoCmd} {
+		cmd.Flags().DurationVar(&statementTimeout, "statement-timeout", 0, constants.StatementTimeoutFlagUsage)
+		cmd.Flags().DurationVar(&lockTimeout, "lock-timeout", 0, constants.LockTimeoutFlagUsage)
+		cmd.Flags().IntVar(&migrationRetries, "retries", 0, constants.RetriesFlagUsage)
+	}
+}
+
+// migrationLimitOptions returns the statement timeout, lock timeout and retries of the command line
+func migrationLimitOptions() []migrator.Option {
+	return []migrator.Option{
+		migrator.WithStatementTimeout(statementTimeout),
+		migrator.WithLockTimeout(lockTimeout),
+		migrator.WithRetries(migrationRetries),
+	}
+}
@@ -11,7 +11,13 @@ var (
 		Use:   constants.MigrateUse,
 		Short: constants.MigrateShort,
 		Long:  constants.MigrateLong,
+		// Resolve --target once so every subcommand sees the same connection, path and table
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return selectTarget(migrationTarget)
+		},
 	}
+
+	migrationTarget string
 )
 
 // Execute adds all child commands to the migrate command
@@ -25,12 +31,21 @@ func MigrateCmd() *cobra.Command {
 }
 
 func init() {
+	migrateCmd.PersistentFlags().StringVar(&migrationTarget, "target", "", "Named migration target from .elsa-config.yaml or MIGRATE_CONNECTION_<NAME>")
+
 	// Add subcommands
 	migrateCmd.AddCommand(createCmd)
 	migrateCmd.AddCommand(connectCmd)
 	migrateCmd.AddCommand(upCmd)
 	migrateCmd.AddCommand(downCmd)
 	migrateCmd.AddCommand(refreshCmd)
+	migrateCmd.AddCommand(redoCmd)
 	migrateCmd.AddCommand(statusCmd)
 	migrateCmd.AddCommand(infoCmd)
+	migrateCmd.AddCommand(verifyCmd)
+	migrateCmd.AddCommand(schemaCmd)
+	migrateCmd.AddCommand(squashCmd)
+	migrateCmd.AddCommand(diffCmd)
+	migrateCmd.AddCommand(bundleCmd)
+	migrateCmd.AddCommand(unlockCmd)
 }
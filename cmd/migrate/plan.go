@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+	migrator "go.risoftinc.com/elsa/migrate"
+)
+
+// validatePlanOutput checks the dry-run output format flag
+func validatePlanOutput(output string) error {
+	if output != constants.PlanOutputText && output != constants.PlanOutputSQL {
+		return fmt.Errorf(constants.ErrInvalidPlanOutput, output)
+	}
+	return nil
+}
+
+// printMigrationPlan prints a dry-run plan as a readable list or as one SQL script
+func printMigrationPlan(executor *database.MigrationExecutor, migrationType, customPath string, steps []migrator.Step, output string) error {
+	if output == constants.PlanOutputSQL {
+		printMigrationPlanSQL(executor, migrationType, customPath, steps)
+		return nil
+	}
+
+	if len(steps) == 0 {
+		fmt.Printf(constants.InfoPlanEmpty, strings.ToUpper(migrationType))
+		return nil
+	}
+
+	fmt.Printf(constants.InfoPlanHeader, len(steps), strings.ToUpper(migrationType))
+	for i, step := range steps {
+		fmt.Printf("\n%d. %s_%s (%s)", i+1, step.Migration.ID, step.Migration.Name, step.Direction)
+		if step.OutOfOrder {
+			fmt.Print(constants.StatusOutOfOrderSuffix)
+		}
+		fmt.Println()
+		fmt.Printf("   File: %s\n", migrationFilePath(customPath, step.Path))
+		for j, statement := range step.Statements {
+			fmt.Printf("   Statement %d:\n%s\n", j+1, indentString(statement, 6))
+		}
+	}
+	fmt.Printf(constants.InfoPlanFooter)
+
+	return nil
+}
+
+// printMigrationPlanSQL emits the plan as a script a DBA can review and apply by hand,
+// including the statements that keep the migrations table in sync
+func printMigrationPlanSQL(executor *database.MigrationExecutor, migrationType, customPath string, steps []migrator.Step) {
+	dialect := executor.Dialect()
+
+	fmt.Printf(constants.PlanSQLHeader, strings.ToUpper(migrationType), len(steps))
+
+	for _, step := range steps {
+		fmt.Printf(constants.PlanSQLStepHeader, step.Migration.ID, step.Migration.Name, step.Direction, migrationFilePath(customPath, step.Path))
+		for _, statement := range step.Statements {
+			fmt.Println(dialect.TerminateStatement(statement))
+		}
+
+		// Go migrations cannot be applied by hand, so leave their bookkeeping to elsa
+		if step.Migration.Kind == constants.MigrationKindGo {
+			continue
+		}
+
+		if step.Direction == constants.DirectionUp {
+			fmt.Println(dialect.TerminateStatement(fmt.Sprintf(constants.PlanSQLRecordInsert, migrationTable(),
+				quoteSQLString(step.Migration.ID), quoteSQLString(step.Migration.Name), migrationType,
+				step.Checksum, step.Batch, dialect.BoolLiteral(step.OutOfOrder))))
+		} else {
+			fmt.Println(dialect.TerminateStatement(fmt.Sprintf(constants.PlanSQLRecordDelete, migrationTable(), quoteSQLString(step.Migration.ID))))
+		}
+	}
+}
+
+// quoteSQLString escapes single quotes for use inside a SQL string literal
+func quoteSQLString(value string) string {
+	return strings.ReplaceAll(value, "'", "''")
+}
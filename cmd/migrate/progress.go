@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+	migrator "go.risoftinc.com/elsa/migrate"
+)
+
+// batchProgressShown is the percentage the last progress line was printed at when the output is not a terminal,
+// -1 before the first line of a migration
+var batchProgressShown = -1
+
+// printBatchProgress redraws the progress bar of a batched migration on a terminal,
+// and prints a line every few percent otherwise so logs stay readable
+func printBatchProgress(event migrator.Event) {
+	percent := 100
+	if event.Total > 0 {
+		percent = min(event.Count*100/event.Total, 100)
+	}
+	finished := event.Kind == migrator.EventBatchFinished
+
+	if isTerminalOutput() {
+		filled := percent * constants.BatchBarWidth / 100
+		bar := strings.Repeat(constants.BatchBarFilled, filled) + strings.Repeat(constants.BatchBarEmpty, constants.BatchBarWidth-filled)
+		fmt.Printf(constants.InfoBatchProgressBar, bar, percent, event.Count, event.Total)
+		if finished {
+			fmt.Println()
+		}
+		return
+	}
+
+	if finished && batchProgressShown == percent {
+		batchProgressShown = -1
+		return
+	}
+	if !finished && batchProgressShown >= 0 && percent < batchProgressShown+constants.BatchProgressStep {
+		return
+	}
+	fmt.Printf(constants.InfoBatchProgressLine, event.Migration.ID, event.Migration.Name, percent, event.Count, event.Total)
+	batchProgressShown = percent
+	if finished {
+		batchProgressShown = -1
+	}
+}
+
+// isTerminalOutput reports whether stdout is a terminal a progress bar can be redrawn on
+func isTerminalOutput() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+// protectedRun is a run against a protected database; its outcome is written to the audit table
+type protectedRun struct {
+	executor *database.MigrationExecutor
+	command  string
+	forced   bool
+}
+
+// guardProtectedRun checks whether the executor points at a protected database and, for destructive runs,
+// asks for the database name or requires --force. It returns nil when the database is not protected.
+func guardProtectedRun(cmd *cobra.Command, args []string, executor *database.MigrationExecutor, destructive, force bool) (*protectedRun, error) {
+	config := executor.Config()
+	protected, err := isProtectedDatabase(config)
+	if err != nil || !protected {
+		return nil, err
+	}
+
+	if destructive && !force {
+		if !isInteractive() {
+			return nil, fmt.Errorf(constants.ErrProtectedNeedsForce, config.DisplayHost(), cmd.CommandPath())
+		}
+
+		fmt.Printf(constants.PromptConfirmProtected, config.DisplayHost(), config.Database)
+		reader := bufio.NewReader(os.Stdin)
+		input, err := reader.ReadString('\n')
+		if err != nil && strings.TrimSpace(input) == "" {
+			// Nothing to read from, e.g. stdin redirected from /dev/null
+			return nil, fmt.Errorf(constants.ErrProtectedNeedsForce, config.DisplayHost(), cmd.CommandPath())
+		}
+		if strings.TrimSpace(input) != config.Database {
+			return nil, fmt.Errorf(constants.ErrProtectedCancelled)
+		}
+	}
+
+	return &protectedRun{executor: executor, command: describeCommand(cmd, args), forced: destructive && force}, nil
+}
+
+// run executes fn and records it in the audit table; a nil run executes fn unaudited
+func (p *protectedRun) run(fn func() error) error {
+	if p == nil {
+		return fn()
+	}
+
+	record, err := p.executor.StartAudit(p.command, p.forced)
+	if err != nil {
+		return err
+	}
+
+	runErr := fn()
+	if err := p.executor.FinishAudit(record, runErr); err != nil && runErr == nil {
+		return err
+	}
+	return runErr
+}
+
+// isProtectedDatabase reports whether the configuration points at a protected database:
+// the selected target is marked protected, ELSA_PROTECTED is set, or the host or database name
+// matches a pattern under migration.protected in .elsa-config.yaml
+func isProtectedDatabase(config *database.DatabaseConfig) (bool, error) {
+	if config == nil {
+		return false, nil
+	}
+	if activeTarget != nil && activeTarget.Protected {
+		return true, nil
+	}
+	if database.ProtectedByEnv() {
+		return true, nil
+	}
+
+	patterns, err := database.ProtectedPatterns()
+	if err != nil {
+		return false, err
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, value := range []string{config.Host, config.Database} {
+			if matched, _ := path.Match(pattern, strings.ToLower(value)); matched {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// isInteractive reports whether stdin is a terminal someone can type a confirmation into
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// describeCommand renders the command line for the audit table, leaving out connection strings and their credentials
+func describeCommand(cmd *cobra.Command, args []string) string {
+	parts := append([]string{cmd.CommandPath()}, args...)
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if flag.Name == "connection" {
+			return
+		}
+		// A flag given without a value, such as --batch or --force, is recorded the same way
+		// instead of with the sentinel it stands for
+		if flag.NoOptDefVal != "" && flag.Value.String() == flag.NoOptDefVal {
+			parts = append(parts, "--"+flag.Name)
+			return
+		}
+		parts = append(parts, fmt.Sprintf("--%s=%s", flag.Name, flag.Value.String()))
+	})
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,156 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.risoftinc.com/elsa/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// migrationReport is the machine-readable state of one migration, emitted by --output json|yaml
+type migrationReport struct {
+	Target        string     `json:"target,omitempty" yaml:"target,omitempty"`
+	Profile       string     `json:"profile" yaml:"profile"`
+	Host          string     `json:"host" yaml:"host"`
+	ID            string     `json:"id" yaml:"id"`
+	Name          string     `json:"name" yaml:"name"`
+	Type          string     `json:"type" yaml:"type"`
+	Path          string     `json:"path" yaml:"path"`
+	Applied       bool       `json:"applied" yaml:"applied"`
+	Skipped       string     `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	OutOfOrder    bool       `json:"out_of_order" yaml:"out_of_order"`
+	AppliedAt     *time.Time `json:"applied_at" yaml:"applied_at"`
+	Checksum      string     `json:"checksum" yaml:"checksum"`
+	ChecksumMatch *bool      `json:"checksum_match" yaml:"checksum_match"`
+	ExecutionTime *int64     `json:"execution_time" yaml:"execution_time"`
+}
+
+// exitCodeError carries a process exit code other than 1 up to main
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+// ExitCode returns the code the process should exit with
+func (e *exitCodeError) ExitCode() int {
+	return e.code
+}
+
+// validateReportOutput checks the --output value of status and info
+func validateReportOutput(output string) error {
+	switch output {
+	case constants.ReportOutputText, constants.ReportOutputJSON, constants.ReportOutputYAML:
+		return nil
+	default:
+		return fmt.Errorf(constants.ErrInvalidReportOutput, output)
+	}
+}
+
+// buildMigrationReports compares the migration files of the selected target with its migrations table.
+// Unlike the text output it fails when the database cannot be reached, so pipelines never act on file-only data.
+func buildMigrationReports(migrationTypes []string, customPath, connectionString string) ([]migrationReport, error) {
+	executor, err := connectMigrationExecutor(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	target := ""
+	if activeTarget != nil {
+		target = activeTarget.Name
+	}
+	profile, host := connectionContext(connectionString)
+
+	m, err := newMigrator(executor, customPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []migrationReport
+	for _, migrationType := range migrationTypes {
+		statuses, err := m.Status(context.Background(), migrationType)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ErrFailedShowStatus, migrationType, err)
+		}
+
+		for _, status := range statuses {
+			report := migrationReport{
+				Target:     target,
+				Profile:    profile,
+				Host:       host,
+				ID:         status.ID,
+				Name:       status.Name,
+				Type:       migrationType,
+				Path:       migrationFilePath(customPath, status.Path),
+				Applied:    status.Applied,
+				Skipped:    status.Skipped,
+				OutOfOrder: status.OutOfOrder,
+				AppliedAt:  status.AppliedAt,
+				Checksum:   status.Checksum,
+			}
+
+			if status.Applied {
+				executionTime := status.ExecutionTime.Milliseconds()
+				report.ExecutionTime = &executionTime
+
+				// A baseline keeps the record of the original file until the next run reconciles it
+				if status.AppliedChecksum != "" {
+					match := !status.Modified()
+					report.ChecksumMatch = &match
+				}
+			}
+
+			reports = append(reports, report)
+		}
+	}
+
+	return reports, nil
+}
+
+// printMigrationReports writes the reports as one JSON array or YAML sequence
+func printMigrationReports(reports []migrationReport, output string) error {
+	if reports == nil {
+		reports = []migrationReport{}
+	}
+
+	var data []byte
+	var err error
+	if output == constants.ReportOutputYAML {
+		data, err = yaml.Marshal(reports)
+	} else {
+		data, err = json.MarshalIndent(reports, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedWriteReport, err)
+	}
+
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// checkPendingReports fails with exit code 3 when any reported migration is not applied,
+// migrations skipped for the environment or tags do not count
+func checkPendingReports(cmd *cobra.Command, reports []migrationReport) error {
+	pending := 0
+	for _, report := range reports {
+		if !report.Applied && report.Skipped == "" {
+			pending++
+		}
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	// The exit code is the answer, the usage text would only be noise in CI logs
+	cmd.SilenceUsage = true
+	return &exitCodeError{code: constants.ExitCodePending, err: fmt.Errorf(constants.ErrMigrationsPending, pending)}
+}
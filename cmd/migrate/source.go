@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.risoftinc.com/elsa/constants"
+	migrator "go.risoftinc.com/elsa/migrate"
+)
+
+var (
+	// migrationSource replaces the migration folder of up, down, refresh, redo, status, info and verify
+	// with a folder or bundle, empty for the migration folder
+	migrationSource string
+
+	// openedSource keeps the FS of --source, so a bundle is read and verified once per command
+	openedSource fs.FS
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{upCmd, downCmd, refreshCmd, redoCmd, statusCmd, infoCmd, verifyCmd} {
+		cmd.Flags().StringVar(&migrationSource, "source", "", constants.SourceFlagUsage)
+	}
+}
+
+// migrationFS returns the migrations a command works on: --source when given, otherwise the migration folder
+func migrationFS(customPath string) (fs.FS, error) {
+	if migrationSource == "" {
+		return os.DirFS(migrationBaseDir(customPath)), nil
+	}
+
+	if openedSource == nil {
+		fsys, err := migrator.OpenSource(migrationSource)
+		if err != nil {
+			return nil, err
+		}
+		openedSource = fsys
+	}
+	return openedSource, nil
+}
+
+// listMigrations returns the migrations of one type, with their paths inside the returned migration FS
+func listMigrations(migrationType, customPath string) (fs.FS, []Migration, error) {
+	fsys, err := migrationFS(customPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrations, err := migrator.Discover(fsys, migrationType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fsys, migrations, nil
+}
+
+// migrationSourceDir returns the folder the migrations are read from, empty when they come from a bundle
+func migrationSourceDir(customPath string) string {
+	if migrationSource == "" {
+		return migrationBaseDir(customPath)
+	}
+	if dir, ok := strings.CutPrefix(migrationSource, constants.SourceSchemeFile); ok {
+		return dir
+	}
+	return ""
+}
+
+// migrationFilePath turns the path of a migration inside the migration FS into a path to show,
+// on disk for folders and inside the archive for bundles
+func migrationFilePath(customPath, name string) string {
+	if dir := migrationSourceDir(customPath); dir != "" {
+		return filepath.Join(dir, filepath.FromSlash(name))
+	}
+
+	bundle := migrationSource[strings.Index(migrationSource, "://")+len("://"):]
+	return path.Join(filepath.ToSlash(bundle), name)
+}
+
+// bundleGoMigrationRunner refuses Go migrations read from a bundle: the runner compiles them from the project,
+// which is not what the bundle was reviewed as
+func bundleGoMigrationRunner(run migrator.GoRun) (time.Duration, error) {
+	return 0, fmt.Errorf(constants.ErrSourceGoMigration, run.Migration.ID)
+}
@@ -0,0 +1,277 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+var (
+	squashCmd = &cobra.Command{
+		Use:   "squash [ddl|dml]",
+		Short: "Squash applied migrations into one baseline file",
+		Long: `Squash all migrations up to an ID into one baseline migration.
+The baseline up file concatenates the original up files, the down file concatenates the original
+down files in reverse order, and the originals are moved into the squashed/ subfolder.
+
+Databases that already applied the originals keep working: the next run records them as satisfied
+by the baseline without executing anything. New databases bootstrap from the baseline alone.
+
+Examples:
+  elsa migration squash ddl --to 00120                    # Squash DDL migrations 00001..00120
+  elsa migration squash ddl --to 00120 --path custom/migrations`,
+		Args:         cobra.ExactArgs(1),
+		RunE:         runSquash,
+		SilenceUsage: true,
+	}
+
+	squashToMigration string
+	squashCustomPath  string
+	squashConnection  string
+	squashForce       bool
+)
+
+func init() {
+	squashCmd.Flags().StringVarP(&squashToMigration, "to", "t", "", "Squash migrations up to and including this ID (required)")
+	squashCmd.Flags().StringVarP(&squashCustomPath, "path", "p", "", "Custom migration path")
+	squashCmd.Flags().StringVarP(&squashConnection, "connection", "c", "", "Database connection string used to check the migrations are applied")
+	squashCmd.Flags().BoolVar(&squashForce, "force", false, "Skip the database name confirmation on a protected database")
+	squashCmd.MarkFlagRequired("to")
+}
+
+func runSquash(cmd *cobra.Command, args []string) error {
+	migrationType := args[0]
+
+	// Validate migration type
+	if migrationType != constants.MigrationTypeDDL && migrationType != constants.MigrationTypeDML {
+		return fmt.Errorf(constants.ErrInvalidMigrationType, migrationType)
+	}
+
+	availableMigrations, err := GetAvailableMigrationsWithPath(migrationType, squashCustomPath)
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+	}
+
+	migrationsToSquash, err := selectMigrationsToSquash(availableMigrations, squashToMigration)
+	if err != nil {
+		return err
+	}
+
+	executor, err := openMigrationExecutor(squashConnection)
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+	}
+
+	// Squashing rewrites the migration history, so protected databases always ask first
+	guard, err := guardProtectedRun(cmd, args, executor, true, squashForce)
+	if err != nil {
+		return err
+	}
+
+	return guard.run(func() error {
+		return squashMigrations(executor, migrationType, migrationsToSquash)
+	})
+}
+
+// squashMigrations writes the baseline of applied migrations, archives the originals and reconciles the history
+func squashMigrations(executor *database.MigrationExecutor, migrationType string, migrationsToSquash []Migration) error {
+	// Only history the database already ran may be squashed, otherwise the baseline would be half-applied
+	appliedRecords, err := executor.GetAppliedMigrationRecords(migrationType)
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+	}
+	appliedMap := make(map[string]bool)
+	for _, record := range appliedRecords {
+		appliedMap[record.MigrationID] = true
+	}
+	for _, migration := range migrationsToSquash {
+		if !appliedMap[migration.ID] {
+			return fmt.Errorf(constants.ErrSquashNotApplied, migration.ID, migration.Name)
+		}
+	}
+
+	migrationDir := GetMigrationPath(migrationType, squashCustomPath)
+	baseline, err := writeSquashBaseline(migrationDir, migrationsToSquash, executor.Dialect())
+	if err != nil {
+		return err
+	}
+
+	if err := archiveSquashedMigrations(migrationDir, migrationsToSquash); err != nil {
+		return err
+	}
+
+	fmt.Printf(constants.SuccessSquashed, len(migrationsToSquash), strings.ToUpper(migrationType), baseline.Path)
+	fmt.Printf(constants.InfoSquashArchived, filepath.Join(migrationDir, constants.SquashedArchiveDir))
+
+	// Other databases are reconciled by their next up, down or refresh run
+	m, err := newMigrator(executor, squashCustomPath)
+	if err != nil {
+		return err
+	}
+	ctx, stop := runContext()
+	defer stop()
+	return m.Reconcile(ctx, migrationType)
+}
+
+// selectMigrationsToSquash returns the migrations from the first one up to and including targetID
+func selectMigrationsToSquash(availableMigrations []Migration, targetID string) ([]Migration, error) {
+	var result []Migration
+	found := false
+	for _, migration := range availableMigrations {
+		switch migration.Kind {
+		case constants.MigrationKindGo:
+			return nil, fmt.Errorf(constants.ErrSquashGoMigration, migration.ID, migration.Name)
+		case constants.MigrationKindFixture:
+			return nil, fmt.Errorf(constants.ErrSquashFixture, migration.ID, migration.Name)
+		}
+
+		result = append(result, migration)
+		if migration.ID == targetID {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf(constants.ErrSquashTargetNotFound, targetID)
+	}
+	if len(result) < 2 {
+		return nil, fmt.Errorf(constants.ErrSquashTooFew, targetID)
+	}
+
+	return result, nil
+}
+
+// writeSquashBaseline writes the baseline up and down files and returns the baseline migration.
+// It reuses the last squashed ID, so it keeps its place in the migration order.
+func writeSquashBaseline(migrationDir string, migrationsToSquash []Migration, dialect database.Dialect) (Migration, error) {
+	last := migrationsToSquash[len(migrationsToSquash)-1]
+
+	var squashedIDs []string
+	noTransaction := false
+	var upContent strings.Builder
+	var downParts []string
+
+	for _, migration := range migrationsToSquash {
+		// A previous baseline contributes the IDs it already covers
+		if len(migration.Squashes) > 0 {
+			squashedIDs = append(squashedIDs, migration.Squashes...)
+		} else {
+			squashedIDs = append(squashedIDs, migration.ID)
+		}
+
+		upFile, err := os.ReadFile(migration.Path)
+		if err != nil {
+			return Migration{}, fmt.Errorf(constants.ErrFailedReadFile, err)
+		}
+		downPath := strings.Replace(migration.Path, constants.UpMigrationExtension, constants.DownMigrationExtension, 1)
+		downFile, err := os.ReadFile(downPath)
+		if err != nil {
+			return Migration{}, fmt.Errorf(constants.ErrFailedReadFile, err)
+		}
+
+		if err := checkSquashDirectives(migration.Path, string(upFile)); err != nil {
+			return Migration{}, err
+		}
+		if err := checkSquashDirectives(downPath, string(downFile)); err != nil {
+			return Migration{}, err
+		}
+
+		if database.HasDirective(string(upFile), constants.DirectiveNoTransaction) ||
+			database.HasDirective(string(downFile), constants.DirectiveNoTransaction) {
+			noTransaction = true
+		}
+
+		upContent.WriteString(squashSection(dialect, migration.Path, string(upFile)))
+		downParts = append(downParts, squashSection(dialect, downPath, string(downFile)))
+	}
+
+	// Roll back in the reverse order the originals were applied
+	var downContent strings.Builder
+	for i := len(downParts) - 1; i >= 0; i-- {
+		downContent.WriteString(downParts[i])
+	}
+
+	header := fmt.Sprintf(constants.SquashBaselineHeader, len(squashedIDs), squashedIDs[0], last.ID)
+	header += constants.DirectivePrefix + constants.DirectiveSquashed + " " + strings.Join(squashedIDs, ",") + "\n"
+	if noTransaction {
+		header += constants.DirectivePrefix + constants.DirectiveNoTransaction + "\n"
+	}
+
+	upFileName := fmt.Sprintf(constants.MigrationNameFormat+constants.UpMigrationExtension, last.ID, constants.SquashBaselineName)
+	downFileName := fmt.Sprintf(constants.MigrationNameFormat+constants.DownMigrationExtension, last.ID, constants.SquashBaselineName)
+	upFilePath := filepath.Join(migrationDir, upFileName)
+
+	if err := os.WriteFile(upFilePath, []byte(header+upContent.String()), constants.MigrationFilePerm); err != nil {
+		return Migration{}, fmt.Errorf(constants.ErrFailedCreateFile, err)
+	}
+	if err := os.WriteFile(filepath.Join(migrationDir, downFileName), []byte(header+downContent.String()), constants.MigrationFilePerm); err != nil {
+		return Migration{}, fmt.Errorf(constants.ErrFailedCreateFile, err)
+	}
+
+	return Migration{
+		ID:       last.ID,
+		Name:     constants.SquashBaselineName,
+		Path:     upFilePath,
+		Kind:     constants.MigrationKindSQL,
+		Squashes: squashedIDs,
+	}, nil
+}
+
+// archiveSquashedMigrations moves the original up and down files into the squashed/ subfolder
+func archiveSquashedMigrations(migrationDir string, migrationsToSquash []Migration) error {
+	archiveDir := filepath.Join(migrationDir, constants.SquashedArchiveDir)
+	if err := os.MkdirAll(archiveDir, constants.MigrationDirPerm); err != nil {
+		return fmt.Errorf(constants.ErrFailedCreateDir, err)
+	}
+
+	for _, migration := range migrationsToSquash {
+		downPath := strings.Replace(migration.Path, constants.UpMigrationExtension, constants.DownMigrationExtension, 1)
+		for _, path := range []string{migration.Path, downPath} {
+			if err := os.Rename(path, filepath.Join(archiveDir, filepath.Base(path))); err != nil {
+				return fmt.Errorf(constants.ErrFailedArchiveMigration, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkSquashDirectives refuses files whose directives would change meaning in the baseline,
+// such as tags or env that select when a single file runs. no-transaction carries over to the
+// whole baseline and squashed is merged into its own directive.
+func checkSquashDirectives(path, content string) error {
+	for name := range database.ParseDirectives(content) {
+		if name != constants.DirectiveNoTransaction && name != constants.DirectiveSquashed {
+			return fmt.Errorf(constants.ErrSquashDirective, filepath.Base(path), name)
+		}
+	}
+	return nil
+}
+
+// squashSection renders one file of the baseline with every statement terminated for the dialect,
+// so the last statement of a file without a trailing semicolon does not run into the next file
+func squashSection(dialect database.Dialect, path, content string) string {
+	var statements []string
+	for _, statement := range dialect.SplitStatements(stripDirectives(content)) {
+		statements = append(statements, dialect.TerminateStatement(statement))
+	}
+	return fmt.Sprintf(constants.SquashSectionHeader, filepath.Base(path), strings.Join(statements, "\n"))
+}
+
+// stripDirectives removes elsa directives so the embedded files cannot configure the baseline
+func stripDirectives(content string) string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), constants.DirectivePrefix) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
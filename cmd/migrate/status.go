@@ -1,13 +1,13 @@
 package migrate
 
 import (
+	"context"
 	"fmt"
-	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"go.risoftinc.com/elsa/constants"
+	migrator "go.risoftinc.com/elsa/migrate"
 )
 
 var (
@@ -20,22 +20,36 @@ Examples:
   elsa migration status                   # Show status of all migrations
   elsa migration status --ddl            # Show only DDL migrations
   elsa migration status --dml            # Show only DML migrations
-  elsa migration status --path custom/migrations  # Use custom migration path`,
+  elsa migration status --path custom/migrations  # Use custom migration path
+  elsa migration status --all-targets    # Show status of every configured target
+  elsa migration status --output json    # One JSON object per migration
+  elsa migration status --check-pending  # Exit with code 3 when migrations are pending
+  elsa migration status --env production # Show migrations of other environments as skipped`,
 		RunE: runStatus,
 	}
 
-	showDDL          bool
-	showDML          bool
-	statusCustomPath string
+	showDDL            bool
+	showDML            bool
+	statusCustomPath   string
+	statusAllTargets   bool
+	statusOutput       string
+	statusCheckPending bool
 )
 
 func init() {
 	statusCmd.Flags().BoolVarP(&showDDL, "ddl", "d", false, "Show only DDL migrations")
 	statusCmd.Flags().BoolVarP(&showDML, "dml", "m", false, "Show only DML migrations")
 	statusCmd.Flags().StringVarP(&statusCustomPath, "path", "p", "", "Custom migration path")
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", constants.ReportOutputText, "Output format (text|json|yaml)")
+	statusCmd.Flags().BoolVar(&statusCheckPending, "check-pending", false, "Exit with code 3 when any migration is pending")
+	statusCmd.Flags().BoolVar(&statusAllTargets, "all-targets", false, "Show the status of every configured target")
 }
 
 func runStatus(cmd *cobra.Command, args []string) error {
+	if err := validateReportOutput(statusOutput); err != nil {
+		return err
+	}
+
 	// Determine which migration types to show
 	showTypes := []string{}
 	if showDDL {
@@ -47,8 +61,57 @@ func runStatus(cmd *cobra.Command, args []string) error {
 		showTypes = []string{constants.MigrationTypeDDL, constants.MigrationTypeDML}
 	}
 
-	fmt.Printf(constants.StatusOverviewHeader)
-	fmt.Printf(constants.StatusOverviewSeparator)
+	textOutput := statusOutput == constants.ReportOutputText
+	if textOutput {
+		fmt.Printf(constants.StatusOverviewHeader)
+		fmt.Printf(constants.StatusOverviewSeparator)
+	}
+
+	var reports []migrationReport
+	collect := func() error {
+		if textOutput {
+			if err := showTargetStatus(showTypes); err != nil {
+				return err
+			}
+		}
+		if !textOutput || statusCheckPending {
+			targetReports, err := buildMigrationReports(showTypes, statusCustomPath, "")
+			if err != nil {
+				return err
+			}
+			reports = append(reports, targetReports...)
+		}
+		return nil
+	}
+
+	var err error
+	if statusAllTargets {
+		if migrationTarget != "" || statusCustomPath != "" || migrationSource != "" {
+			return fmt.Errorf(constants.ErrAllTargetsConflict)
+		}
+		err = forEachTarget(textOutput, collect)
+	} else {
+		err = collect()
+	}
+	if err != nil {
+		return err
+	}
+
+	if !textOutput {
+		if err := printMigrationReports(reports, statusOutput); err != nil {
+			return err
+		}
+	}
+	if statusCheckPending {
+		return checkPendingReports(cmd, reports)
+	}
+	return nil
+}
+
+// showTargetStatus prints the status of the given migration types for the selected target
+func showTargetStatus(showTypes []string) error {
+	printConnectionContext("")
+	fmt.Println()
 
 	for _, migrationType := range showTypes {
 		if err := showMigrationStatus(migrationType); err != nil {
@@ -67,8 +130,8 @@ func showMigrationStatus(migrationType string) error {
 		return fmt.Errorf(constants.ErrFailedShowStatus, migrationType, err)
 	}
 
-	// Get applied migrations from database
-	appliedMigrations, err := getAppliedMigrations(migrationType)
+	// Compare them with the migrations table
+	statuses, err := getMigrationStatuses(migrationType, statusCustomPath, "")
 	if err != nil {
 		// If database connection fails, show only file-based status
 		fmt.Printf(constants.InfoWarningDBConnect, err)
@@ -91,33 +154,23 @@ func showMigrationStatus(migrationType string) error {
 		return nil
 	}
 
-	// Create applied migrations map for quick lookup
-	appliedMap := make(map[string]bool)
-	for _, id := range appliedMigrations {
-		appliedMap[id] = true
-	}
-
-	// Sort migrations by ID
-	sort.Slice(availableMigrations, func(i, j int) bool {
-		// Handle both sequential and timestamp formats
-		if isSequentialID(availableMigrations[i].ID) && isSequentialID(availableMigrations[j].ID) {
-			seqI, _ := strconv.Atoi(availableMigrations[i].ID)
-			seqJ, _ := strconv.Atoi(availableMigrations[j].ID)
-			return seqI < seqJ
-		}
-		return availableMigrations[i].ID < availableMigrations[j].ID
-	})
-
 	// Display header
 	fmt.Printf("🔧 %s Migrations:\n", strings.ToUpper(migrationType))
 	fmt.Printf("   ID                 Name                    Status\n")
-	fmt.Printf("   -------------------------------------------------------\n")
+	fmt.Printf("   ----------------------------------------------------------------\n")
 
-	// Display each migration
-	for _, migration := range availableMigrations {
+	// Display each migration, counting only records that still have a file (squashed IDs are archived)
+	appliedCount, skippedCount, modifiedCount, outOfOrderPending := 0, 0, 0, 0
+	for _, migration := range statuses {
 		status := constants.StatusPending
-		if appliedMap[migration.ID] {
+		switch {
+		case migration.Modified():
+			status = constants.StatusModified
+			modifiedCount++
+		case migration.Applied:
 			status = constants.StatusApplied
+		case migration.Skipped != "":
+			status = fmt.Sprintf(constants.StatusSkipped, migration.Skipped)
 		}
 
 		// Format ID for display (ensure consistent width)
@@ -126,15 +179,51 @@ func showMigrationStatus(migrationType string) error {
 			displayID = displayID + strings.Repeat(" ", 17-len(displayID))
 		}
 
+		if migration.Applied {
+			status += fmt.Sprintf(constants.StatusBatchSuffix, migration.Batch)
+			appliedCount++
+		} else if migration.Skipped != "" {
+			skippedCount++
+		}
+		if migration.OutOfOrder {
+			status += constants.StatusOutOfOrderSuffix
+			if !migration.Applied {
+				outOfOrderPending++
+			}
+		}
+
 		fmt.Printf("   %s  %-20s  %s\n", displayID, migration.Name, status)
 	}
 
 	// Show summary
-	appliedCount := len(appliedMigrations)
-	pendingCount := len(availableMigrations) - appliedCount
+	pendingCount := len(statuses) - appliedCount - skippedCount
 
 	fmt.Printf("\n   Summary: %d total, %d applied, %d pending\n",
-		len(availableMigrations), appliedCount, pendingCount)
+		len(statuses), appliedCount, pendingCount)
+
+	if skippedCount > 0 {
+		fmt.Printf(constants.InfoSkippedSummary, skippedCount, activeProfileName())
+	}
+	if modifiedCount > 0 {
+		fmt.Printf(constants.InfoWarningModifiedSummary, modifiedCount)
+	}
+	if outOfOrderPending > 0 {
+		fmt.Printf(constants.InfoWarningOutOfOrderSummary, outOfOrderPending)
+	}
 
 	return nil
 }
+
+// getMigrationStatuses compares the migration files of a type with the migrations table of the selected target
+func getMigrationStatuses(migrationType, customPath, connectionString string) ([]migrator.MigrationStatus, error) {
+	executor, err := connectMigrationExecutor(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := newMigrator(executor, customPath)
+	if err != nil {
+		return nil, err
+	}
+	return m.Status(context.Background(), migrationType)
+}
@@ -0,0 +1,66 @@
+package migrate
+
+import (
+	"fmt"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+// activeTarget is the named target selected with --target, nil for the default MIGRATE_CONNECTION database
+var activeTarget *database.Target
+
+// selectTarget makes the named target the one later commands connect to, an empty name selects the default database
+func selectTarget(name string) error {
+	if name == "" {
+		activeTarget = nil
+		return nil
+	}
+
+	target, err := database.LookupTarget(name)
+	if err != nil {
+		return err
+	}
+	activeTarget = target
+	return nil
+}
+
+// migrationTable returns the history table of the active target
+func migrationTable() string {
+	if activeTarget != nil {
+		return activeTarget.Table
+	}
+	return constants.MigrationsTableName
+}
+
+// forEachTarget runs fn once per configured target with that target selected,
+// printing a header per target unless the output is machine-readable
+func forEachTarget(printHeader bool, fn func() error) error {
+	targets, err := database.LoadTargets()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf(constants.ErrNoTargetsConfigured, constants.ElsaConfigFile, constants.TargetConnectionEnvPrefix)
+	}
+
+	previous := activeTarget
+	defer func() { activeTarget = previous }()
+
+	for i := range targets {
+		target := targets[i]
+		if target.Connection == "" {
+			return fmt.Errorf(constants.ErrTargetNoConnection, target.Name)
+		}
+
+		activeTarget = &target
+		if printHeader {
+			fmt.Printf(constants.InfoTargetHeader, target.Name, target.Path)
+		}
+		if err := fn(); err != nil {
+			return fmt.Errorf(constants.ErrTargetFailed, target.Name, err)
+		}
+	}
+
+	return nil
+}
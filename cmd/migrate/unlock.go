@@ -0,0 +1,52 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.risoftinc.com/elsa/constants"
+)
+
+var (
+	unlockCmd = &cobra.Command{
+		Use:   "unlock",
+		Short: "Release a migration lock left behind by a run that died",
+		Long: `Release the migration lock of a run that can no longer release it itself, e.g. after the machine running it was lost.
+Only SQLite and libSQL keep the lock in a table row; PostgreSQL, MySQL and SQL Server release their session locks when the connection ends.
+
+A lock held by an exited process on the same host, or whose heartbeat stopped for two minutes, is taken over by the next run anyway.
+Make sure no migration is running before you unlock.
+
+Examples:
+  elsa migration unlock                    # Remove the lock row
+  elsa migration unlock --target staging   # Remove the lock row of a target`,
+		Args:         cobra.NoArgs,
+		RunE:         runUnlock,
+		SilenceUsage: true,
+	}
+
+	unlockConnection string
+)
+
+func init() {
+	unlockCmd.Flags().StringVarP(&unlockConnection, "connection", "c", "", constants.UnlockConnectionFlagUsage)
+}
+
+func runUnlock(cmd *cobra.Command, args []string) error {
+	executor, err := connectMigrationExecutor(unlockConnection)
+	if err != nil {
+		return err
+	}
+
+	holder, err := executor.ForceUnlock()
+	if err != nil {
+		return err
+	}
+
+	if holder == "" {
+		fmt.Print(constants.InfoNoMigrationLock)
+		return nil
+	}
+	fmt.Printf(constants.SuccessMigrationUnlocked, holder)
+	return nil
+}
@@ -0,0 +1,175 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+var (
+	verifyCmd = &cobra.Command{
+		Use:   "verify [ddl|dml]",
+		Short: "Verify applied migrations against their files",
+		Long: `Verify that applied migration files have not been modified after they were applied.
+The command exits with a non-zero status when drift is detected, so it can be used as a CI gate.
+
+Examples:
+  elsa migration verify                    # Verify DDL and DML migrations
+  elsa migration verify ddl                # Verify only DDL migrations
+  elsa migration verify ddl --repair       # Re-stamp checksums after confirming the change was intentional`,
+		Args:         cobra.MaximumNArgs(1),
+		RunE:         runVerify,
+		SilenceUsage: true,
+	}
+
+	verifyRepair     bool
+	verifyCustomPath string
+	verifyConnection string
+	verifyForce      bool
+	verifyLockWait   time.Duration
+)
+
+func init() {
+	verifyCmd.Flags().BoolVarP(&verifyRepair, "repair", "r", false, "Re-stamp checksums of modified migrations after confirmation")
+	verifyCmd.Flags().StringVarP(&verifyCustomPath, "path", "p", "", "Custom migration path")
+	verifyCmd.Flags().StringVarP(&verifyConnection, "connection", "c", "", "Database connection string")
+	verifyCmd.Flags().DurationVar(&verifyLockWait, "lock-wait", constants.DefaultLockWait, "How long to wait for another migration run to finish before repairing")
+	verifyCmd.Flags().BoolVar(&verifyForce, "force", false, "Skip the database name confirmation on a protected database when repairing")
+}
+
+// checksumMismatch describes an applied migration whose file changed after it was applied
+type checksumMismatch struct {
+	Migration Migration
+	Recorded  string
+	Current   string
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	migrationTypes := []string{constants.MigrationTypeDDL, constants.MigrationTypeDML}
+	if len(args) == 1 {
+		if args[0] != constants.MigrationTypeDDL && args[0] != constants.MigrationTypeDML {
+			return fmt.Errorf(constants.ErrInvalidMigrationType, args[0])
+		}
+		migrationTypes = []string{args[0]}
+	}
+
+	executor, err := openMigrationExecutor(verifyConnection)
+	if err != nil {
+		return err
+	}
+
+	var mismatches []checksumMismatch
+	for _, migrationType := range migrationTypes {
+		fsys, available, err := listMigrations(migrationType, verifyCustomPath)
+		if err != nil {
+			return fmt.Errorf(constants.ErrFailedShowInfo, err)
+		}
+
+		records, err := executor.GetAppliedMigrationRecords(migrationType)
+		if err != nil {
+			return fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+		}
+
+		typeMismatches := findChecksumMismatches(fsys, available, records)
+		if len(typeMismatches) == 0 {
+			fmt.Printf(constants.SuccessChecksumsMatch, strings.ToUpper(migrationType))
+			continue
+		}
+
+		printChecksumMismatches(migrationType, typeMismatches)
+		mismatches = append(mismatches, typeMismatches...)
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	if !verifyRepair {
+		return fmt.Errorf(constants.ErrChecksumDrift, len(mismatches))
+	}
+
+	// Re-stamping overwrites the recorded history, so protected databases ask for the database name as well
+	guard, err := guardProtectedRun(cmd, args, executor, true, verifyForce)
+	if err != nil {
+		return err
+	}
+
+	// Re-stamping hides the drift for good, so require an explicit confirmation
+	fmt.Printf(constants.PromptConfirmRepair, len(mismatches))
+	reader := bufio.NewReader(os.Stdin)
+	input, _ := reader.ReadString('\n')
+	if strings.TrimSpace(strings.ToLower(input)) != "yes" {
+		return fmt.Errorf(constants.ErrRepairCancelled)
+	}
+
+	return guard.run(func() error {
+		return withMigrationLock(executor, verifyLockWait, func() error {
+			return repairChecksums(executor, mismatches)
+		})
+	})
+}
+
+// repairChecksums re-stamps the recorded checksums of modified migrations with the checksums of their files,
+// the caller holds the migration lock so no concurrent run records or rolls back rows meanwhile
+func repairChecksums(executor *database.MigrationExecutor, mismatches []checksumMismatch) error {
+	for _, mismatch := range mismatches {
+		if err := executor.UpdateChecksum(mismatch.Migration.ID, mismatch.Current); err != nil {
+			return err
+		}
+		fmt.Printf(constants.SuccessChecksumRepaired, mismatch.Migration.ID, mismatch.Migration.Name)
+	}
+
+	return nil
+}
+
+// findChecksumMismatches re-hashes every applied up file of the migration FS and returns those that no longer match
+func findChecksumMismatches(fsys fs.FS, available []Migration, records []database.MigrationRecord) []checksumMismatch {
+	idToMigration := make(map[string]Migration)
+	for _, m := range available {
+		idToMigration[m.ID] = m
+	}
+
+	var mismatches []checksumMismatch
+	for _, record := range records {
+		migration, exists := idToMigration[record.MigrationID]
+		if !exists {
+			// Missing files are reported by down/status, not treated as drift
+			continue
+		}
+
+		// The record still describes the original file of a squashed migration until the next run reconciles it
+		if len(migration.Squashes) > 0 && record.Name != migration.Name {
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, migration.Path)
+		if err != nil {
+			continue
+		}
+
+		if !database.ChecksumMatches(record.Checksum, string(content)) {
+			mismatches = append(mismatches, checksumMismatch{
+				Migration: migration,
+				Recorded:  record.Checksum,
+				Current:   database.GetMigrationChecksum(string(content)),
+			})
+		}
+	}
+
+	return mismatches
+}
+
+// printChecksumMismatches lists applied migrations that were modified after apply
+func printChecksumMismatches(migrationType string, mismatches []checksumMismatch) {
+	fmt.Printf(constants.InfoWarningChecksumDrift, len(mismatches), strings.ToUpper(migrationType))
+	for _, mismatch := range mismatches {
+		fmt.Printf(constants.InfoChecksumMismatch, mismatch.Migration.ID, mismatch.Migration.Name, mismatch.Recorded, mismatch.Current)
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"runtime"
 
 	"github.com/spf13/cobra"
@@ -20,6 +21,9 @@ var (
 	goVersion = runtime.Version()
 	platform  = fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
 
+	// envProfile selects the .env.<env> profile for this run, overriding ELSA_ENV
+	envProfile string
+
 	// rootCmd represents the base command when called without any subcommands
 	rootCmd = &cobra.Command{
 		Use:   constants.RootUse,
@@ -38,6 +42,14 @@ func Execute() error {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&envProfile, "env", "", constants.EnvFlagUsage)
+	cobra.OnInitialize(func() {
+		// Exported so every .env loader, including the Go migration runner, sees the same profile
+		if envProfile != "" {
+			os.Setenv(constants.EnvProfileVar, envProfile)
+		}
+	})
+
 	// Add migration command
 	rootCmd.AddCommand(migrate.MigrateCmd())
 
@@ -1,23 +1,31 @@
 package constants
 
+import "time"
+
 // Database driver constants
 const (
 	DriverSQLite     = "sqlite"
 	DriverMySQL      = "mysql"
 	DriverPostgres   = "postgres"
 	DriverPostgreSQL = "postgresql"
+	DriverSQLServer  = "sqlserver"
+	DriverMSSQL      = "mssql"
+	DriverLibSQL     = "libsql"
+	DriverClickHouse = "clickhouse"
 )
 
 // Database default values
 const (
-	DefaultHost         = "localhost"
-	DefaultPort         = "3306"
-	DefaultUsername     = "root"
-	DefaultPassword     = ""
-	DefaultDatabase     = "elsa.db"
-	DefaultSSLMode      = "disable"
-	DefaultCharset      = "utf8mb4"
-	DefaultPortPostgres = "5432"
+	DefaultHost           = "localhost"
+	DefaultPort           = "3306"
+	DefaultUsername       = "root"
+	DefaultPassword       = ""
+	DefaultDatabase       = "elsa.db"
+	DefaultSSLMode        = "disable"
+	DefaultCharset        = "utf8mb4"
+	DefaultPortPostgres   = "5432"
+	DefaultPortSQLServer  = "1433"
+	DefaultPortClickHouse = "9000"
 )
 
 // Database connection string prefixes
@@ -26,6 +34,9 @@ const (
 	MySQLPrefix       = "mysql://"
 	PostgresPrefix    = "postgresql://"
 	PostgresAltPrefix = "postgres://"
+	SQLServerPrefix   = "sqlserver://"
+	LibSQLPrefix      = "libsql://"
+	ClickHousePrefix  = "clickhouse://"
 )
 
 // Database table and field constants
@@ -37,6 +48,8 @@ const (
 	AppliedAtField      = "applied_at"
 	ChecksumField       = "checksum"
 	ExecutionTimeField  = "execution_time"
+	BatchField          = "batch"
+	OutOfOrderField     = "out_of_order"
 )
 
 // Migration type constants
@@ -45,6 +58,49 @@ const (
 	MigrationTypeDML = "dml"
 )
 
+// Migration file directive constants
+const (
+	// DirectivePrefix marks a header comment that configures how a migration file is executed
+	DirectivePrefix = "-- elsa:"
+
+	// DirectiveNoTransaction opts a migration file out of the surrounding transaction
+	DirectiveNoTransaction = "no-transaction"
+
+	// DirectiveSquashed lists the migration IDs a squash baseline replaces
+	DirectiveSquashed = "squashed"
+
+	// DirectiveEnv limits a migration to the listed environment profiles, e.g. `-- elsa:env dev,staging`
+	DirectiveEnv = "env"
+
+	// DirectiveTags labels a migration so it only runs when one of its tags is selected with --tags
+	DirectiveTags = "tags"
+
+	// DirectiveBatch runs the statement of a migration in key ranges, e.g. `-- elsa:batch size=5000 key=id sleep=100ms`
+	DirectiveBatch = "batch"
+
+	// GoDirectivePrefix marks a directive in the header comments of a Go migration
+	GoDirectivePrefix = "// elsa:"
+)
+
+// Batched migration constants
+const (
+	// BatchPlaceholder marks where a batched statement takes the condition of its key range
+	BatchPlaceholder = "{{batch}}"
+
+	// Options of the batch directive
+	BatchOptionSize  = "size"
+	BatchOptionKey   = "key"
+	BatchOptionTable = "table"
+	BatchOptionSleep = "sleep"
+
+	// DefaultBatchSize and DefaultBatchKey apply when the batch directive leaves them out
+	DefaultBatchSize = 1000
+	DefaultBatchKey  = "id"
+
+	// CheckpointTableSuffix is appended to the migrations table name for the table batched migrations resume from
+	CheckpointTableSuffix = "_checkpoints"
+)
+
 // Database schema constants
 const (
 	// Field lengths for MySQL compatibility
@@ -57,64 +113,528 @@ const (
 	PostgresTimeZone = "Asia/Jakarta"
 )
 
+// Migration lock constants
+const (
+	// MigrationLockName is the named lock used by MySQL GET_LOCK
+	MigrationLockName = "elsa_migrations"
+
+	// MigrationLockKey is the PostgreSQL advisory lock key ("elsa" in hex)
+	MigrationLockKey = int64(0x656c7361)
+
+	// LockTableSuffix is appended to the migrations table name for the SQLite lock table
+	LockTableSuffix = "_lock"
+
+	// LockPollInterval is how often a busy lock is retried
+	LockPollInterval = 500 * time.Millisecond
+
+	// LockHeartbeatColumn is refreshed in the lock table row while its holder runs
+	LockHeartbeatColumn = "heartbeat_at"
+
+	// LockHeartbeatInterval is how often the holder of a lock table row refreshes its heartbeat
+	LockHeartbeatInterval = 15 * time.Second
+
+	// LockStaleAfter is how old the heartbeat of a lock row held from another host may get before the row is taken over.
+	// Rows held from this host are taken over as soon as their process has exited.
+	LockStaleAfter = 2 * time.Minute
+
+	// DefaultLockWait is how long a run waits for another migration to finish
+	DefaultLockWait = 30 * time.Second
+)
+
+// Statement execution constants
+const (
+	// RetryBackoff is the wait before the first retry of a statement that lost a lock conflict, doubled on every retry
+	RetryBackoff = 500 * time.Millisecond
+
+	// MaxRetryBackoff caps the wait between retries
+	MaxRetryBackoff = 10 * time.Second
+
+	// PostgreSQL error codes of lock conflicts: lock_not_available, deadlock_detected and serialization_failure
+	PostgresLockNotAvailable    = "55P03"
+	PostgresDeadlockDetected    = "40P01"
+	PostgresSerializationFailed = "40001"
+
+	// MySQL error numbers of lock conflicts: ER_LOCK_WAIT_TIMEOUT and ER_LOCK_DEADLOCK
+	MySQLLockWaitTimeout = 1205
+	MySQLLockDeadlock    = 1213
+
+	// SQL Server error numbers of lock conflicts: lock request time out and deadlock victim
+	SQLServerLockTimeout = 1222
+	SQLServerDeadlock    = 1205
+
+	// Session statements bounding how long a statement waits for a lock
+	PostgresLockTimeoutSQL        = "SET lock_timeout = '%dms'"
+	MySQLLockWaitTimeoutSQL       = "SET SESSION lock_wait_timeout = %d"
+	MySQLInnoDBLockWaitTimeoutSQL = "SET SESSION innodb_lock_wait_timeout = %d"
+	SQLiteBusyTimeoutSQL          = "PRAGMA busy_timeout = %d"
+	SQLServerLockTimeoutSQL       = "SET LOCK_TIMEOUT %d"
+
+	// StatementLocation and StatementLocationInFile name a failing statement in errors
+	StatementLocation       = "statement %d"
+	StatementLocationInFile = "statement %d of %s"
+
+	// BatchRangeLocation names the key range a batched statement failed in, after the statement location
+	BatchRangeLocation = "%s for %s up to %d"
+)
+
+// Environment profile constants
+const (
+	// EnvProfileVar selects the environment profile, the --env flag sets it for the current run
+	EnvProfileVar = "ELSA_ENV"
+
+	// DotEnvFile is the base .env file, profiles layer .env.<env> and .env.<env>.local on top of it
+	DotEnvFile = ".env"
+
+	// DotEnvLocalSuffix marks the uncommitted per-machine overrides of a profile
+	DotEnvLocalSuffix = ".local"
+
+	// DefaultProfileName is shown when no profile is selected
+	DefaultProfileName = "default"
+)
+
+// Protected database constants
+const (
+	// ProtectedEnvVar marks every database of the current environment as protected when set to 1
+	ProtectedEnvVar = "ELSA_PROTECTED"
+
+	// AuditTableSuffix is appended to the migrations table name for the protected run audit table
+	AuditTableSuffix = "_audit"
+
+	// Audit record statuses
+	AuditStatusRunning   = "running"
+	AuditStatusSucceeded = "succeeded"
+	AuditStatusFailed    = "failed"
+)
+
+// Migration target constants
+const (
+	// ElsaConfigFile is the project config file that declares named migration targets under migration.targets
+	ElsaConfigFile = ".elsa-config.yaml"
+
+	// TargetConnectionEnvPrefix declares a target from the environment, e.g. MIGRATE_CONNECTION_REPORTING
+	TargetConnectionEnvPrefix = "MIGRATE_CONNECTION_"
+
+	// TargetPathEnvPrefix overrides the migration path of an environment target, e.g. MIGRATE_PATH_REPORTING
+	TargetPathEnvPrefix = "MIGRATE_PATH_"
+
+	// TargetTableEnvPrefix overrides the history table of an environment target, e.g. MIGRATE_TABLE_REPORTING
+	TargetTableEnvPrefix = "MIGRATE_TABLE_"
+)
+
 // Error messages
 const (
-	ErrUnsupportedDriver   = "unsupported database driver: %s"
-	ErrFailedConnect       = "failed to connect to database: %v"
-	ErrFailedGetDB         = "failed to get underlying sql.DB: %v"
-	ErrFailedPing          = "failed to ping database: %v"
-	ErrFailedReadEnv       = "failed to read .env file: %v"
-	ErrFailedRecord        = "failed to record migration: %v"
-	ErrFailedRemove        = "failed to remove migration record: %v"
-	ErrFailedExecute       = "failed to execute statement %d: %v\nSQL: %s"
-	ErrFailedGetMigrations = "failed to get applied migrations: %v"
+	ErrUnsupportedDriver        = "unsupported database driver: %s"
+	ErrFailedConnect            = "failed to connect to database: %v"
+	ErrFailedGetDB              = "failed to get underlying sql.DB: %v"
+	ErrFailedPing               = "failed to ping database: %v"
+	ErrFailedReadEnv            = "failed to read .env file: %v"
+	ErrFailedRecord             = "failed to record migration: %v"
+	ErrFailedRemove             = "failed to remove migration record: %v"
+	ErrFailedExecute            = "failed to execute %s: %w\nSQL: %s"
+	ErrStatementTimeout         = "%s timed out after %s\nSQL: %s"
+	ErrLockRetriesExhausted     = "still blocked by a lock after %d attempts: %w"
+	ErrFailedSetLockTimeout     = "failed to set lock timeout: %v"
+	ErrInvalidBatchOption       = "invalid batch option %q, expected size=<rows>, key=<column>, table=<name> or sleep=<duration>"
+	ErrInvalidBatchSize         = "invalid batch size %q, expected a positive number of rows"
+	ErrInvalidBatchSleep        = "invalid batch sleep %q: %v"
+	ErrBatchStatementCount      = "batched migration %s must contain exactly one statement, found %d"
+	ErrBatchNoPlaceholder       = "the statement of batched migration %s has no %s placeholder for the key range"
+	ErrBatchNoTable             = "cannot tell which table batched migration %s works through, set it with table=<name>"
+	ErrBatchKeyType             = "batched migration %s cannot range on %s: the column of %s is %s, set key=<column> to an integer column (UUID, text and composite keys are not supported)"
+	ErrBatchKeyMissing          = "batched migration %s: table %s has no column %s, set key=<column> to an integer column"
+	ErrFailedReadBatchRange     = "failed to read the next key range of %s: %v"
+	ErrFailedSaveCheckpoint     = "failed to save batch checkpoint: %v"
+	ErrFailedGetMigrations      = "failed to get applied migrations: %v"
+	ErrFailedUpdateChecksum     = "failed to update migration checksum: %v"
+	ErrFailedUpgradeTable       = "failed to upgrade migrations table: %v"
+	ErrFailedGetBatch           = "failed to determine migration batch: %v"
+	ErrFailedDumpSchema         = "failed to dump schema: %v"
+	ErrFailedLoadSchema         = "failed to load schema: %v"
+	ErrFailedReadElsaConfig     = "failed to read %s: %v"
+	ErrFailedWriteAudit         = "failed to write audit record: %v"
+	ErrUnknownTarget            = "unknown migration target %q (configured targets: %s)"
+	ErrNoTargetsConfigured      = "no migration targets configured, declare them under migration.targets in %s or with %s<NAME> variables"
+	ErrTargetNoConnection       = "migration target %q has no connection configured"
+	ErrSchemaUnsupportedDriver  = "schema dump is not supported for driver %s"
+	ErrSchemaDatabaseNotEmpty   = "schema can only be loaded into an empty database, found tables: %s"
+	ErrSchemaMigrationsApplied  = "schema can only be loaded into an empty database, %d migration(s) already applied"
+	ErrGoMigrationNoTransaction = "go migration requires a *sql.Tx but the connection is not in a transaction"
+	ErrGoMigrationMissingFunc   = "go migration %s has no %s function"
+	ErrGoMigrationTimeout       = "go migration %s_%s timed out after %s: %w"
+	ErrGoMigrationNotRegistered = "go migration %s is not registered, make sure its file calls elsa.RegisterMigration"
+	ErrFailedDecodeGoRequest    = "failed to decode go migration request: %v"
+	ErrFailedAcquireLock        = "failed to acquire migration lock: %v"
+	ErrFailedReleaseLock        = "failed to release migration lock: %v"
+	ErrMigrationInProgress      = "another migration is in progress (lock not acquired within %s)"
+	ErrMigrationInProgressTable = "another migration is in progress (held by %s since %s, lock not acquired within %s), if it is no longer running release the lock with elsa migration unlock"
+	ErrForceUnlockUnsupported   = "%s releases the migration lock when the session holding it ends, there is no lock row to remove"
+	ErrDiffUnsupportedDriver    = "schema diff is not supported for driver %s"
+	ErrFailedIntrospectSchema   = "failed to read the database schema: %v"
+	ErrFailedLoadModels         = "failed to load models: %v"
+	ErrModelPackageErrors       = "failed to load models from %s: %v"
+	ErrUnsupportedFixtureFormat = "unsupported fixture format %s"
+	ErrFailedParseFixture       = "failed to parse fixture: %v"
+	ErrFixtureNoTable           = "fixture has no table"
+	ErrFixtureNoPrimaryKey      = "fixture for %s has no primary_key, it is needed to roll the rows back"
+	ErrFixtureNoRows            = "fixture for %s has no rows"
+	ErrFixtureRowNoKey          = "fixture for %s: row %d has no value for primary key column %s"
 )
 
 // SQL statements
 const (
 	// MySQL create table
-	MySQLCreateTableSQL = `CREATE TABLE IF NOT EXISTS migrations (
+	MySQLCreateTableSQL = `CREATE TABLE IF NOT EXISTS %s (
 		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
 		migration_id VARCHAR(255) NOT NULL UNIQUE,
 		name VARCHAR(255) NOT NULL,
 		type VARCHAR(10) NOT NULL,
 		applied_at DATETIME(3) NOT NULL,
 		checksum VARCHAR(64) NOT NULL,
-		execution_time BIGINT NOT NULL
+		execution_time BIGINT NOT NULL,
+		batch INT NOT NULL DEFAULT 0,
+		out_of_order BOOLEAN NOT NULL DEFAULT FALSE
 	)`
 
 	// PostgreSQL create table
-	PostgresCreateTableSQL = `CREATE TABLE IF NOT EXISTS migrations (
+	PostgresCreateTableSQL = `CREATE TABLE IF NOT EXISTS %s (
 		id BIGSERIAL PRIMARY KEY,
 		migration_id VARCHAR(255) NOT NULL UNIQUE,
 		name VARCHAR(255) NOT NULL,
 		type VARCHAR(10) NOT NULL,
 		applied_at TIMESTAMP NOT NULL,
 		checksum VARCHAR(64) NOT NULL,
-		execution_time BIGINT NOT NULL
+		execution_time BIGINT NOT NULL,
+		batch INTEGER NOT NULL DEFAULT 0,
+		out_of_order BOOLEAN NOT NULL DEFAULT FALSE
 	)`
 
 	// SQLite create table
-	SQLiteCreateTableSQL = `CREATE TABLE IF NOT EXISTS migrations (
+	SQLiteCreateTableSQL = `CREATE TABLE IF NOT EXISTS %s (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		migration_id TEXT NOT NULL UNIQUE,
 		name TEXT NOT NULL,
 		type TEXT NOT NULL,
 		applied_at DATETIME NOT NULL,
 		checksum TEXT NOT NULL,
-		execution_time INTEGER NOT NULL
+		execution_time INTEGER NOT NULL,
+		batch INTEGER NOT NULL DEFAULT 0,
+		out_of_order BOOLEAN NOT NULL DEFAULT FALSE
+	)`
+
+	// SQL Server create table, which has no CREATE TABLE IF NOT EXISTS
+	SQLServerCreateTableSQL = `IF OBJECT_ID(N'%[1]s', N'U') IS NULL CREATE TABLE %[1]s (
+		id BIGINT IDENTITY(1,1) PRIMARY KEY,
+		migration_id NVARCHAR(255) NOT NULL UNIQUE,
+		name NVARCHAR(255) NOT NULL,
+		type NVARCHAR(10) NOT NULL,
+		applied_at DATETIME2(3) NOT NULL,
+		checksum NVARCHAR(64) NOT NULL,
+		execution_time BIGINT NOT NULL,
+		batch INT NOT NULL DEFAULT 0,
+		out_of_order BIT NOT NULL DEFAULT 0
 	)`
 
+	// ClickHouse create table. MergeTree has no auto-increment or unique columns,
+	// the id is taken from the insert time and migration_id is the sorting key instead.
+	ClickHouseCreateTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		id UInt64 DEFAULT toUInt64(toUnixTimestamp64Nano(now64(9))),
+		migration_id String,
+		name String,
+		type String,
+		applied_at DateTime64(3),
+		checksum String,
+		execution_time Int64,
+		batch Int32 DEFAULT 0,
+		out_of_order Bool DEFAULT false
+	) ENGINE = MergeTree ORDER BY migration_id`
+
 	// Generic create table (fallback)
-	GenericCreateTableSQL = `CREATE TABLE IF NOT EXISTS migrations (
+	GenericCreateTableSQL = `CREATE TABLE IF NOT EXISTS %s (
 		id BIGINT AUTO_INCREMENT PRIMARY KEY,
 		migration_id VARCHAR(255) NOT NULL UNIQUE,
 		name VARCHAR(255) NOT NULL,
 		type VARCHAR(10) NOT NULL,
 		applied_at TIMESTAMP NOT NULL,
 		checksum VARCHAR(64) NOT NULL,
-		execution_time BIGINT NOT NULL
+		execution_time BIGINT NOT NULL,
+		batch INTEGER NOT NULL DEFAULT 0,
+		out_of_order BOOLEAN NOT NULL DEFAULT FALSE
+	)`
+
+	// Audit table, one row per migration run against a protected database
+	MySQLCreateAuditTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		command VARCHAR(255) NOT NULL,
+		operator VARCHAR(255) NOT NULL,
+		forced BOOLEAN NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		error TEXT,
+		started_at DATETIME(3) NOT NULL,
+		finished_at DATETIME(3) NULL
+	)`
+
+	PostgresCreateAuditTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		id BIGSERIAL PRIMARY KEY,
+		command VARCHAR(255) NOT NULL,
+		operator VARCHAR(255) NOT NULL,
+		forced BOOLEAN NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		error TEXT,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP NULL
+	)`
+
+	SQLiteCreateAuditTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		command TEXT NOT NULL,
+		operator TEXT NOT NULL,
+		forced BOOLEAN NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME
+	)`
+
+	SQLServerCreateAuditTableSQL = `IF OBJECT_ID(N'%[1]s', N'U') IS NULL CREATE TABLE %[1]s (
+		id BIGINT IDENTITY(1,1) PRIMARY KEY,
+		command NVARCHAR(255) NOT NULL,
+		operator NVARCHAR(255) NOT NULL,
+		forced BIT NOT NULL,
+		status NVARCHAR(20) NOT NULL,
+		error NVARCHAR(MAX),
+		started_at DATETIME2(3) NOT NULL,
+		finished_at DATETIME2(3) NULL
+	)`
+
+	// ClickHouseCreateAuditTableSQL has no generated id, elsa numbers the runs itself
+	ClickHouseCreateAuditTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		id UInt64,
+		command String,
+		operator String,
+		forced Bool,
+		status String,
+		error Nullable(String),
+		started_at DateTime64(3),
+		finished_at Nullable(DateTime64(3))
+	) ENGINE = MergeTree ORDER BY id`
+
+	GenericCreateAuditTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		command VARCHAR(255) NOT NULL,
+		operator VARCHAR(255) NOT NULL,
+		forced BOOLEAN NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		error TEXT,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP NULL
+	)`
+
+	MySQLCreateCheckpointTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		migration_file VARCHAR(255) NOT NULL PRIMARY KEY,
+		checksum VARCHAR(64) NOT NULL,
+		last_key BIGINT NOT NULL,
+		rows_done BIGINT NOT NULL,
+		updated_at DATETIME(3) NOT NULL
+	)`
+
+	PostgresCreateCheckpointTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		migration_file VARCHAR(255) NOT NULL PRIMARY KEY,
+		checksum VARCHAR(64) NOT NULL,
+		last_key BIGINT NOT NULL,
+		rows_done BIGINT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`
+
+	SQLiteCreateCheckpointTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		migration_file TEXT NOT NULL PRIMARY KEY,
+		checksum TEXT NOT NULL,
+		last_key INTEGER NOT NULL,
+		rows_done INTEGER NOT NULL,
+		updated_at DATETIME NOT NULL
+	)`
+
+	SQLServerCreateCheckpointTableSQL = `IF OBJECT_ID(N'%[1]s', N'U') IS NULL CREATE TABLE %[1]s (
+		migration_file NVARCHAR(255) NOT NULL PRIMARY KEY,
+		checksum NVARCHAR(64) NOT NULL,
+		last_key BIGINT NOT NULL,
+		rows_done BIGINT NOT NULL,
+		updated_at DATETIME2(3) NOT NULL
+	)`
+
+	ClickHouseCreateCheckpointTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		migration_file String,
+		checksum String,
+		last_key Int64,
+		rows_done Int64,
+		updated_at DateTime64(3)
+	) ENGINE = MergeTree ORDER BY migration_file`
+
+	GenericCreateCheckpointTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		migration_file VARCHAR(255) NOT NULL PRIMARY KEY,
+		checksum VARCHAR(64) NOT NULL,
+		last_key BIGINT NOT NULL,
+		rows_done BIGINT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`
+
+	// AddBatchColumnSQL upgrades migrations tables created before batches were recorded
+	AddBatchColumnSQL = "ALTER TABLE %s ADD COLUMN batch INTEGER NOT NULL DEFAULT 0"
+
+	// BackfillBatchSQL gives every pre-existing migration its own batch, in apply order
+	BackfillBatchSQL = "UPDATE %s SET batch = id WHERE batch = 0"
+
+	// AddOutOfOrderColumnSQL upgrades migrations tables created before out-of-order applies were recorded
+	AddOutOfOrderColumnSQL = "ALTER TABLE %s ADD COLUMN out_of_order BOOLEAN NOT NULL DEFAULT FALSE"
+)
+
+// Schema dump constants
+const (
+	SchemaDumpHeader = `-- Elsa schema dump
+-- Driver: %s
+-- Generated at: %s
+-- Applied migrations: %d
+--
+-- Load into an empty database with: elsa migration schema load
+
+`
+	SchemaDumpMigrationsHeader = "-- Applied migrations\n\n"
+	SchemaTimestampFormat      = "2006-01-02 15:04:05.000"
+	SchemaInsertMigrationSQL   = "INSERT INTO %s (migration_id, name, type, applied_at, checksum, execution_time, batch, out_of_order) VALUES (%s, %s, %s, %s, %s, %d, %d, %t)"
+
+	SQLiteInternalTablePrefix = "sqlite_"
+	SQLiteSchemaObjectsSQL    = `SELECT name, tbl_name, sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type WHEN 'table' THEN 1 WHEN 'index' THEN 2 WHEN 'view' THEN 3 ELSE 4 END, name`
+
+	MySQLShowTablesSQL              = "SHOW FULL TABLES"
+	MySQLViewTableType              = "VIEW"
+	MySQLShowCreateTableSQL         = "SHOW CREATE TABLE %s"
+	MySQLShowCreateViewSQL          = "SHOW CREATE VIEW %s"
+	MySQLDisableForeignKeyChecksSQL = "SET FOREIGN_KEY_CHECKS = 0"
+	MySQLEnableForeignKeyChecksSQL  = "SET FOREIGN_KEY_CHECKS = 1"
+
+	PostgresExtensionsSQL = `SELECT format('CREATE EXTENSION IF NOT EXISTS %I', extname) FROM pg_extension
+		WHERE extname <> 'plpgsql' ORDER BY extname`
+	PostgresEnumTypesSQL = `SELECT format('CREATE TYPE %I AS ENUM (%s)', t.typname,
+			string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder))
+		FROM pg_type t JOIN pg_enum e ON e.enumtypid = t.oid
+		WHERE t.typnamespace = current_schema()::regnamespace
+		GROUP BY t.typname ORDER BY t.typname`
+	PostgresFunctionsSQL = `SELECT pg_get_functiondef(p.oid) FROM pg_proc p
+		WHERE p.pronamespace = current_schema()::regnamespace AND p.prokind IN ('f', 'p')
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype = 'e')
+		ORDER BY p.proname, p.oid`
+	PostgresSequencesSQL = `SELECT format('CREATE SEQUENCE %I START WITH %s INCREMENT BY %s', c.relname, s.seqstart, s.seqincrement) AS create_sql,
+			COALESCE(t.relname, '') AS owner_table,
+			CASE WHEN t.oid IS NULL THEN '' ELSE format('ALTER SEQUENCE %I OWNED BY %I.%I', c.relname, t.relname, a.attname) END AS owned_by_sql
+		FROM pg_class c
+		JOIN pg_sequence s ON s.seqrelid = c.oid
+		LEFT JOIN pg_depend d ON d.objid = c.oid AND d.classid = 'pg_class'::regclass AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+		LEFT JOIN pg_class t ON t.oid = d.refobjid
+		LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		WHERE c.relkind = 'S' AND c.relnamespace = current_schema()::regnamespace AND (d.deptype IS NULL OR d.deptype = 'a')
+		ORDER BY c.relname`
+	PostgresTablesSQL = `SELECT c.oid, c.relname AS name, quote_ident(c.relname) AS quoted_name FROM pg_class c
+		WHERE c.relkind = 'r' AND c.relnamespace = current_schema()::regnamespace
+		ORDER BY c.relname`
+	PostgresColumnsSQL = `SELECT format('%I %s', a.attname, format_type(a.atttypid, a.atttypmod))
+			|| CASE a.attidentity WHEN 'a' THEN ' GENERATED ALWAYS AS IDENTITY' WHEN 'd' THEN ' GENERATED BY DEFAULT AS IDENTITY' ELSE '' END
+			|| CASE WHEN a.attgenerated = 's' THEN ' GENERATED ALWAYS AS (' || pg_get_expr(d.adbin, d.adrelid) || ') STORED'
+				WHEN d.adbin IS NOT NULL THEN ' DEFAULT ' || pg_get_expr(d.adbin, d.adrelid) ELSE '' END
+			|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+		FROM pg_attribute a
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = ? AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`
+	PostgresTableConstraintsSQL = `SELECT format('CONSTRAINT %I %s', conname, pg_get_constraintdef(oid)) FROM pg_constraint
+		WHERE conrelid = ? AND contype IN ('p', 'u', 'c', 'x')
+		ORDER BY CASE contype WHEN 'p' THEN 1 WHEN 'u' THEN 2 ELSE 3 END, conname`
+	PostgresCreateTableFormat = "CREATE TABLE %s (\n    %s\n)"
+	PostgresIndexesSQL        = `SELECT pg_get_indexdef(i.indexrelid) FROM pg_index i
+		JOIN pg_class t ON t.oid = i.indrelid
+		WHERE t.relkind = 'r' AND t.relnamespace = current_schema()::regnamespace AND t.relname NOT IN ?
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = i.indexrelid)
+		ORDER BY 1`
+	PostgresForeignKeysSQL = `SELECT format('ALTER TABLE ONLY %I ADD CONSTRAINT %I %s', t.relname, c.conname, pg_get_constraintdef(c.oid))
+		FROM pg_constraint c JOIN pg_class t ON t.oid = c.conrelid
+		WHERE c.contype = 'f' AND t.relnamespace = current_schema()::regnamespace AND t.relname NOT IN ?
+		ORDER BY t.relname, c.conname`
+	PostgresViewsSQL = `SELECT CASE c.relkind
+			WHEN 'm' THEN format(E'CREATE MATERIALIZED VIEW %I AS\n%s\nWITH NO DATA', c.relname, rtrim(pg_get_viewdef(c.oid), ';'))
+			ELSE format(E'CREATE VIEW %I AS\n%s', c.relname, pg_get_viewdef(c.oid)) END
+		FROM pg_class c
+		WHERE c.relkind IN ('v', 'm') AND c.relnamespace = current_schema()::regnamespace
+		ORDER BY c.oid`
+	PostgresTriggersSQL = `SELECT pg_get_triggerdef(tg.oid) FROM pg_trigger tg
+		JOIN pg_class t ON t.oid = tg.tgrelid
+		WHERE NOT tg.tgisinternal AND t.relnamespace = current_schema()::regnamespace
+		ORDER BY t.relname, tg.tgname`
+)
+
+// Schema diff constants
+const (
+	SQLiteIndexListSQL          = `SELECT name, "unique" AS is_unique, origin FROM pragma_index_list(?)`
+	SQLiteIndexColumnsSQL       = "SELECT name FROM pragma_index_info(?) ORDER BY seqno"
+	SQLitePrimaryKeyColumnsSQL  = "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk"
+	SQLitePrimaryKeyIndexOrigin = "pk"
+	SQLiteUniqueIndexOrigin     = "u"
+
+	MySQLTableIndexesSQL = `SELECT INDEX_NAME AS name, NON_UNIQUE = 0 AS is_unique, COLUMN_NAME AS column_name
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME <> 'PRIMARY'
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`
+	PostgresTableIndexesSQL = `SELECT i.relname AS name, ix.indisunique AS is_unique, a.attname AS column_name,
+			EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = ix.indexrelid) AS is_constraint
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE t.relname = ? AND t.relnamespace = current_schema()::regnamespace AND NOT ix.indisprimary
+		ORDER BY i.relname, k.ord`
+
+	DiffCreateTableFormat    = "CREATE TABLE %s (\n    %s\n)"
+	DiffPrimaryKeyFormat     = "PRIMARY KEY (%s)"
+	DiffDropTableFormat      = "DROP TABLE %s"
+	DiffAddColumnFormat      = "ALTER TABLE %s ADD COLUMN %s"
+	DiffDropColumnFormat     = "ALTER TABLE %s DROP COLUMN %s"
+	DiffModifyColumnFormat   = "ALTER TABLE %s MODIFY COLUMN %s"
+	DiffAlterColumnFormat    = "ALTER TABLE %s ALTER COLUMN %s %s"
+	DiffCreateIndexFormat    = "CREATE %sINDEX %s ON %s (%s)"
+	DiffDropIndexFormat      = "DROP INDEX %s"
+	DiffMySQLDropIndexFormat = "DROP INDEX %s ON %s"
+	DiffDropConstraintFormat = "ALTER TABLE %s DROP CONSTRAINT %s"
+
+	DiffWarningUnmappedField    = "field %s.%s of type %s has no column type, add a gorm type tag or ignore it with gorm:\"-\""
+	DiffWarningPrimaryKey       = "primary key of %s changed from (%s) to (%s), change it by hand"
+	DiffWarningSQLiteAlter      = "SQLite cannot alter column %s.%s, rebuild the table by hand"
+	DiffWarningSQLiteConstraint = "SQLite cannot drop the UNIQUE constraint %s of %s, rebuild the table by hand"
+)
+
+// Migration lock SQL statements
+const (
+	PostgresTryLockSQL  = "SELECT pg_try_advisory_lock($1)"
+	PostgresUnlockSQL   = "SELECT pg_advisory_unlock($1)"
+	MySQLGetLockSQL     = "SELECT GET_LOCK(?, ?)"
+	MySQLReleaseLockSQL = "SELECT RELEASE_LOCK(?)"
+
+	// sp_getapplock returns 0 or 1 when the lock was granted and a negative code on timeout or deadlock
+	SQLServerGetLockSQL = `DECLARE @result INT;
+		EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = @p2;
+		SELECT @result`
+	SQLServerReleaseLockSQL = "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'"
+
+	SQLiteCreateLockTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY,
+		locked_at DATETIME NOT NULL,
+		heartbeat_at DATETIME,
+		holder TEXT NOT NULL
 	)`
+	SQLiteAddLockHeartbeatSQL = "ALTER TABLE %s ADD COLUMN heartbeat_at DATETIME"
+	SQLiteInsertLockSQL       = "INSERT INTO %s (id, locked_at, heartbeat_at, holder) VALUES (1, ?, ?, ?)"
+	SQLiteHeartbeatLockSQL    = "UPDATE %s SET heartbeat_at = ? WHERE holder = ?"
+	SQLiteSelectLockSQL       = "SELECT holder, locked_at, heartbeat_at FROM %s WHERE id = 1"
+	SQLiteDeleteLockSQL       = "DELETE FROM %s WHERE holder = ?"
 )
 
 // Connection string formats
@@ -124,8 +644,56 @@ const (
 	PostgresConnectionFormat = "postgresql://%s:%s@%s:%s/%s?sslmode=%s"
 )
 
+// SQL Server connection constants
+const (
+	// SQLServerDatabaseParam names the database in sqlserver:// connection strings, as go-mssqldb expects it
+	SQLServerDatabaseParam = "database"
+
+	// SQLServerBatchSeparator on a line of its own ends a batch, like in sqlcmd and SSMS
+	SQLServerBatchSeparator = "GO"
+)
+
+// libSQL connection constants
+const (
+	// LibSQLAuthTokenParam carries the database token in libsql:// connection strings, as libsql-client-go expects it
+	LibSQLAuthTokenParam = "authToken"
+
+	// LibSQLBusyCode is how a libSQL server reports SQLITE_BUSY, its errors carry no sqlite3 error code
+	LibSQLBusyCode = "SQLITE_BUSY"
+)
+
+// ClickHouse connection constants
+const (
+	// ClickHouseMutationsSyncParam is the setting that makes ALTER TABLE ... DELETE and UPDATE wait for their mutation.
+	// ClickHouse runs mutations in the background by default, so a rolled back migration would still be listed as applied.
+	ClickHouseMutationsSyncParam = "mutations_sync"
+
+	// ClickHouseMutationsSyncAll waits for the mutation on all replicas
+	ClickHouseMutationsSyncAll = "2"
+)
+
+// MySQLDelimitedStatementFormat renders a statement with semicolons in its body for the mysql client
+const MySQLDelimitedStatementFormat = "DELIMITER //\n%s\n//\nDELIMITER ;"
+
 // DSN formats
 const (
 	MySQLDSNFormat    = "%s:%s@tcp(%s:%s)/%s?charset=%s&parseTime=True&loc=Local"
 	PostgresDSNFormat = "host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s"
 )
+
+// Fixture constants
+const (
+	FixtureFormatYAML       = "yaml"
+	FixtureFormatJSON       = "json"
+	FixtureFormatCSV        = "csv"
+	FixtureBatchSize        = 100
+	FixtureCSVCommentPrefix = "#"
+	FixtureTableKey         = "table"
+	FixturePrimaryKeyKey    = "primary_key"
+	FixtureEnvKey           = "env"
+	FixtureTagsKey          = "tags"
+	FixtureTimestampFormat  = "2006-01-02 15:04:05"
+	FixtureInsertFormat     = "INSERT INTO %s (%s) VALUES\n    %s"
+	FixtureDeleteFormat     = "DELETE FROM %s WHERE %s"
+	FixtureKeyInFormat      = "%s IN (%s)"
+)
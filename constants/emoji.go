@@ -82,4 +82,16 @@ const (
 
 	// PartyEmoji is the emoji used for celebration/success
 	PartyEmoji = "🎉"
+
+	// TargetEmoji is the emoji used for named migration targets
+	TargetEmoji = "🎯"
+
+	// SkipEmoji is the emoji used for migrations filtered out by environment or tags
+	SkipEmoji = "⏭️"
+
+	// PackageEmoji is the emoji used for migration bundles
+	PackageEmoji = "📦"
+
+	// HookEmoji is the emoji used for migration hooks
+	HookEmoji = "🪝"
 )
@@ -21,7 +21,8 @@ Examples:
   elsa migration up ddl                                             Apply all DDL migrations
   elsa migration down dml                                           Rollback last DML migration
   elsa migration status                                             Show migration status
-  elsa migration refresh ddl                                        Refresh all DDL migrations`
+  elsa migration refresh ddl                                        Refresh all DDL migrations
+  elsa migration redo ddl --step 2                                  Roll back and re-apply the last 2 DDL migrations`
 )
 
 // Migration type constants (reusing from database constants)
@@ -35,10 +36,95 @@ const (
 	DownMigrationExtension = ".down.sql"
 )
 
+// Migration directions
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
+
+// LatestBatch is the --batch value used when the flag is given without a number
+const LatestBatch = -1
+
+// Migration filters: a migration restricted by the env or tags directive is skipped with one of these reasons
+const (
+	SkipReasonEnv      = "env"
+	SkipReasonTags     = "tags"
+	NoMigrationsListed = "none"
+	NoEnvProfile       = "none"
+	TagsFlagUsage      = "Run migrations tagged with one of these tags (-- elsa:tags), untagged migrations always run"
+)
+
+// Migration kinds
+const (
+	MigrationKindSQL     = "sql"
+	MigrationKindGo      = "go"
+	MigrationKindFixture = "fixture"
+)
+
+// Fixture migration extensions, accepted in the dml folder only.
+// A fixture file is its own down migration, rolling back deletes its rows by primary key.
+const (
+	FixtureYAMLExtension = ".up.yaml"
+	FixtureYMLExtension  = ".up.yml"
+	FixtureJSONExtension = ".up.json"
+	FixtureCSVExtension  = ".up.csv"
+)
+
+// Go migration constants
+const (
+	GoMigrationExtension  = ".go"
+	GoTestFileSuffix      = "_test.go"
+	GoMigrationRunnerDir  = ".elsa-gomigrate-"
+	GoMigrationRunnerFile = "main.go"
+	GoModFile             = "go.mod"
+	GoModModulePrefix     = "module "
+	GoMigrationRunnerTmpl = `// Code generated by elsa to run Go migrations. DO NOT EDIT.
+package main
+
+import (
+	"go.risoftinc.com/elsa/migrate"
+
+	_ "%s"
+)
+
+func main() {
+	migrate.RunGoMigrationMain()
+}
+`
+	GoMigrationTemplate = `package %[1]s
+
+import (
+	"database/sql"
+
+	"go.risoftinc.com/elsa"
+)
+
+func init() {
+	elsa.RegisterMigration("%[2]s", migration%[2]sUp, migration%[2]sDown)
+}
+
+// migration%[2]sUp applies the %[3]s migration
+func migration%[2]sUp(tx *sql.Tx) error {
+	// Write your migration logic here, e.g.:
+	// _, err := tx.Exec("UPDATE users SET status = ? WHERE status IS NULL", "active")
+	// return err
+	return nil
+}
+
+// migration%[2]sDown rolls back the %[3]s migration
+func migration%[2]sDown(tx *sql.Tx) error {
+	// Write your rollback logic here
+	return nil
+}
+`
+)
+
 // Migration directory structure
 const (
 	DefaultMigrationBaseDir = "database"
 	DefaultMigrationDir     = "migration"
+	DefaultSchemaFile       = "schema.sql"
+	SquashedArchiveDir      = "squashed"
 )
 
 // Migration file format constants
@@ -50,6 +136,15 @@ const (
 	MigrationNameFormat  = "%s_%s"
 )
 
+// Squash baseline constants
+const (
+	SquashBaselineName   = "squashed_baseline"
+	SquashBaselineHeader = `-- Squashed baseline of %d migrations (%s..%s)
+-- The original files are archived in the squashed/ folder
+`
+	SquashSectionHeader = "\n-- From %s\n%s\n"
+)
+
 // Migration file permissions
 const (
 	MigrationDirPerm  = 0755
@@ -63,9 +158,9 @@ const (
 	ErrFailedConnectDB            = "failed to connect to database: %v"
 	ErrFailedEnsureTable          = "failed to ensure migration table: %v"
 	ErrFailedReadFile             = "failed to read migration file: %v"
-	ErrFailedExecuteMigration     = "failed to execute migration: %v"
+	ErrFailedExecuteMigration     = "failed to execute migration: %w"
 	ErrFailedRecordMigration      = "failed to record migration: %v"
-	ErrFailedRollbackMigration    = "failed to execute rollback migration: %v"
+	ErrFailedRollbackMigration    = "failed to execute rollback migration: %w"
 	ErrFailedRemoveRecord         = "failed to remove migration record: %v"
 	ErrFailedCreateDir            = "failed to create migration directory: %v"
 	ErrFailedCreateFile           = "failed to create migration file: %v"
@@ -73,24 +168,60 @@ const (
 	ErrFailedValidateFolder       = "failed to validate folder format consistency: %v"
 	ErrFailedGetAppliedMigrations = "failed to get applied migrations: %v"
 	ErrFailedApplyMigration       = "failed to apply migration %s: %v"
+	ErrFailedRollbackMigrationID  = "failed to rollback migration %s: %v"
+	ErrSquashTargetNotFound       = "migration %s not found, --to must name an existing migration"
+	ErrSquashTooFew               = "nothing to squash, %s is the first migration"
+	ErrSquashGoMigration          = "cannot squash Go migration %s_%s, choose a --to before it"
+	ErrSquashFixture              = "cannot squash fixture migration %s_%s, choose a --to before it"
+	ErrSquashDirective            = "cannot squash %s, its -- elsa:%s directive cannot be carried into the baseline; choose a --to before it"
+	ErrInvalidFixtureFile         = "invalid fixture %s: %v"
+	ErrSquashNotApplied           = "migration %s_%s is not applied, only applied migrations can be squashed"
+	ErrSquashPartiallyApplied     = "baseline %s replaces %[3]d migrations but only %[2]d of them are applied; apply the archived files in the squashed/ folder first"
+	ErrFailedArchiveMigration     = "failed to archive squashed migration: %v"
+	ErrFailedWriteSchema          = "failed to write schema file: %v"
+	ErrFailedReadSchema           = "failed to read schema file: %v"
+	ErrInvalidBatch               = "invalid batch %d, use --batch for the latest batch or --batch=<number>"
 	ErrFailedRollbackAll          = "failed to rollback migrations: %v"
 	ErrFailedApplyAll             = "failed to apply migrations: %v"
 	ErrFailedShowStatus           = "failed to show %s migration status: %v"
 	ErrFailedShowInfo             = "failed to get available migrations: %v"
 	ErrFailedConnectDBStatus      = "Could not connect to database: %v"
 	ErrFailedConnectDBInfo        = "Could not connect to database: %v"
+	ErrInvalidPlanOutput          = "invalid output format: %s (expected 'text' or 'sql')"
+	ErrGoMigrationNoConnection    = "go migration runner needs the connection configuration of the executor"
+	ErrFailedRunGoMigration       = "failed to run go migration: %v"
+	ErrFailedGenerateGoRunner     = "failed to generate go migration runner: %v"
+	ErrGoMigrationOutsideModule   = "go migration folder %s must be inside the current Go module"
+	ErrGoModNotFound              = "go migrations require running elsa from the module root (go.mod): %v"
+	ErrChecksumDrift              = "%d applied migration(s) were modified after apply"
+	ErrRepairCancelled            = "checksum repair cancelled"
+	ErrProtectedNeedsForce        = "%s is a protected database, run %s interactively to confirm or pass --force"
+	ErrProtectedCancelled         = "database name did not match, nothing was changed"
+	ErrInvalidReportOutput        = "invalid output format: %s (expected 'text', 'json' or 'yaml')"
+	ErrFailedWriteReport          = "failed to write migration report: %v"
+	ErrMigrationsPending          = "%d migration(s) pending"
+	ErrOutOfOrder                 = "%d pending migration(s) are older than the newest applied migration %s:\n%s\nrename them to a newer ID or rerun with --allow-out-of-order"
+	ErrTargetFailed               = "target %s: %v"
+	ErrAllTargetsConflict         = "--all-targets cannot be combined with --target, --connection, --path or --source"
+	ErrInvalidRedoStep            = "invalid step %d, redo needs at least one migration"
+	ErrRedoMissingFile            = "migration file for applied ID %s not found, nothing was rolled back"
+	ErrRedoFailed                 = "redo stopped at %s_%s (%s): %v\n   rolled back %d of %d, re-applied %d of %d\n   not applied: %s\n   fix the migration and run 'elsa migration up %s'"
 )
 
 // Success messages
 const (
-	SuccessExecuted        = "   " + SuccessEmoji + " Executed in %dms\n"
-	SuccessRolledBack      = "   " + SuccessEmoji + " Rolled back in %dms\n"
-	SuccessConnected       = SuccessEmoji + " Successfully connected to database!\n"
-	SuccessTableExists     = SuccessEmoji + " Migration table exists and is ready!\n"
-	SuccessAllApplied      = SuccessEmoji + " All %s migrations are already applied\n"
-	SuccessAllRolledBack   = SuccessEmoji + " All %s migrations rolled back successfully\n"
-	SuccessAllAppliedAgain = SuccessEmoji + " All %s migrations applied successfully\n"
-	SuccessRefreshed       = PartyEmoji + " Successfully refreshed all %s migrations!\n"
+	SuccessExecuted         = "   " + SuccessEmoji + " Executed in %dms\n"
+	SuccessRolledBack       = "   " + SuccessEmoji + " Rolled back in %dms\n"
+	SuccessConnected        = SuccessEmoji + " Successfully connected to database!\n"
+	SuccessTableExists      = SuccessEmoji + " Migration table exists and is ready!\n"
+	SuccessAllApplied       = SuccessEmoji + " All %s migrations are already applied\n"
+	SuccessRefreshed        = PartyEmoji + " Successfully refreshed all %s migrations!\n"
+	SuccessRedone           = PartyEmoji + " Successfully redid %d %s migration(s) as batch %d\n"
+	SuccessChecksumsMatch   = SuccessEmoji + " All applied %s migrations match their files\n"
+	SuccessChecksumRepaired = SuccessEmoji + " Re-stamped checksum: %s_%s\n"
+	SuccessSquashed         = SuccessEmoji + " Squashed %d %s migrations into %s\n"
+	SuccessSchemaDumped     = SuccessEmoji + " Schema dumped to %s\n"
+	SuccessSchemaLoaded     = SuccessEmoji + " Schema loaded from %s, %d migration(s) marked as applied\n" + InfoEmoji + " Run 'elsa migration up' to apply migrations newer than the dump\n"
 )
 
 // Info messages
@@ -98,6 +229,7 @@ const (
 	InfoUsingSequential           = NumberEmoji + " Using sequential format: %s\n"
 	InfoUsingTimestamp            = CalendarEmoji + " Using timestamp format: %s\n"
 	InfoUsingConnectionFlag       = LinkEmoji + " Using connection string from flag:\n"
+	InfoUsingTargetConnection     = LinkEmoji + " Using connection string of target %s:\n"
 	InfoLoadedFromEnv             = FolderEmoji + " Loaded configuration from .env file:\n"
 	InfoNoEnvFile                 = InfoEmoji + " No .env file found or invalid configuration\n"
 	InfoTestingConnection         = PlugEmoji + " Testing database connection...\n"
@@ -108,18 +240,61 @@ const (
 	InfoNoMigrationsToApply       = InfoEmoji + " No %s migrations to apply\n"
 	InfoNoMigrationsToRollbackAll = InfoEmoji + " No %s migrations have been applied\n"
 	InfoApplyingMigrations        = RocketEmoji + " Applying %d %s migration(s)...\n"
+	InfoSquashArchived            = FolderEmoji + " Original files moved to %s\n"
+	InfoSquashReconciled          = InfoEmoji + " Recorded %d squashed migration(s) as satisfied by baseline %s_%s\n"
+	InfoChecksumsUpgraded         = InfoEmoji + " Upgraded the recorded checksums of %d %s migration(s) to SHA-256\n"
+	InfoApplyingMigrationsBatch   = RocketEmoji + " Applying %d %s migration(s) as batch %d...\n"
+	InfoRedoingMigrations         = RestartEmoji + " Redoing %d %s migration(s)...\n"
+	InfoNoMigrationsInBatch       = InfoEmoji + " No %s migrations recorded in batch %d\n"
+	InfoConnectionContext         = PlugEmoji + " Profile: %s | Host: %s\n"
+	InfoConnectionContextTarget   = PlugEmoji + " Profile: %s | Target: %s | Host: %s\n"
+	ConnectionNotConfigured       = "not configured"
+	InfoTargetHeader              = "\n" + TargetEmoji + " Target: %s (%s)\n"
 	InfoRollingBackMigrations     = RestartEmoji + " Rolling back %d %s migration(s)...\n"
 	InfoRefreshingMigrations      = RestartEmoji + " Refreshing all %s migrations...\n"
-	InfoStep1Rollback             = OutboxEmoji + " Step 1: Rolling back all applied %s migrations...\n"
-	InfoStep2Apply                = InboxEmoji + " Step 2: Applying all %s migrations...\n"
 	InfoMigrationTableReady       = SuccessEmoji + " Migration table ready!\n"
 	InfoConfigSaved               = FloppyDiskEmoji + " Configuration saved to .env file\n"
 	InfoWarningSaveConfig         = WarningEmoji + " Warning: Could not save configuration to .env file: %v\n"
 	InfoWarningFileNotFound       = WarningEmoji + " Warning: Migration file for ID %s not found, skipping\n"
 	InfoWarningDBConnect          = WarningEmoji + " Warning: Could not connect to database: %v\n"
+	InfoWarningNonTransactional   = WarningEmoji + " Warning: %s does not support transactional DDL, a failed migration may leave partial changes behind\n"
 	InfoShowingFileBased          = "   Showing file-based status only (no applied/pending info)\n"
 	InfoShowingFileBasedInfo      = "   Showing file-based information only\n"
 	InfoDatabaseStatusUnavailable = "   Summary: %d total (database status unavailable)\n"
+	InfoWarningChecksumDrift      = WarningEmoji + " Warning: %d applied %s migration(s) modified after apply:\n"
+	InfoChecksumMismatch          = "   %s_%s (recorded: %s, current: %s)\n"
+	InfoWarningOutOfOrder         = WarningEmoji + " Applying %d migration(s) out of order, they are older than the newest applied migration %s\n"
+	InfoWarningOutOfOrderSummary  = "   " + WarningEmoji + " %d pending migration(s) are older than the newest applied one, 'elsa migration up' refuses them without --allow-out-of-order\n"
+	InfoWarningModifiedSummary    = "   " + WarningEmoji + " %d migration(s) modified after apply, run 'elsa migration verify' for details\n"
+	InfoSkippedMigrations         = SkipEmoji + "  Skipping %d %s migration(s) not selected by the environment (%s) or --tags\n"
+	InfoSkippedSummary            = "   " + SkipEmoji + "  %d migration(s) skipped, not selected by the environment (%s) or --tags\n"
+	PromptConfirmProtected        = WarningEmoji + " %s is a protected database. Type the database name (%s) to continue: "
+	PromptConfirmRepair           = "Re-stamp checksums for %d migration(s)? Only do this if the changes were intentional. Type 'yes' to confirm: "
+)
+
+// Status and info report constants
+const (
+	ReportOutputText = "text"
+	ReportOutputJSON = "json"
+	ReportOutputYAML = "yaml"
+
+	// ExitCodePending is returned by --check-pending when migrations are waiting to be applied
+	ExitCodePending = 3
+)
+
+// Dry-run plan constants
+const (
+	PlanOutputText           = "text"
+	PlanOutputSQL            = "sql"
+	InfoPlanHeader           = PencilEmoji + " Dry run: %d %s migration step(s) would be executed\n"
+	InfoPlanEmpty            = InfoEmoji + " Dry run: no %s migrations would be executed\n"
+	InfoPlanFooter           = "\n" + InfoEmoji + " Dry run only, the database and migrations table were not changed\n"
+	PlanSQLHeader            = "-- Elsa migration plan (%s, %d step(s))\n-- Review before applying by hand\n"
+	PlanSQLStepHeader        = "\n-- Migration %s_%s (%s)\n-- File: %s\n"
+	PlanSQLRecordInsert      = "INSERT INTO %s (migration_id, name, type, applied_at, checksum, execution_time, batch, out_of_order) VALUES ('%s', '%s', '%s', CURRENT_TIMESTAMP, '%s', 0, %d, %s)"
+	PlanGoMigrationStatement = "-- Go migration: runs the registered %s function"
+	PlanFixtureStatement     = "-- Fixture: %d row(s) into %s"
+	PlanSQLRecordDelete      = "DELETE FROM %s WHERE migration_id = '%s'"
 )
 
 // Connection info format
@@ -133,6 +308,122 @@ const (
 	PasswordInfoFormat   = "   Password:  %s\n"
 )
 
+// Schema diff constants
+const (
+	DiffMigrationHeader = `-- Migration: %s
+-- Type: DDL
+-- Generated by 'elsa migration diff' from %s on %s
+`
+	DiffWarningComment   = "-- WARNING: %s\n"
+	DiffDryRunUpHeader   = "-- %s.up.sql\n"
+	DiffDryRunDownHeader = "\n-- %s.down.sql\n"
+
+	ErrDiffOnlyDDL        = "schema diff generates ddl migrations only, got: %s"
+	ErrDiffUnresolved     = "%d schema difference(s) cannot be generated and need a hand-written migration, see the warnings above"
+	ErrNoModelsFound      = "no GORM models found in %s, models are structs with gorm tags, an embedded gorm.Model or a TableName method"
+	InfoDiffCompared      = MagnifyingGlassEmoji + " Compared %d model table(s) with %d database table(s)\n"
+	InfoWarningSchemaDiff = WarningEmoji + " Warning: %s\n"
+	SuccessSchemaUpToDate = SuccessEmoji + " Database schema matches the models, no migration needed\n"
+)
+
+// Migration source and bundle constants
+const (
+	// Source schemes of --source: a folder, a tar (optionally gzipped) bundle or a zip bundle
+	SourceSchemeFile = "file://"
+	SourceSchemeTar  = "tar://"
+	SourceSchemeZip  = "zip://"
+
+	// BundleManifestFile lists the migrations of a bundle with their checksums, at the root of the bundle
+	BundleManifestFile = "manifest.json"
+	DefaultBundleFile  = "migrations.tar.gz"
+	BundleFormatTarGz  = "tar.gz"
+	BundleFormatTar    = "tar"
+	BundleFormatZip    = "zip"
+	BundleFilePerm     = 0644
+
+	ErrInvalidSource             = "invalid migration source %s, expected file://<dir>, tar://<bundle.tar.gz> or zip://<bundle.zip>"
+	ErrFailedReadBundle          = "failed to read migration bundle %s: %v"
+	ErrFailedWriteBundle         = "failed to write migration bundle: %v"
+	ErrInvalidBundleFormat       = "invalid bundle format %s, name the bundle .tar.gz, .tgz, .tar or .zip"
+	ErrBundleNoManifest          = "migration bundle has no " + BundleManifestFile + ", create it with 'elsa migration bundle'"
+	ErrInvalidBundleManifest     = "invalid bundle manifest: %v"
+	ErrBundleFileMissing         = "bundle file %s listed in the manifest is missing"
+	ErrBundleFileModified        = "bundle file %s does not match the manifest checksum"
+	ErrBundleMigrationNotListed  = "bundle migration %s is not listed in the manifest"
+	ErrBundleMigrationNotBundled = "manifest migration %s is missing from the bundle"
+	ErrSourceGoMigration         = "go migration %s cannot run from a bundle, register it in the application that runs the migrations"
+	SuccessBundled               = PackageEmoji + " Bundled %d DDL and %d DML migration(s) into %s\n"
+	InfoUsingSource              = PackageEmoji + " Using migrations from %s\n"
+	SourceFlagUsage              = "Read migrations from file://<dir>, tar://<bundle.tar.gz> or zip://<bundle.zip> instead of the migration folder"
+)
+
+// Migration hook constants
+const (
+	// Hook points of migration.hooks.<type> in .elsa-config.yaml
+	HookBeforeUp   = "before_up"
+	HookAfterUp    = "after_up"
+	HookBeforeEach = "before_each"
+	HookAfterEach  = "after_each"
+
+	// Environment variables a command hook receives, only those that apply to its hook point are set
+	HookEnvPoint      = "ELSA_HOOK"
+	HookEnvType       = "ELSA_MIGRATION_TYPE"
+	HookEnvID         = "ELSA_MIGRATION_ID"
+	HookEnvName       = "ELSA_MIGRATION_NAME"
+	HookEnvDirection  = "ELSA_MIGRATION_DIRECTION"
+	HookEnvBatch      = "ELSA_MIGRATION_BATCH"
+	HookEnvCount      = "ELSA_MIGRATION_COUNT"
+	HookEnvDurationMS = "ELSA_MIGRATION_DURATION_MS"
+
+	ErrHookFailed          = "%s %s hook %s failed: %v"
+	ErrMigrationHookFailed = "%s %s hook %s failed for %s_%s: %v"
+	ErrInvalidHook         = "invalid %s %s hook in %s: set exactly one of sql or command"
+	ErrFailedReadHookFile  = "failed to read hook file: %v"
+	ErrInvalidHookType     = "invalid hooks in %s: migration type must be 'ddl' or 'dml', got: %s"
+	InfoRunningHook        = HookEmoji + " Running %s hook: %s\n"
+)
+
+// Statement limit constants
+const (
+	StatementTimeoutFlagUsage = "Cancel a migration statement that runs longer than this, e.g. 30s (0 for no limit)"
+	LockTimeoutFlagUsage      = "Make a migration statement give up waiting for a lock after this, e.g. 5s (0 for the database default)"
+	RetriesFlagUsage          = "Retry a migration that lost a lock conflict this many times, waiting longer before every retry"
+	InfoRetryingMigration     = RestartEmoji + " %s_%s is blocked by a lock, retry %d in %s\n"
+)
+
+// Batched migration progress constants
+const (
+	// BatchBarWidth is the number of cells of the progress bar drawn on a terminal
+	BatchBarWidth  = 30
+	BatchBarFilled = "█"
+	BatchBarEmpty  = "░"
+
+	// BatchProgressStep is how many percent apart progress lines are printed when the output is not a terminal
+	BatchProgressStep = 10
+
+	InfoBatchResumed      = RestartEmoji + " Resuming %s_%s from its checkpoint, %d of %d rows done\n"
+	InfoBatchProgressBar  = "\r   " + TimerEmoji + " [%s] %3d%% %d/%d rows"
+	InfoBatchProgressLine = "   " + TimerEmoji + " %s_%s: %d%% (%d/%d rows)\n"
+)
+
+// Migration lock constants
+const (
+	UnlockConnectionFlagUsage = "Database connection string"
+	SuccessMigrationUnlocked  = SuccessEmoji + " Released the migration lock held by %s\n"
+	InfoNoMigrationLock       = InfoEmoji + " No migration lock is held\n"
+	InfoInterrupted           = StopEmoji + " %s received, cancelling the run and releasing the migration lock\n"
+)
+
+// Migration stub template constants
+const (
+	// MigrationStubTemplate names the project template for a migration type and direction,
+	// resolved like make templates: .stub/migration/ddl.up.sql.tmpl first, then the cached template repository
+	MigrationStubTemplate = "migration/%s.%s.sql.tmpl"
+
+	ErrFailedRenderMigrationStub = "failed to render migration template: %v"
+	InfoUsingMigrationStub       = "📄 Using project template for %s migration files\n"
+)
+
 // Migration file content templates
 const (
 	// DDL migration templates
@@ -193,6 +484,10 @@ const (
 	StatusTableSeparator       = "   ----------------------------------------\n"
 	StatusPending              = ErrorEmoji + " Pending"
 	StatusApplied              = SuccessEmoji + " Applied"
+	StatusModified             = WarningEmoji + " Modified after apply"
+	StatusBatchSuffix          = " (batch %d)"
+	StatusOutOfOrderSuffix     = " " + WarningEmoji + " out of order"
+	StatusSkipped              = SkipEmoji + "  Skipped (%s)"
 	InfoOverviewHeader         = ClipboardEmoji + " Migration Information Overview\n"
 	InfoOverviewSeparator      = "==================================================\n"
 	InfoDDLHeader              = WrenchEmoji + " %s Migrations Information:\n"
@@ -10,8 +10,12 @@ const (
 
 	// Help text
 	HelpText = `Flags:
-  -h, --help      help for elsa
-  -v, --version   version for elsa`
+      --env string   environment profile, loads .env.<env> over .env (same as ELSA_ENV)
+  -h, --help         help for elsa
+  -v, --version      version for elsa`
+
+	// EnvFlagUsage describes the global --env flag
+	EnvFlagUsage = "Environment profile, loads .env.<env> and .env.<env>.local over .env (same as ELSA_ENV)"
 
 	// Usage text
 	UsageText = `Usage:
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+// AuditRecord is one migration run against a protected database
+type AuditRecord struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement"`
+	Command    string     `gorm:"not null"`
+	Operator   string     `gorm:"not null"`
+	Forced     bool       `gorm:"not null"`
+	Status     string     `gorm:"not null"`
+	Error      string     `gorm:"type:text"`
+	StartedAt  time.Time  `gorm:"not null"`
+	FinishedAt *time.Time `gorm:""`
+}
+
+// auditTable returns the name of the audit table that belongs to the migration history table
+func (me *MigrationExecutor) auditTable() string {
+	return me.table + constants.AuditTableSuffix
+}
+
+// StartAudit records that a run against a protected database has started
+func (me *MigrationExecutor) StartAudit(command string, forced bool) (*AuditRecord, error) {
+	if err := me.db.Exec(fmt.Sprintf(me.createAuditTableSQL(), me.auditTable())).Error; err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedWriteAudit, err)
+	}
+
+	record := &AuditRecord{
+		Command:   command,
+		Operator:  auditOperator(),
+		Forced:    forced,
+		Status:    constants.AuditStatusRunning,
+		StartedAt: time.Now(),
+	}
+	if !me.Dialect().GeneratesIDs() {
+		// FinishAudit finds the run by its id, so it is numbered before it is written
+		record.ID = uint(record.StartedAt.UnixNano())
+	}
+	if err := me.db.Table(me.auditTable()).Create(record).Error; err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedWriteAudit, err)
+	}
+
+	return record, nil
+}
+
+// FinishAudit stores the outcome of an audited run
+func (me *MigrationExecutor) FinishAudit(record *AuditRecord, runErr error) error {
+	finishedAt := time.Now()
+	updates := map[string]interface{}{
+		"status":      constants.AuditStatusSucceeded,
+		"finished_at": finishedAt,
+	}
+	if runErr != nil {
+		updates["status"] = constants.AuditStatusFailed
+		updates["error"] = runErr.Error()
+	}
+
+	if err := me.db.Table(me.auditTable()).Where("id = ?", record.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf(constants.ErrFailedWriteAudit, err)
+	}
+	return nil
+}
+
+// createAuditTableSQL returns the audit table definition for the connected driver
+func (me *MigrationExecutor) createAuditTableSQL() string {
+	return me.Dialect().CreateAuditTableSQL()
+}
+
+// auditOperator identifies who started the run as user@host
+func auditOperator() string {
+	name := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s", name, hostname)
+}
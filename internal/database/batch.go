@@ -0,0 +1,304 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+	"gorm.io/gorm"
+)
+
+// batchTablePattern finds the table an UPDATE or DELETE statement works on, past the comments of the file header
+var batchTablePattern = regexp.MustCompile(`(?is)^(?:\s*--[^\n]*\n)*\s*(?:UPDATE|DELETE\s+FROM)\s+([^\s(]+)`)
+
+// batchKeyTypes are the column types a batch key can have, the checkpoint stores the last key as an integer
+var batchKeyTypes = map[string]bool{
+	"int": true, "integer": true, "bigint": true, "smallint": true, "tinyint": true, "mediumint": true,
+	"int2": true, "int4": true, "int8": true, "serial": true, "bigserial": true, "smallserial": true,
+	"int16": true, "int32": true, "int64": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+}
+
+// identifierQuotes strips the quoting of a table name taken from the statement
+var identifierQuotes = strings.NewReplacer(`"`, "", "`", "", "[", "", "]", "")
+
+// BatchConfig is how a batched migration walks its table: Size rows at a time in Key order,
+// pausing Sleep between ranges so other queries get the locks in between
+type BatchConfig struct {
+	Size  int
+	Key   string
+	Table string
+	Sleep time.Duration
+}
+
+// BatchProgress reports how far a batched migration got; Resumed is set when it started from a checkpoint
+type BatchProgress struct {
+	Done     int64
+	Total    int64
+	Resumed  bool
+	Finished bool
+}
+
+// CheckpointRecord is the last key range a batched migration committed
+type CheckpointRecord struct {
+	MigrationFile string    `gorm:"primaryKey"`
+	Checksum      string    `gorm:"not null"`
+	LastKey       int64     `gorm:"not null"`
+	RowsDone      int64     `gorm:"not null"`
+	UpdatedAt     time.Time `gorm:"not null"`
+}
+
+// ParseBatchDirective reads the `-- elsa:batch` directive of a migration file, nil when the file is not batched
+func ParseBatchDirective(content string) (*BatchConfig, error) {
+	value, exists := ParseDirectives(content)[constants.DirectiveBatch]
+	if !exists {
+		return nil, nil
+	}
+
+	config := &BatchConfig{Size: constants.DefaultBatchSize, Key: constants.DefaultBatchKey}
+	for _, option := range strings.Fields(value) {
+		name, setting, ok := strings.Cut(option, "=")
+		if !ok || setting == "" {
+			return nil, fmt.Errorf(constants.ErrInvalidBatchOption, option)
+		}
+
+		switch strings.ToLower(name) {
+		case constants.BatchOptionSize:
+			size, err := strconv.Atoi(setting)
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf(constants.ErrInvalidBatchSize, setting)
+			}
+			config.Size = size
+		case constants.BatchOptionKey:
+			config.Key = setting
+		case constants.BatchOptionTable:
+			config.Table = setting
+		case constants.BatchOptionSleep:
+			sleep, err := time.ParseDuration(setting)
+			if err != nil {
+				return nil, fmt.Errorf(constants.ErrInvalidBatchSleep, setting, err)
+			}
+			config.Sleep = sleep
+		default:
+			return nil, fmt.Errorf(constants.ErrInvalidBatchOption, option)
+		}
+	}
+
+	return config, nil
+}
+
+// checkpointTable returns the name of the checkpoint table that belongs to the migration history table
+func (me *MigrationExecutor) checkpointTable() string {
+	return me.table + constants.CheckpointTableSuffix
+}
+
+// checkpointFile identifies a migration file in the checkpoint table
+func checkpointFile(script MigrationScript) string {
+	if script.Path != "" {
+		return script.Path
+	}
+	return script.Type + "/" + script.ID
+}
+
+// executeBatched runs the single statement of a batched migration once per key range of config.Size rows.
+// Every range commits together with its checkpoint, so an interrupted run resumes after the last committed range
+// instead of starting over. A checkpoint of an edited file is discarded.
+func (me *MigrationExecutor) executeBatched(script MigrationScript, config *BatchConfig) error {
+	file := checkpointFile(script)
+
+	var statements []string
+	for _, statement := range me.Dialect().SplitStatements(script.Content) {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	if len(statements) != 1 {
+		return fmt.Errorf(constants.ErrBatchStatementCount, file, len(statements))
+	}
+	statement := statements[0]
+	if !strings.Contains(statement, constants.BatchPlaceholder) {
+		return fmt.Errorf(constants.ErrBatchNoPlaceholder, file, constants.BatchPlaceholder)
+	}
+
+	table := config.Table
+	if table == "" {
+		match := batchTablePattern.FindStringSubmatch(statement)
+		if match == nil {
+			return fmt.Errorf(constants.ErrBatchNoTable, file)
+		}
+		table = match[1]
+	}
+	if err := me.checkBatchKey(file, table, config.Key); err != nil {
+		return err
+	}
+
+	if err := me.db.Exec(fmt.Sprintf(me.Dialect().CreateCheckpointTableSQL(), me.checkpointTable())).Error; err != nil {
+		return fmt.Errorf(constants.ErrFailedSaveCheckpoint, err)
+	}
+
+	checksum := GetMigrationChecksum(script.Content)
+	checkpoint, err := me.loadCheckpoint(file, script.Content)
+	if err != nil {
+		return err
+	}
+
+	key := me.Dialect().QuoteIdentifier(config.Key)
+	location := fmt.Sprintf(constants.StatementLocationInFile, 1, file)
+
+	// remaining scopes table to the keys after the checkpoint
+	remaining := func() *gorm.DB {
+		query := me.db.Table(table)
+		if checkpoint != nil {
+			query = query.Where(key+" > ?", checkpoint.LastKey)
+		}
+		return query
+	}
+
+	progress := BatchProgress{Resumed: checkpoint != nil}
+	if checkpoint != nil {
+		progress.Done = checkpoint.RowsDone
+	}
+	var pending int64
+	if err := remaining().Count(&pending).Error; err != nil {
+		return fmt.Errorf(constants.ErrFailedReadBatchRange, table, err)
+	}
+	progress.Total = progress.Done + pending
+	me.reportBatch(progress)
+	progress.Resumed = false
+
+	for {
+		var lastKey *int64
+		var rows int64
+		keys := remaining().Select(key).Order(key).Limit(config.Size)
+		if err := me.db.Table("(?) AS elsa_batch", keys).Select("MAX("+key+"), COUNT(*)").Row().Scan(&lastKey, &rows); err != nil {
+			return fmt.Errorf(constants.ErrFailedReadBatchRange, table, err)
+		}
+		if rows == 0 || lastKey == nil {
+			break
+		}
+
+		condition, args := "("+key+" <= ?)", []any{*lastKey}
+		if checkpoint != nil {
+			condition, args = "("+key+" > ? AND "+key+" <= ?)", []any{checkpoint.LastKey, *lastKey}
+		}
+		chunk := strings.ReplaceAll(statement, constants.BatchPlaceholder, condition)
+		chunkLocation := fmt.Sprintf(constants.BatchRangeLocation, location, config.Key, *lastKey)
+
+		next := CheckpointRecord{
+			MigrationFile: file,
+			Checksum:      checksum,
+			LastKey:       *lastKey,
+			RowsDone:      progress.Done + rows,
+			UpdatedAt:     time.Now(),
+		}
+		err := me.retryLocked(func() error {
+			return me.db.Transaction(func(tx *gorm.DB) error {
+				executor := me.withDB(tx)
+				if err := executor.execStatement(chunkLocation, chunk, args...); err != nil {
+					return err
+				}
+				return executor.saveCheckpoint(next, checkpoint != nil)
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		checkpoint = &next
+		progress.Done = next.RowsDone
+		progress.Total = max(progress.Total, progress.Done)
+		me.reportBatch(progress)
+
+		if rows < int64(config.Size) {
+			break
+		}
+		time.Sleep(config.Sleep)
+	}
+
+	progress.Finished = true
+	progress.Total = progress.Done
+	me.reportBatch(progress)
+	return nil
+}
+
+// checkBatchKey refuses a key column that is not an integer before any range runs,
+// UUID, text and composite keys cannot be ranged and checkpointed in key order
+func (me *MigrationExecutor) checkBatchKey(file, table, key string) error {
+	columns, err := me.db.Migrator().ColumnTypes(identifierQuotes.Replace(table))
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedReadBatchRange, table, err)
+	}
+
+	for _, column := range columns {
+		if !strings.EqualFold(column.Name(), key) {
+			continue
+		}
+		columnType, _, _ := strings.Cut(strings.ToLower(column.DatabaseTypeName()), "(")
+		columnType = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(columnType), "unsigned"))
+		if !batchKeyTypes[columnType] {
+			return fmt.Errorf(constants.ErrBatchKeyType, file, key, table, column.DatabaseTypeName())
+		}
+		return nil
+	}
+	return fmt.Errorf(constants.ErrBatchKeyMissing, file, table, key)
+}
+
+// loadCheckpoint returns where an interrupted run of a batched migration stopped, nil to start from the beginning
+func (me *MigrationExecutor) loadCheckpoint(file, content string) (*CheckpointRecord, error) {
+	var checkpoints []CheckpointRecord
+	if err := me.db.Table(me.checkpointTable()).Where("migration_file = ?", file).Find(&checkpoints).Error; err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedSaveCheckpoint, err)
+	}
+	if len(checkpoints) == 0 {
+		return nil, nil
+	}
+
+	if !ChecksumMatches(checkpoints[0].Checksum, content) {
+		return nil, me.clearCheckpoint(file)
+	}
+	return &checkpoints[0], nil
+}
+
+// saveCheckpoint records the last committed key range of a batched migration
+func (me *MigrationExecutor) saveCheckpoint(checkpoint CheckpointRecord, exists bool) error {
+	var err error
+	if exists {
+		err = me.db.Table(me.checkpointTable()).Where("migration_file = ?", checkpoint.MigrationFile).Updates(map[string]interface{}{
+			"last_key":   checkpoint.LastKey,
+			"rows_done":  checkpoint.RowsDone,
+			"checksum":   checkpoint.Checksum,
+			"updated_at": checkpoint.UpdatedAt,
+		}).Error
+	} else {
+		err = me.db.Table(me.checkpointTable()).Create(&checkpoint).Error
+	}
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedSaveCheckpoint, err)
+	}
+	return nil
+}
+
+// finishBatched drops the checkpoint of a batched migration once the migration history is updated
+func (me *MigrationExecutor) finishBatched(script MigrationScript) error {
+	if script.Func != nil || script.Statements != nil || !HasDirective(script.Content, constants.DirectiveBatch) {
+		return nil
+	}
+	return me.clearCheckpoint(checkpointFile(script))
+}
+
+// clearCheckpoint forgets the progress of a batched migration once it is recorded, or when its file changed
+func (me *MigrationExecutor) clearCheckpoint(file string) error {
+	if err := me.db.Table(me.checkpointTable()).Where("migration_file = ?", file).Delete(&CheckpointRecord{}).Error; err != nil {
+		return fmt.Errorf(constants.ErrFailedSaveCheckpoint, err)
+	}
+	return nil
+}
+
+// reportBatch passes the progress of a batched migration to the observer, if any
+func (me *MigrationExecutor) reportBatch(progress BatchProgress) {
+	if me.onBatch != nil {
+		me.onBatch(progress)
+	}
+}
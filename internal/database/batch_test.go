@@ -0,0 +1,65 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+func TestBatchedMigrationKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		key    string
+		err    string
+	}{
+		{name: "integer key", schema: "CREATE TABLE items (id INTEGER PRIMARY KEY, done INTEGER)", key: "id"},
+		{name: "bigint key", schema: "CREATE TABLE items (seq BIGINT, done INTEGER)", key: "seq"},
+		{name: "uuid key", schema: "CREATE TABLE items (id UUID PRIMARY KEY, done INTEGER)", key: "id", err: "is UUID"},
+		{name: "text key", schema: "CREATE TABLE items (code TEXT PRIMARY KEY, done INTEGER)", key: "code", err: "is TEXT"},
+		{name: "missing key", schema: "CREATE TABLE items (code TEXT, other TEXT, done INTEGER, PRIMARY KEY (code, other))", key: "id", err: "has no column id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newSQLiteExecutor(t)
+			if err := executor.DB().Exec(tt.schema).Error; err != nil {
+				t.Fatalf("creating items: %v", err)
+			}
+			if err := executor.DB().Exec("INSERT INTO items (" + tt.key + ", done) VALUES (1, 0), (2, 0), (3, 0)").Error; err != nil && tt.err == "" {
+				t.Fatalf("seeding items: %v", err)
+			}
+
+			script := MigrationScript{
+				ID:      "20240101000000",
+				Name:    "backfill",
+				Type:    constants.MigrationTypeDML,
+				Content: "-- elsa:batch size=2 key=" + tt.key + "\nUPDATE items SET done = 1 WHERE {{batch}};\n",
+				Batch:   1,
+				Path:    "dml/20240101000000_backfill.up.sql",
+			}
+			_, err := executor.ApplyMigration(script)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ApplyMigration error = %v, want one containing %q", err, tt.err)
+				}
+				if tableExists(t, executor, constants.MigrationsTableName+constants.CheckpointTableSuffix) {
+					t.Error("checkpoint table created for a rejected key")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyMigration: %v", err)
+			}
+
+			var pending int64
+			if err := executor.DB().Table("items").Where("done = 0").Count(&pending).Error; err != nil {
+				t.Fatalf("counting items: %v", err)
+			}
+			if pending != 0 {
+				t.Errorf("%d items left unprocessed", pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+var (
+	// sqlTypeArgsPattern matches the size, precision or scale of a column type, e.g. (255) or (10, 2)
+	sqlTypeArgsPattern = regexp.MustCompile(`\(([^)]*)\)`)
+	// sqlFunctionDefaultPattern matches defaults that are expressions rather than literals, e.g. CURRENT_TIMESTAMP or now()
+	sqlFunctionDefaultPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\(.*\))?$`)
+)
+
+// sqlTypeAliases maps the spellings of a column type across drivers and catalogs to one name
+var sqlTypeAliases = map[string]string{
+	"bool":                        "boolean",
+	"int2":                        "smallint",
+	"smallserial":                 "smallint",
+	"int":                         "integer",
+	"int4":                        "integer",
+	"serial":                      "integer",
+	"int8":                        "bigint",
+	"bigserial":                   "bigint",
+	"float4":                      "real",
+	"float8":                      "double precision",
+	"double":                      "double precision",
+	"numeric":                     "decimal",
+	"character varying":           "varchar",
+	"character":                   "char",
+	"timestamp with time zone":    "timestamptz",
+	"timestamp without time zone": "timestamp",
+	"time without time zone":      "time",
+}
+
+// sizedSQLTypes keep their size when compared, the precision of time types is ignored
+var sizedSQLTypes = map[string]bool{
+	"varchar": true, "char": true, "decimal": true, "varbinary": true, "binary": true, "nvarchar": true, "nchar": true,
+}
+
+// serialTypes are the Postgres types of auto-increment columns by integer type
+var serialTypes = map[string]string{"smallint": "smallserial", "integer": "serial", "bigint": "bigserial"}
+
+// SchemaDiff is a migration that turns the current schema into the one described by the models
+type SchemaDiff struct {
+	Up       []string
+	Down     []string
+	Warnings []string
+}
+
+// schemaChange is one step of a diff with the statements that undo it
+type schemaChange struct {
+	up   []string
+	down []string
+}
+
+// schemaDiffer renders the statements of a diff for one driver
+type schemaDiffer struct {
+	driver   string
+	dialect  Dialect
+	changes  []schemaChange
+	warnings []string
+}
+
+// DiffSchemas compares the tables described by the models with the current tables and returns the statements
+// that create, alter and drop tables, columns and indexes. Tables without a model are only dropped with dropTables,
+// as the models of a project are often spread over packages that were not loaded.
+func DiffSchemas(driver string, desired, current []TableSchema, dropTables bool) (*SchemaDiff, error) {
+	switch driver {
+	case constants.DriverSQLite, constants.DriverMySQL, constants.DriverPostgres:
+	default:
+		return nil, fmt.Errorf(constants.ErrDiffUnsupportedDriver, driver)
+	}
+
+	dialect, err := LookupDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &schemaDiffer{driver: driver, dialect: dialect}
+	currentTables := make(map[string]TableSchema)
+	for _, table := range current {
+		currentTables[table.Name] = table
+	}
+	desiredTables := make(map[string]bool)
+
+	for _, table := range desired {
+		desiredTables[table.Name] = true
+		existing, exists := currentTables[table.Name]
+		if !exists {
+			d.add(d.createTable(table), []string{d.dropTable(table.Name)})
+			continue
+		}
+		d.diffTable(table, existing)
+	}
+
+	if dropTables {
+		for _, table := range current {
+			if !desiredTables[table.Name] {
+				// The table comes back empty on rollback, its rows are gone
+				d.add([]string{d.dropTable(table.Name)}, d.createTable(table))
+			}
+		}
+	}
+
+	diff := &SchemaDiff{Warnings: d.warnings}
+	for i, change := range d.changes {
+		diff.Up = append(diff.Up, change.up...)
+		diff.Down = append(diff.Down, d.changes[len(d.changes)-1-i].down...)
+	}
+	return diff, nil
+}
+
+// add records a change and the statements that undo it
+func (d *schemaDiffer) add(up, down []string) {
+	if len(up) > 0 {
+		d.changes = append(d.changes, schemaChange{up: up, down: down})
+	}
+}
+
+// diffTable compares an existing table with its model. Indexes are dropped before their columns,
+// as SQLite refuses to drop an indexed column, and created after the columns they cover.
+func (d *schemaDiffer) diffTable(desired, existing TableSchema) {
+	desiredColumns := make(map[string]ColumnSchema)
+	for _, column := range desired.Columns {
+		desiredColumns[column.Name] = column
+	}
+	existingColumns := make(map[string]ColumnSchema)
+	for _, column := range existing.Columns {
+		existingColumns[column.Name] = column
+	}
+
+	if desiredKey, existingKey := primaryKeyColumns(desired), primaryKeyColumns(existing); desiredKey != existingKey && existingKey != "" {
+		d.warnings = append(d.warnings, fmt.Sprintf(constants.DiffWarningPrimaryKey, desired.Name, existingKey, desiredKey))
+	}
+
+	desiredIndexes := make(map[string]bool)
+	for _, index := range desired.Indexes {
+		desiredIndexes[indexKey(index)] = true
+	}
+	existingIndexes := make(map[string]bool)
+	for _, index := range existing.Indexes {
+		existingIndexes[indexKey(index)] = true
+	}
+
+	for _, index := range existing.Indexes {
+		if !desiredIndexes[indexKey(index)] {
+			d.add(d.dropIndex(existing.Name, index), []string{d.createIndex(existing.Name, index)})
+		}
+	}
+
+	for _, column := range desired.Columns {
+		current, exists := existingColumns[column.Name]
+		if !exists {
+			d.add([]string{d.addColumn(desired.Name, column)}, []string{d.dropColumn(desired.Name, column.Name)})
+			continue
+		}
+		d.add(d.alterColumn(desired.Name, current, column), d.alterColumn(desired.Name, column, current))
+	}
+
+	for _, index := range desired.Indexes {
+		if !existingIndexes[indexKey(index)] {
+			d.add([]string{d.createIndex(desired.Name, index)}, d.dropIndex(desired.Name, index))
+		}
+	}
+
+	for _, column := range existing.Columns {
+		if _, exists := desiredColumns[column.Name]; !exists {
+			d.add([]string{d.dropColumn(existing.Name, column.Name)}, []string{d.addColumn(existing.Name, column)})
+		}
+	}
+}
+
+// createTable renders a table with its indexes; a single primary key is declared on its column
+func (d *schemaDiffer) createTable(table TableSchema) []string {
+	var keys []string
+	for _, column := range table.Columns {
+		if column.PrimaryKey {
+			keys = append(keys, d.quote(column.Name))
+		}
+	}
+
+	var definitions []string
+	for _, column := range table.Columns {
+		definitions = append(definitions, d.columnDefinition(column, column.PrimaryKey && len(keys) == 1))
+	}
+	if len(keys) > 1 {
+		definitions = append(definitions, fmt.Sprintf(constants.DiffPrimaryKeyFormat, strings.Join(keys, ", ")))
+	}
+
+	statements := []string{fmt.Sprintf(constants.DiffCreateTableFormat, d.quote(table.Name), strings.Join(definitions, ",\n    "))}
+	for _, index := range table.Indexes {
+		if d.driver == constants.DriverSQLite && index.Constraint {
+			// sqlite_autoindex names are reserved, the recreated index needs a name of its own
+			index.Name = modelNamer.UniqueName(table.Name, strings.Join(index.Columns, "_"))
+		}
+		statements = append(statements, d.createIndex(table.Name, index))
+	}
+	return statements
+}
+
+func (d *schemaDiffer) dropTable(table string) string {
+	return fmt.Sprintf(constants.DiffDropTableFormat, d.quote(table))
+}
+
+func (d *schemaDiffer) addColumn(table string, column ColumnSchema) string {
+	return fmt.Sprintf(constants.DiffAddColumnFormat, d.quote(table), d.columnDefinition(column, false))
+}
+
+func (d *schemaDiffer) dropColumn(table, column string) string {
+	return fmt.Sprintf(constants.DiffDropColumnFormat, d.quote(table), d.quote(column))
+}
+
+// alterColumn renders the statements that change a column from one definition to another,
+// nothing when they only differ in how the database spells them
+func (d *schemaDiffer) alterColumn(table string, from, to ColumnSchema) []string {
+	typeChanged := normalizeSQLType(from.Type) != normalizeSQLType(to.Type)
+	// Primary keys are never null and auto-increment columns take their values from a sequence
+	nullChanged := !from.PrimaryKey && !to.PrimaryKey && from.Nullable != to.Nullable
+	defaultChanged := !from.AutoIncrement && !to.AutoIncrement &&
+		(from.HasDefault != to.HasDefault || normalizeDefault(from.Default) != normalizeDefault(to.Default))
+	if !typeChanged && !nullChanged && !defaultChanged {
+		return nil
+	}
+
+	quotedTable, quotedColumn := d.quote(table), d.quote(to.Name)
+	switch d.driver {
+	case constants.DriverMySQL:
+		return []string{fmt.Sprintf(constants.DiffModifyColumnFormat, quotedTable, d.columnDefinition(to, false))}
+	case constants.DriverPostgres:
+		var statements []string
+		if typeChanged {
+			statements = append(statements, fmt.Sprintf(constants.DiffAlterColumnFormat, quotedTable, quotedColumn, "TYPE "+to.Type))
+		}
+		if nullChanged && to.Nullable {
+			statements = append(statements, fmt.Sprintf(constants.DiffAlterColumnFormat, quotedTable, quotedColumn, "DROP NOT NULL"))
+		} else if nullChanged {
+			statements = append(statements, fmt.Sprintf(constants.DiffAlterColumnFormat, quotedTable, quotedColumn, "SET NOT NULL"))
+		}
+		if defaultChanged && to.HasDefault {
+			statements = append(statements, fmt.Sprintf(constants.DiffAlterColumnFormat, quotedTable, quotedColumn, "SET DEFAULT "+d.defaultLiteral(to)))
+		} else if defaultChanged {
+			statements = append(statements, fmt.Sprintf(constants.DiffAlterColumnFormat, quotedTable, quotedColumn, "DROP DEFAULT"))
+		}
+		return statements
+	default:
+		// Both directions of a change end up here, warn only once
+		d.warnOnce(fmt.Sprintf(constants.DiffWarningSQLiteAlter, table, to.Name))
+		return nil
+	}
+}
+
+func (d *schemaDiffer) createIndex(table string, index IndexSchema) string {
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	columns := make([]string, len(index.Columns))
+	for i, column := range index.Columns {
+		columns[i] = d.quote(column)
+	}
+	return fmt.Sprintf(constants.DiffCreateIndexFormat, unique, d.quote(index.Name), d.quote(table), strings.Join(columns, ", "))
+}
+
+func (d *schemaDiffer) dropIndex(table string, index IndexSchema) []string {
+	switch {
+	case d.driver == constants.DriverMySQL:
+		return []string{fmt.Sprintf(constants.DiffMySQLDropIndexFormat, d.quote(index.Name), d.quote(table))}
+	case d.driver == constants.DriverPostgres && index.Constraint:
+		return []string{fmt.Sprintf(constants.DiffDropConstraintFormat, d.quote(table), d.quote(index.Name))}
+	case d.driver == constants.DriverSQLite && index.Constraint:
+		d.warnOnce(fmt.Sprintf(constants.DiffWarningSQLiteConstraint, index.Name, table))
+		return nil
+	default:
+		return []string{fmt.Sprintf(constants.DiffDropIndexFormat, d.quote(index.Name))}
+	}
+}
+
+// columnDefinition renders a column as it appears in CREATE TABLE and ADD COLUMN
+func (d *schemaDiffer) columnDefinition(column ColumnSchema, primaryKey bool) string {
+	sqlType := column.Type
+	if column.AutoIncrement && d.driver == constants.DriverPostgres {
+		if serial, ok := serialTypes[normalizeSQLType(sqlType)]; ok {
+			sqlType = serial
+		}
+	}
+
+	definition := d.quote(column.Name) + " " + sqlType
+	switch {
+	case primaryKey && d.driver == constants.DriverSQLite && column.AutoIncrement:
+		definition += " PRIMARY KEY AUTOINCREMENT"
+	case primaryKey:
+		if column.AutoIncrement && d.driver == constants.DriverMySQL {
+			definition += " AUTO_INCREMENT"
+		}
+		definition += " PRIMARY KEY"
+	case column.AutoIncrement && d.driver == constants.DriverMySQL:
+		definition += " AUTO_INCREMENT"
+	}
+
+	if !column.Nullable && !primaryKey {
+		definition += " NOT NULL"
+	}
+	if column.HasDefault {
+		definition += " DEFAULT " + d.defaultLiteral(column)
+	}
+	return definition
+}
+
+// defaultLiteral quotes the default of text and time columns unless it is an expression
+func (d *schemaDiffer) defaultLiteral(column ColumnSchema) string {
+	sqlType := normalizeSQLType(column.Type)
+	switch {
+	case isTextType(sqlType) && !strings.Contains(column.Default, "("):
+		return d.dialect.StringLiteral(column.Default)
+	case isTimeType(sqlType) && !sqlFunctionDefaultPattern.MatchString(column.Default):
+		return d.dialect.StringLiteral(column.Default)
+	default:
+		return column.Default
+	}
+}
+
+func (d *schemaDiffer) quote(name string) string {
+	return d.dialect.QuoteIdentifier(name)
+}
+
+func (d *schemaDiffer) warnOnce(warning string) {
+	for _, existing := range d.warnings {
+		if existing == warning {
+			return
+		}
+	}
+	d.warnings = append(d.warnings, warning)
+}
+
+// normalizeSQLType reduces a column type to one spelling, so varchar(255) equals character varying(255)
+// and tinyint(1) equals boolean. Display widths and time precision are ignored.
+func normalizeSQLType(sqlType string) string {
+	sqlType = strings.ToLower(strings.TrimSpace(sqlType))
+
+	args := ""
+	if match := sqlTypeArgsPattern.FindStringSubmatch(sqlType); match != nil {
+		args = strings.ReplaceAll(match[1], " ", "")
+	}
+
+	var words []string
+	for _, word := range strings.Fields(sqlTypeArgsPattern.ReplaceAllString(sqlType, " ")) {
+		if word != "unsigned" && word != "zerofill" {
+			words = append(words, word)
+		}
+	}
+	base := strings.Join(words, " ")
+
+	if base == "tinyint" && args == "1" {
+		return "boolean"
+	}
+	if alias, ok := sqlTypeAliases[base]; ok {
+		base = alias
+	}
+	if sizedSQLTypes[base] && args != "" {
+		return base + "(" + args + ")"
+	}
+	return base
+}
+
+// normalizeDefault reduces a default to one spelling, so 'a' equals a, (0) equals 0 and false equals 0
+func normalizeDefault(value string) string {
+	value = unquoteDefault(value)
+	for len(value) >= 2 && value[0] == '(' && value[len(value)-1] == ')' {
+		value = unquoteDefault(value[1 : len(value)-1])
+	}
+
+	switch lower := strings.ToLower(value); lower {
+	case "false":
+		return "0"
+	case "true":
+		return "1"
+	default:
+		if sqlFunctionDefaultPattern.MatchString(value) {
+			return lower
+		}
+		return value
+	}
+}
+
+func isTextType(sqlType string) bool {
+	return strings.Contains(sqlType, "char") || strings.Contains(sqlType, "text") || strings.Contains(sqlType, "clob")
+}
+
+func isTimeType(sqlType string) bool {
+	return strings.Contains(sqlType, "date") || strings.Contains(sqlType, "time")
+}
+
+// primaryKeyColumns renders the primary key of a table as a comma-separated list of its columns
+func primaryKeyColumns(table TableSchema) string {
+	var keys []string
+	for _, column := range table.Columns {
+		if column.PrimaryKey {
+			keys = append(keys, column.Name)
+		}
+	}
+	return strings.Join(keys, ", ")
+}
+
+// indexKey identifies an index by what it covers, so a renamed index in the models is not dropped and recreated
+func indexKey(index IndexSchema) string {
+	columns := append([]string(nil), index.Columns...)
+	if !index.Unique {
+		// A plain index on (a, b) serves the same queries whatever it is called, but not when reordered
+		return "index:" + strings.Join(columns, ",")
+	}
+	sort.Strings(columns)
+	return "unique:" + strings.Join(columns, ",")
+}
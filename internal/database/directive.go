@@ -0,0 +1,82 @@
+package database
+
+import (
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+// ParseDirectives reads the `-- elsa:<name> [value]` directives from the header of a migration file.
+// Only the leading comment block is inspected, so a directive cannot be hidden in the middle of a script.
+// Go migrations declare the same directives as `// elsa:<name> [value]` above their package clause.
+func ParseDirectives(content string) map[string]string {
+	directives := make(map[string]string)
+
+	lines := strings.Split(content, "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		// Skip blank lines between header comments
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "//") {
+			if !strings.HasPrefix(line, constants.GoDirectivePrefix) {
+				continue
+			}
+			line = constants.DirectivePrefix + strings.TrimPrefix(line, constants.GoDirectivePrefix)
+		}
+
+		// Stop at the first statement line
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		if !strings.HasPrefix(line, constants.DirectivePrefix) {
+			continue
+		}
+
+		// Split directive name from its optional value
+		directive := strings.TrimSpace(strings.TrimPrefix(line, constants.DirectivePrefix))
+		parts := strings.SplitN(directive, " ", 2)
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+
+		value := ""
+		if len(parts) == 2 {
+			value = strings.TrimSpace(parts[1])
+		}
+		directives[name] = value
+	}
+
+	return directives
+}
+
+// DirectiveList splits the comma separated value of a directive, nil when the directive is not declared
+func DirectiveList(content, name string) []string {
+	value, exists := ParseDirectives(content)[name]
+	if !exists {
+		return nil
+	}
+	return splitList(value)
+}
+
+// splitList splits a comma separated list, dropping blanks
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// HasDirective reports whether the migration header declares the given directive
+func HasDirective(content, name string) bool {
+	_, exists := ParseDirectives(content)[name]
+	return exists
+}
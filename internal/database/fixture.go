@@ -0,0 +1,335 @@
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// fixtureExtensions maps the extension of a fixture migration to its format
+var fixtureExtensions = []struct {
+	extension string
+	format    string
+}{
+	{constants.FixtureYAMLExtension, constants.FixtureFormatYAML},
+	{constants.FixtureYMLExtension, constants.FixtureFormatYAML},
+	{constants.FixtureJSONExtension, constants.FixtureFormatJSON},
+	{constants.FixtureCSVExtension, constants.FixtureFormatCSV},
+}
+
+// FixtureExtension returns the fixture extension a file name ends with, or "" when it is not a fixture
+func FixtureExtension(fileName string) string {
+	for _, fixture := range fixtureExtensions {
+		if strings.HasSuffix(fileName, fixture.extension) {
+			return fixture.extension
+		}
+	}
+	return ""
+}
+
+// FixtureFormat returns the format of a fixture file from its extension
+func FixtureFormat(fileName string) string {
+	for _, fixture := range fixtureExtensions {
+		if strings.HasSuffix(fileName, fixture.extension) {
+			return fixture.format
+		}
+	}
+	return ""
+}
+
+// Fixture is seed data for one table, read from a .up.yaml, .up.json or .up.csv migration file.
+// The primary key identifies the rows again when the migration is rolled back.
+type Fixture struct {
+	Table      string                   `yaml:"table" json:"table"`
+	PrimaryKey fixtureList              `yaml:"primary_key" json:"primary_key"`
+	Rows       []map[string]interface{} `yaml:"rows" json:"rows"`
+
+	// Env and Tags restrict the fixture like the env and tags directives of SQL files
+	Env  fixtureList `yaml:"env" json:"env"`
+	Tags fixtureList `yaml:"tags" json:"tags"`
+
+	// columns is the column order of CSV files; YAML and JSON rows are rendered key columns first, the rest sorted
+	columns []string
+}
+
+// fixtureList accepts a single value or a list of them, e.g. one primary key column or several
+type fixtureList []string
+
+func (k *fixtureList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*k = fixtureList{node.Value}
+		return nil
+	}
+	var columns []string
+	if err := node.Decode(&columns); err != nil {
+		return err
+	}
+	*k = columns
+	return nil
+}
+
+func (k *fixtureList) UnmarshalJSON(data []byte) error {
+	var column string
+	if err := json.Unmarshal(data, &column); err == nil {
+		*k = fixtureList{column}
+		return nil
+	}
+	var columns []string
+	if err := json.Unmarshal(data, &columns); err != nil {
+		return err
+	}
+	*k = columns
+	return nil
+}
+
+// ParseFixture reads a fixture in one of the FixtureFormat formats and checks that every row carries its primary key
+func ParseFixture(content []byte, format string) (*Fixture, error) {
+	var fixture Fixture
+	var err error
+
+	switch format {
+	case constants.FixtureFormatYAML:
+		err = yaml.Unmarshal(content, &fixture)
+	case constants.FixtureFormatJSON:
+		// Numbers stay as written, a float64 would round large IDs
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&fixture)
+	case constants.FixtureFormatCSV:
+		err = parseCSVFixture(content, &fixture)
+	default:
+		return nil, fmt.Errorf(constants.ErrUnsupportedFixtureFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedParseFixture, err)
+	}
+
+	if fixture.Table == "" {
+		return nil, fmt.Errorf(constants.ErrFixtureNoTable)
+	}
+	if len(fixture.PrimaryKey) == 0 {
+		return nil, fmt.Errorf(constants.ErrFixtureNoPrimaryKey, fixture.Table)
+	}
+	if len(fixture.Rows) == 0 {
+		return nil, fmt.Errorf(constants.ErrFixtureNoRows, fixture.Table)
+	}
+	for i, row := range fixture.Rows {
+		for _, column := range fixture.PrimaryKey {
+			if value, exists := row[column]; !exists || value == nil {
+				return nil, fmt.Errorf(constants.ErrFixtureRowNoKey, fixture.Table, i+1, column)
+			}
+		}
+	}
+
+	return &fixture, nil
+}
+
+// parseCSVFixture reads `# table: <name>`, `# primary_key: <a>,<b>` and the optional `# env:` and `# tags:`
+// header comments, then a header row naming the columns and one row per record. Empty cells are inserted as NULL.
+func parseCSVFixture(content []byte, fixture *Fixture) error {
+	lines := strings.Split(string(content), "\n")
+	start := 0
+	for ; start < len(lines); start++ {
+		line := strings.TrimSpace(lines[start])
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, constants.FixtureCSVCommentPrefix) {
+			break
+		}
+
+		key, value, found := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, constants.FixtureCSVCommentPrefix)), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case constants.FixtureTableKey:
+			fixture.Table = value
+		case constants.FixturePrimaryKeyKey:
+			fixture.PrimaryKey = splitList(value)
+		case constants.FixtureEnvKey:
+			fixture.Env = splitList(value)
+		case constants.FixtureTagsKey:
+			fixture.Tags = splitList(value)
+		}
+	}
+
+	reader := csv.NewReader(strings.NewReader(strings.Join(lines[start:], "\n")))
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	fixture.columns = header
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		row := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			if record[i] == "" {
+				row[column] = nil
+			} else {
+				row[column] = record[i]
+			}
+		}
+		fixture.Rows = append(fixture.Rows, row)
+	}
+}
+
+// FixtureStatements renders a fixture as the statements of one direction: multi-row INSERTs going up,
+// DELETEs by primary key going down. Consecutive rows with the same columns share an INSERT of up to
+// FixtureBatchSize rows; columns a row leaves out keep their database default.
+func (me *MigrationExecutor) FixtureStatements(fixture *Fixture, direction string) []string {
+	dialect := me.Dialect()
+	table := dialect.QuoteIdentifier(fixture.Table)
+
+	if direction == constants.DirectionDown {
+		return fixtureDeleteStatements(dialect, table, fixture)
+	}
+
+	var statements []string
+	var columns []string
+	var values []string
+	flush := func() {
+		if len(values) == 0 {
+			return
+		}
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = dialect.QuoteIdentifier(column)
+		}
+		statements = append(statements, fmt.Sprintf(constants.FixtureInsertFormat,
+			table, strings.Join(quoted, ", "), strings.Join(values, ",\n    ")))
+		values = nil
+	}
+
+	for _, row := range fixture.Rows {
+		rowColumns := fixture.rowColumns(row)
+		if strings.Join(rowColumns, "\x00") != strings.Join(columns, "\x00") || len(values) == constants.FixtureBatchSize {
+			flush()
+			columns = rowColumns
+		}
+
+		literals := make([]string, len(columns))
+		for i, column := range columns {
+			literals[i] = fixtureLiteral(dialect, row[column])
+		}
+		values = append(values, "("+strings.Join(literals, ", ")+")")
+	}
+	flush()
+
+	return statements
+}
+
+// fixtureDeleteStatements deletes the rows of a fixture by primary key, newest batch first
+func fixtureDeleteStatements(dialect Dialect, table string, fixture *Fixture) []string {
+	var statements []string
+	for start := 0; start < len(fixture.Rows); start += constants.FixtureBatchSize {
+		end := start + constants.FixtureBatchSize
+		if end > len(fixture.Rows) {
+			end = len(fixture.Rows)
+		}
+
+		var condition string
+		if len(fixture.PrimaryKey) == 1 {
+			column := fixture.PrimaryKey[0]
+			keys := make([]string, 0, end-start)
+			for _, row := range fixture.Rows[start:end] {
+				keys = append(keys, fixtureLiteral(dialect, row[column]))
+			}
+			condition = fmt.Sprintf(constants.FixtureKeyInFormat, dialect.QuoteIdentifier(column), strings.Join(keys, ", "))
+		} else {
+			matches := make([]string, 0, end-start)
+			for _, row := range fixture.Rows[start:end] {
+				parts := make([]string, len(fixture.PrimaryKey))
+				for i, column := range fixture.PrimaryKey {
+					parts[i] = dialect.QuoteIdentifier(column) + " = " + fixtureLiteral(dialect, row[column])
+				}
+				matches = append(matches, "("+strings.Join(parts, " AND ")+")")
+			}
+			condition = strings.Join(matches, "\n    OR ")
+		}
+
+		statements = append([]string{fmt.Sprintf(constants.FixtureDeleteFormat, table, condition)}, statements...)
+	}
+	return statements
+}
+
+// rowColumns returns the columns a row sets, in file order for CSV and key columns first otherwise
+func (f *Fixture) rowColumns(row map[string]interface{}) []string {
+	if f.columns != nil {
+		return f.columns
+	}
+
+	columns := append([]string(nil), f.PrimaryKey...)
+	var rest []string
+	for column := range row {
+		if !containsColumn(f.PrimaryKey, column) {
+			rest = append(rest, column)
+		}
+	}
+	sort.Strings(rest)
+	return append(columns, rest...)
+}
+
+// fixtureLiteral renders a fixture value as a SQL literal of the dialect.
+// Lists and maps, e.g. for JSON columns, are inserted as their JSON text.
+func fixtureLiteral(dialect Dialect, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return dialect.BoolLiteral(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case string:
+		return dialect.StringLiteral(v)
+	case time.Time:
+		return dialect.StringLiteral(v.Format(constants.FixtureTimestampFormat))
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return dialect.StringLiteral(fmt.Sprint(v))
+		}
+		return dialect.StringLiteral(string(encoded))
+	}
+}
+
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
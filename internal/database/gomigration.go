@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+// GoMigrationRequest is sent by the CLI to the generated runner that executes Go migrations
+type GoMigrationRequest struct {
+	Connection string          `json:"connection"`
+	Table      string          `json:"table"`
+	Direction  string          `json:"direction"`
+	Script     MigrationScript `json:"script"`
+	// Limits are the statement timeout, lock timeout and retries of the run that started the runner
+	Limits ExecLimits `json:"limits"`
+}
+
+// GoMigrationResult is reported back by the runner once the migration has been executed
+type GoMigrationResult struct {
+	ExecutionTime int64 `json:"execution_time"`
+}
+
+// RunGoMigrationRequest connects to the requested database and applies or rolls back
+// the script with the given function, recording the result in the migrations table
+func RunGoMigrationRequest(request GoMigrationRequest, fn func(tx *sql.Tx) error) (GoMigrationResult, error) {
+	if fn == nil {
+		return GoMigrationResult{}, fmt.Errorf(constants.ErrGoMigrationMissingFunc, request.Script.ID, request.Direction)
+	}
+
+	config := ParseConnectionString(request.Connection)
+	if config == nil {
+		return GoMigrationResult{}, fmt.Errorf(constants.ErrInvalidConnectionString, request.Connection)
+	}
+
+	db, err := Connect(config)
+	if err != nil {
+		return GoMigrationResult{}, err
+	}
+
+	executor := NewMigrationExecutor(db).WithConfig(config).WithTable(request.Table).WithLimits(request.Limits)
+	script := request.Script
+	script.Func = fn
+
+	var executionTime int64
+	if request.Direction == constants.DirectionDown {
+		executionTime, err = executor.RollbackMigration(script)
+	} else {
+		executionTime, err = executor.ApplyMigration(script)
+	}
+	if err != nil {
+		return GoMigrationResult{}, err
+	}
+
+	return GoMigrationResult{ExecutionTime: executionTime}, nil
+}
+
+// IsGoMigrationFile reports whether a file name looks like a Go migration (<id>_<name>.go)
+func IsGoMigrationFile(fileName string) bool {
+	if !strings.HasSuffix(fileName, constants.GoMigrationExtension) || strings.HasSuffix(fileName, constants.GoTestFileSuffix) {
+		return false
+	}
+
+	parts := strings.Split(strings.TrimSuffix(fileName, constants.GoMigrationExtension), "_")
+	if len(parts) < 2 {
+		return false
+	}
+	_, err := strconv.Atoi(parts[0])
+	return err == nil
+}
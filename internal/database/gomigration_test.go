@@ -0,0 +1,57 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+func TestGoMigrationStatementTimeout(t *testing.T) {
+	executor := newSQLiteExecutor(t).WithLimits(ExecLimits{StatementTimeout: 50 * time.Millisecond})
+
+	script := MigrationScript{
+		ID:      "20240101000000",
+		Name:    "slow",
+		Type:    constants.MigrationTypeDML,
+		Content: "package migrations",
+		Func: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE notes (id INTEGER PRIMARY KEY)"); err != nil {
+				return err
+			}
+			time.Sleep(200 * time.Millisecond)
+			_, err := tx.Exec("INSERT INTO notes (id) VALUES (1)")
+			return err
+		},
+	}
+	_, err := executor.ApplyMigration(script)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Fatalf("ApplyMigration error = %v, want a timeout", err)
+	}
+	if tableExists(t, executor, "notes") {
+		t.Error("notes table exists after the Go migration timed out")
+	}
+}
+
+func TestGoMigrationRequestLimits(t *testing.T) {
+	request := GoMigrationRequest{
+		Connection: "sqlite://app.db",
+		Direction:  constants.DirectionUp,
+		Limits:     ExecLimits{StatementTimeout: time.Minute, LockTimeout: 5 * time.Second, Retries: 3},
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var decoded GoMigrationRequest
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if decoded.Limits != request.Limits {
+		t.Errorf("Limits = %+v after the round trip, want %+v", decoded.Limits, request.Limits)
+	}
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"fmt"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+// HookConfig is one hook under migration.hooks.<type>.<point> in .elsa-config.yaml,
+// either a SQL file run on the migrated database or a shell command
+type HookConfig struct {
+	SQL     string `yaml:"sql"`
+	Command string `yaml:"command"`
+}
+
+// HookSet lists the hooks of one migration type per hook point, each run in order
+type HookSet struct {
+	BeforeUp   []HookConfig `yaml:"before_up"`
+	AfterUp    []HookConfig `yaml:"after_up"`
+	BeforeEach []HookConfig `yaml:"before_each"`
+	AfterEach  []HookConfig `yaml:"after_each"`
+}
+
+// Points returns the hooks of the set keyed by hook point
+func (hs HookSet) Points() map[string][]HookConfig {
+	return map[string][]HookConfig{
+		constants.HookBeforeUp:   hs.BeforeUp,
+		constants.HookAfterUp:    hs.AfterUp,
+		constants.HookBeforeEach: hs.BeforeEach,
+		constants.HookAfterEach:  hs.AfterEach,
+	}
+}
+
+// LoadHooks returns the hooks declared under migration.hooks in .elsa-config.yaml, keyed by migration type
+func LoadHooks() (map[string]HookSet, error) {
+	config, err := loadElsaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	for migrationType, set := range config.Migration.Hooks {
+		if migrationType != constants.MigrationTypeDDL && migrationType != constants.MigrationTypeDML {
+			return nil, fmt.Errorf(constants.ErrInvalidHookType, constants.ElsaConfigFile, migrationType)
+		}
+
+		for point, hooks := range set.Points() {
+			for _, hook := range hooks {
+				if (hook.SQL == "") == (hook.Command == "") {
+					return nil, fmt.Errorf(constants.ErrInvalidHook, migrationType, point, constants.ElsaConfigFile)
+				}
+			}
+		}
+	}
+
+	return config.Migration.Hooks, nil
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+// TableSchema is the definition of one table, read from the database or from Go models
+type TableSchema struct {
+	Name    string
+	Columns []ColumnSchema
+	Indexes []IndexSchema
+}
+
+// ColumnSchema is one column of a TableSchema
+type ColumnSchema struct {
+	Name          string
+	Type          string // SQL type as declared, e.g. varchar(255)
+	Nullable      bool
+	HasDefault    bool
+	Default       string // default expression, string literals without their quotes
+	PrimaryKey    bool
+	AutoIncrement bool
+}
+
+// IndexSchema is one secondary index of a TableSchema
+type IndexSchema struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	// Constraint marks indexes that back a UNIQUE constraint and are dropped with it
+	Constraint bool
+}
+
+// indexColumnRow is one column of an index, as read from the catalog of the database
+type indexColumnRow struct {
+	Name         string `gorm:"column:name"`
+	IsUnique     bool   `gorm:"column:is_unique"`
+	IsConstraint bool   `gorm:"column:is_constraint"`
+	ColumnName   string `gorm:"column:column_name"`
+}
+
+// sqliteIndexRow is one index of a table, as listed by PRAGMA index_list
+type sqliteIndexRow struct {
+	Name     string `gorm:"column:name"`
+	IsUnique bool   `gorm:"column:is_unique"`
+	Origin   string `gorm:"column:origin"`
+}
+
+// IntrospectSchema reads the tables, columns and secondary indexes of the connected database.
+// Elsa's own tables are left out, like in schema dumps.
+func (me *MigrationExecutor) IntrospectSchema() ([]TableSchema, error) {
+	switch me.Driver() {
+	case constants.DriverSQLite, constants.DriverMySQL, constants.DriverPostgres:
+	default:
+		return nil, fmt.Errorf(constants.ErrDiffUnsupportedDriver, me.Driver())
+	}
+
+	names, err := me.db.Migrator().GetTables()
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedIntrospectSchema, err)
+	}
+	sort.Strings(names)
+
+	var tables []TableSchema
+	for _, name := range names {
+		if me.isElsaTable(name) || strings.HasPrefix(name, constants.SQLiteInternalTablePrefix) {
+			continue
+		}
+
+		table, err := me.introspectTable(name)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ErrFailedIntrospectSchema, err)
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+// introspectTable reads the columns of a table through the gorm migrator and its indexes from the catalog
+func (me *MigrationExecutor) introspectTable(name string) (TableSchema, error) {
+	table := TableSchema{Name: name}
+
+	columnTypes, err := me.db.Migrator().ColumnTypes(name)
+	if err != nil {
+		return table, err
+	}
+	for _, columnType := range columnTypes {
+		column := ColumnSchema{Name: columnType.Name(), Nullable: true}
+		if sqlType, ok := columnType.ColumnType(); ok && sqlType != "" {
+			column.Type = sqlType
+		} else {
+			column.Type = columnType.DatabaseTypeName()
+		}
+		if nullable, ok := columnType.Nullable(); ok {
+			column.Nullable = nullable
+		}
+		if value, ok := columnType.DefaultValue(); ok {
+			column.HasDefault = true
+			column.Default = unquoteDefault(value)
+		}
+		column.PrimaryKey, _ = columnType.PrimaryKey()
+		column.AutoIncrement, _ = columnType.AutoIncrement()
+		table.Columns = append(table.Columns, column)
+	}
+
+	if me.Driver() == constants.DriverSQLite {
+		// The gorm SQLite driver parses the CREATE TABLE statement and misses composite primary keys
+		var keys []string
+		if err := me.db.Raw(constants.SQLitePrimaryKeyColumnsSQL, name).Scan(&keys).Error; err != nil {
+			return table, err
+		}
+		primaryKey := make(map[string]bool)
+		for _, key := range keys {
+			primaryKey[key] = true
+		}
+		for i := range table.Columns {
+			table.Columns[i].PrimaryKey = primaryKey[table.Columns[i].Name]
+		}
+		table.Indexes, err = me.introspectSQLiteIndexes(name)
+	} else {
+		table.Indexes, err = me.introspectCatalogIndexes(name)
+	}
+	return table, err
+}
+
+// introspectCatalogIndexes reads the secondary indexes of a MySQL or Postgres table, one row per index column
+func (me *MigrationExecutor) introspectCatalogIndexes(table string) ([]IndexSchema, error) {
+	query := constants.MySQLTableIndexesSQL
+	if me.Driver() == constants.DriverPostgres {
+		query = constants.PostgresTableIndexesSQL
+	}
+
+	var rows []indexColumnRow
+	if err := me.db.Raw(query, table).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var indexes []IndexSchema
+	for _, row := range rows {
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != row.Name {
+			indexes = append(indexes, IndexSchema{Name: row.Name, Unique: row.IsUnique, Constraint: row.IsConstraint})
+		}
+		last := &indexes[len(indexes)-1]
+		last.Columns = append(last.Columns, row.ColumnName)
+	}
+	return indexes, nil
+}
+
+// introspectSQLiteIndexes reads the indexes of a SQLite table; the one of the primary key is left out
+func (me *MigrationExecutor) introspectSQLiteIndexes(table string) ([]IndexSchema, error) {
+	var rows []sqliteIndexRow
+	if err := me.db.Raw(constants.SQLiteIndexListSQL, table).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var indexes []IndexSchema
+	for _, row := range rows {
+		if row.Origin == constants.SQLitePrimaryKeyIndexOrigin {
+			continue
+		}
+
+		index := IndexSchema{Name: row.Name, Unique: row.IsUnique, Constraint: row.Origin == constants.SQLiteUniqueIndexOrigin}
+		if err := me.db.Raw(constants.SQLiteIndexColumnsSQL, row.Name).Scan(&index.Columns).Error; err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes, nil
+}
+
+// unquoteDefault strips the quotes of a string literal default, so defaults compare by value
+func unquoteDefault(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
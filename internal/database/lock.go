@@ -0,0 +1,312 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"go.risoftinc.com/elsa/constants"
+	"gorm.io/gorm"
+)
+
+// MigrationLock is a database-wide lock that serializes concurrent migration runs
+type MigrationLock struct {
+	release func() error
+}
+
+// Release frees the migration lock so other runs can proceed
+func (l *MigrationLock) Release() error {
+	if l == nil || l.release == nil {
+		return nil
+	}
+	return l.release()
+}
+
+// AcquireLock takes the migration lock, waiting up to timeout for another run to finish.
+// PostgreSQL uses a session advisory lock, MySQL uses GET_LOCK, SQL Server uses sp_getapplock
+// and SQLite uses a row in a lock table.
+func (me *MigrationExecutor) AcquireLock(timeout time.Duration) (*MigrationLock, error) {
+	return me.Dialect().AcquireLock(me, timeout)
+}
+
+// acquirePostgresLock polls pg_try_advisory_lock on a dedicated connection, since advisory locks belong to a session
+func (me *MigrationExecutor) acquirePostgresLock(timeout time.Duration) (*MigrationLock, error) {
+	conn, err := me.dedicatedConn()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(context.Background(), constants.PostgresTryLockSQL, constants.MigrationLockKey).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf(constants.ErrFailedAcquireLock, err)
+		}
+
+		if acquired {
+			return &MigrationLock{release: func() error {
+				defer conn.Close()
+				if _, err := conn.ExecContext(context.Background(), constants.PostgresUnlockSQL, constants.MigrationLockKey); err != nil {
+					return fmt.Errorf(constants.ErrFailedReleaseLock, err)
+				}
+				return nil
+			}}, nil
+		}
+
+		if time.Now().After(deadline) {
+			conn.Close()
+			return nil, fmt.Errorf(constants.ErrMigrationInProgress, timeout)
+		}
+		time.Sleep(constants.LockPollInterval)
+	}
+}
+
+// acquireMySQLLock uses GET_LOCK, which already waits server-side for the given number of seconds
+func (me *MigrationExecutor) acquireMySQLLock(timeout time.Duration) (*MigrationLock, error) {
+	conn, err := me.dedicatedConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(context.Background(), constants.MySQLGetLockSQL, constants.MigrationLockName, lockWaitSeconds(timeout)).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf(constants.ErrFailedAcquireLock, err)
+	}
+
+	if !acquired.Valid || acquired.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf(constants.ErrMigrationInProgress, timeout)
+	}
+
+	return &MigrationLock{release: func() error {
+		defer conn.Close()
+		if _, err := conn.ExecContext(context.Background(), constants.MySQLReleaseLockSQL, constants.MigrationLockName); err != nil {
+			return fmt.Errorf(constants.ErrFailedReleaseLock, err)
+		}
+		return nil
+	}}, nil
+}
+
+// lockWaitSeconds rounds a lock wait up to the whole seconds GET_LOCK takes, so a wait under a second still waits
+func lockWaitSeconds(timeout time.Duration) int {
+	return int(math.Ceil(timeout.Seconds()))
+}
+
+// acquireSQLServerLock uses a session-owned sp_getapplock, which like GET_LOCK waits server-side
+func (me *MigrationExecutor) acquireSQLServerLock(timeout time.Duration) (*MigrationLock, error) {
+	conn, err := me.dedicatedConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var result int
+	if err := conn.QueryRowContext(context.Background(), constants.SQLServerGetLockSQL, constants.MigrationLockName, timeout.Milliseconds()).Scan(&result); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf(constants.ErrFailedAcquireLock, err)
+	}
+
+	if result < 0 {
+		conn.Close()
+		return nil, fmt.Errorf(constants.ErrMigrationInProgress, timeout)
+	}
+
+	return &MigrationLock{release: func() error {
+		defer conn.Close()
+		if _, err := conn.ExecContext(context.Background(), constants.SQLServerReleaseLockSQL, constants.MigrationLockName); err != nil {
+			return fmt.Errorf(constants.ErrFailedReleaseLock, err)
+		}
+		return nil
+	}}, nil
+}
+
+// lockTable returns the name of the lock table that belongs to the migration history table
+func (me *MigrationExecutor) lockTable() string {
+	return me.table + constants.LockTableSuffix
+}
+
+// acquireTableLock inserts the single lock row; the primary key makes a concurrent insert fail.
+// The holder refreshes the heartbeat of the row while it runs, and a row left behind by a run
+// that died is taken over: at once when its process on this host has exited, otherwise once
+// its heartbeat is older than LockStaleAfter.
+func (me *MigrationExecutor) acquireTableLock(timeout time.Duration) (*MigrationLock, error) {
+	// The row outlives a cancelled run, so it is taken and released regardless of the context of the run
+	db := me.db.WithContext(context.Background())
+	lockTable := me.lockTable()
+	if err := me.ensureLockTable(db); err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedAcquireLock, err)
+	}
+
+	holder := lockHolder()
+	deadline := time.Now().Add(timeout)
+	for {
+		now := time.Now()
+		err := db.Exec(fmt.Sprintf(constants.SQLiteInsertLockSQL, lockTable), now, now, holder).Error
+		if err == nil {
+			break
+		}
+
+		current, found := me.currentTableLock(db)
+		if found && current.stale() {
+			// Deleting by holder leaves the row alone if another run took it over first
+			if err := db.Exec(fmt.Sprintf(constants.SQLiteDeleteLockSQL, lockTable), current.holder).Error; err == nil {
+				continue
+			}
+		}
+
+		// A cancelled run, e.g. on SIGINT, stops waiting
+		if err := me.db.Statement.Context.Err(); err != nil {
+			return nil, fmt.Errorf(constants.ErrFailedAcquireLock, err)
+		}
+		if time.Now().After(deadline) {
+			if !found {
+				return nil, fmt.Errorf(constants.ErrFailedAcquireLock, err)
+			}
+			return nil, fmt.Errorf(constants.ErrMigrationInProgressTable, current.holder, current.lockedAt.Format(time.RFC3339), timeout)
+		}
+		time.Sleep(constants.LockPollInterval)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(constants.LockHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// A missed heartbeat, e.g. while a migration holds the write lock of the file, is retried on the next tick
+				db.Exec(fmt.Sprintf(constants.SQLiteHeartbeatLockSQL, lockTable), time.Now(), holder)
+			}
+		}
+	}()
+
+	return &MigrationLock{release: func() error {
+		close(stop)
+		<-stopped
+		if err := db.Exec(fmt.Sprintf(constants.SQLiteDeleteLockSQL, lockTable), holder).Error; err != nil {
+			return fmt.Errorf(constants.ErrFailedReleaseLock, err)
+		}
+		return nil
+	}}, nil
+}
+
+// ensureLockTable creates the lock table, adding the heartbeat column to tables created by older versions
+func (me *MigrationExecutor) ensureLockTable(db *gorm.DB) error {
+	lockTable := me.lockTable()
+	if err := db.Exec(fmt.Sprintf(constants.SQLiteCreateLockTableSQL, lockTable)).Error; err != nil {
+		return err
+	}
+	if !db.Migrator().HasColumn(lockTable, constants.LockHeartbeatColumn) {
+		return db.Exec(fmt.Sprintf(constants.SQLiteAddLockHeartbeatSQL, lockTable)).Error
+	}
+	return nil
+}
+
+// ForceUnlock removes the lock row of a run that can no longer release it and returns its holder,
+// empty when no lock was held. Databases with session locks release them on their own.
+func (me *MigrationExecutor) ForceUnlock() (string, error) {
+	return me.Dialect().ForceUnlock(me)
+}
+
+// forceTableUnlock deletes the lock row whoever holds it
+func (me *MigrationExecutor) forceTableUnlock() (string, error) {
+	db := me.db.WithContext(context.Background())
+	if !db.Migrator().HasTable(me.lockTable()) {
+		return "", nil
+	}
+
+	current, found := me.currentTableLock(db)
+	if !found {
+		return "", nil
+	}
+	if err := db.Exec(fmt.Sprintf(constants.SQLiteDeleteLockSQL, me.lockTable()), current.holder).Error; err != nil {
+		return "", fmt.Errorf(constants.ErrFailedReleaseLock, err)
+	}
+	return current.holder, nil
+}
+
+// tableLock is the row of the lock table; rows written by older versions have no heartbeat
+type tableLock struct {
+	holder    string
+	lockedAt  time.Time
+	heartbeat time.Time
+}
+
+// currentTableLock reads the lock row, found is false when there is none or it cannot be read
+func (me *MigrationExecutor) currentTableLock(db *gorm.DB) (tableLock, bool) {
+	var holder string
+	var lockedAt, heartbeat any
+	row := db.Raw(fmt.Sprintf(constants.SQLiteSelectLockSQL, me.lockTable())).Row()
+	if err := row.Scan(&holder, &lockedAt, &heartbeat); err != nil {
+		return tableLock{}, false
+	}
+
+	lock := tableLock{holder: holder, lockedAt: parseLockTime(lockedAt), heartbeat: parseLockTime(heartbeat)}
+	if lock.heartbeat.IsZero() {
+		lock.heartbeat = lock.lockedAt
+	}
+	return lock, true
+}
+
+// stale reports whether the run holding the lock is gone: its process on this host has exited,
+// or it runs elsewhere and has not refreshed its heartbeat for LockStaleAfter
+func (l tableLock) stale() bool {
+	hostname, _ := os.Hostname()
+	if host, pid, ok := strings.Cut(l.holder, ":"); ok && host == hostname {
+		if pid, err := strconv.Atoi(pid); err == nil {
+			return !processAlive(pid)
+		}
+	}
+
+	// A heartbeat that cannot be read is never treated as stale
+	return !l.heartbeat.IsZero() && time.Since(l.heartbeat) > constants.LockStaleAfter
+}
+
+// parseLockTime reads a lock table timestamp, which libSQL servers return as text
+func parseLockTime(value any) time.Time {
+	switch value := value.(type) {
+	case time.Time:
+		return value
+	case []byte:
+		return parseLockTime(string(value))
+	case string:
+		for _, layout := range append([]string{time.RFC3339Nano}, sqlite3.SQLiteTimestampFormats...) {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				return parsed
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// dedicatedConn reserves a single pooled connection for session-scoped locks
+func (me *MigrationExecutor) dedicatedConn() (*sql.Conn, error) {
+	sqlDB, err := me.db.DB()
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedGetDB, err)
+	}
+
+	conn, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedAcquireLock, err)
+	}
+
+	return conn, nil
+}
+
+// lockHolder identifies the current process in the lock table
+func lockHolder() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
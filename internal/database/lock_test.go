@@ -0,0 +1,157 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+func TestTableLock(t *testing.T) {
+	executor := newSQLiteExecutor(t)
+
+	lock, err := executor.AcquireLock(time.Second)
+	if err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+
+	if _, err := executor.AcquireLock(100 * time.Millisecond); err == nil {
+		t.Fatal("second AcquireLock succeeded while the lock was held")
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	lock, err = executor.AcquireLock(time.Second)
+	if err != nil {
+		t.Fatalf("AcquireLock after release: %v", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+}
+
+func TestStaleTableLock(t *testing.T) {
+	hostname, _ := os.Hostname()
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		holder    string
+		heartbeat time.Time
+		stale     bool
+	}{
+		{name: "exited process on this host", holder: fmt.Sprintf("%s:%d", hostname, deadPID(t)), heartbeat: now, stale: true},
+		{name: "running process on this host", holder: fmt.Sprintf("%s:%d", hostname, os.Getpid()), heartbeat: now.Add(-time.Hour), stale: false},
+		{name: "fresh heartbeat from another host", holder: "elsewhere:42", heartbeat: now, stale: false},
+		{name: "old heartbeat from another host", holder: "elsewhere:42", heartbeat: now.Add(-2 * constants.LockStaleAfter), stale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newSQLiteExecutor(t)
+			db := executor.DB()
+			if err := executor.ensureLockTable(db); err != nil {
+				t.Fatalf("ensureLockTable: %v", err)
+			}
+			insert := fmt.Sprintf(constants.SQLiteInsertLockSQL, executor.lockTable())
+			if err := db.Exec(insert, tt.heartbeat, tt.heartbeat, tt.holder).Error; err != nil {
+				t.Fatalf("inserting lock row: %v", err)
+			}
+
+			lock, err := executor.AcquireLock(200 * time.Millisecond)
+			if tt.stale && err != nil {
+				t.Fatalf("AcquireLock did not take over the stale lock: %v", err)
+			}
+			if !tt.stale && err == nil {
+				t.Fatal("AcquireLock took over a live lock")
+			}
+			if err := lock.Release(); err != nil {
+				t.Fatalf("Release: %v", err)
+			}
+		})
+	}
+}
+
+func TestLockTableUpgrade(t *testing.T) {
+	executor := newSQLiteExecutor(t)
+
+	// Lock tables of older versions have no heartbeat column
+	db := executor.DB()
+	if err := db.Exec(fmt.Sprintf("CREATE TABLE %s (id INTEGER PRIMARY KEY, locked_at DATETIME NOT NULL, holder TEXT NOT NULL)", executor.lockTable())).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := executor.AcquireLock(time.Second)
+	if err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	defer lock.Release()
+
+	if !db.Migrator().HasColumn(executor.lockTable(), constants.LockHeartbeatColumn) {
+		t.Error("lock table was not upgraded with the heartbeat column")
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	executor := newSQLiteExecutor(t)
+
+	holder, err := executor.ForceUnlock()
+	if err != nil || holder != "" {
+		t.Fatalf("ForceUnlock() without a lock = %q, %v", holder, err)
+	}
+
+	if _, err := executor.AcquireLock(time.Second); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+
+	holder, err = executor.ForceUnlock()
+	if err != nil {
+		t.Fatalf("ForceUnlock: %v", err)
+	}
+	if holder != lockHolder() {
+		t.Errorf("ForceUnlock() = %q, want %q", holder, lockHolder())
+	}
+
+	lock, err := executor.AcquireLock(100 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("AcquireLock after ForceUnlock: %v", err)
+	}
+	lock.Release()
+}
+
+// deadPID returns the ID of a process that has exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+
+	process, err := os.StartProcess(os.Args[0], []string{os.Args[0], "-test.run=^$"}, &os.ProcAttr{})
+	if err != nil {
+		t.Fatalf("starting a process: %v", err)
+	}
+	if _, err := process.Wait(); err != nil {
+		t.Fatalf("waiting for the process: %v", err)
+	}
+	return process.Pid
+}
+
+func TestLockWaitSeconds(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    int
+	}{
+		{timeout: 0, want: 0},
+		{timeout: 500 * time.Millisecond, want: 1},
+		{timeout: time.Second, want: 1},
+		{timeout: 1500 * time.Millisecond, want: 2},
+		{timeout: constants.DefaultLockWait, want: int(constants.DefaultLockWait / time.Second)},
+	}
+
+	for _, tt := range tests {
+		if got := lockWaitSeconds(tt.timeout); got != tt.want {
+			t.Errorf("lockWaitSeconds(%s) = %d, want %d", tt.timeout, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package database
+
+import "os"
+
+// processAlive reports whether a process of this host still runs, FindProcess fails on Windows when it does not
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
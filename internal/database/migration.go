@@ -1,7 +1,14 @@
 package database
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,6 +25,8 @@ type MigrationRecord struct {
 	AppliedAt     time.Time `gorm:"not null"`
 	Checksum      string    `gorm:"not null;"` // varchar(64) for checksum
 	ExecutionTime int64     `gorm:"not null"`  // in milliseconds
+	Batch         int       `gorm:"not null;default:0"`
+	OutOfOrder    bool      `gorm:"not null;default:false"`
 }
 
 // TableName specifies the table name for MigrationRecord
@@ -25,53 +34,175 @@ func (MigrationRecord) TableName() string {
 	return constants.MigrationsTableName
 }
 
+// MigrationScript describes a migration file that is about to be applied or rolled back.
+// Go migrations set Func and keep their source in Content so the checksum still tracks the file.
+// Batch is the `up` run the migration is recorded under and OutOfOrder marks a migration older than
+// the newest applied one; both are ignored on rollback.
+type MigrationScript struct {
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Content    string                 `json:"content"`
+	Batch      int                    `json:"batch"`
+	OutOfOrder bool                   `json:"out_of_order"`
+	Func       func(tx *sql.Tx) error `json:"-"`
+	// Statements replace the SQL of Content for migrations rendered from another format, such as fixtures.
+	// Content still holds the file so the checksum follows it.
+	Statements []string `json:"-"`
+	// Path is the file the migration was read from, named in statement errors
+	Path string `json:"path,omitempty"`
+}
+
 // MigrationExecutor handles migration execution
 type MigrationExecutor struct {
-	db *gorm.DB
+	db      *gorm.DB
+	config  *DatabaseConfig
+	table   string
+	limits  ExecLimits
+	onRetry func(attempt int, wait time.Duration, err error)
+	onBatch func(progress BatchProgress)
+	// limited marks an executor whose connection already has the lock timeout set
+	limited bool
 }
 
-// NewMigrationExecutor creates a new migration executor
+// ExecLimits bounds how migration statements run. Zero values leave the database defaults in place.
+type ExecLimits struct {
+	// StatementTimeout cancels a statement that runs longer. A Go migration cannot be bounded statement by statement,
+	// so its whole transaction gets the timeout as deadline instead.
+	StatementTimeout time.Duration `json:"statement_timeout,omitempty"`
+	// LockTimeout makes a statement give up waiting for a lock, through the session settings of the database
+	LockTimeout time.Duration `json:"lock_timeout,omitempty"`
+	// Retries is how often a migration that lost a lock conflict is retried, with a growing backoff.
+	// A migration in a transaction is retried as a whole, otherwise only the failing statement.
+	Retries int `json:"retries,omitempty"`
+}
+
+// NewMigrationExecutor creates a new migration executor that records history in the default migrations table
 func NewMigrationExecutor(db *gorm.DB) *MigrationExecutor {
-	return &MigrationExecutor{db: db}
+	return &MigrationExecutor{db: db, table: constants.MigrationsTableName}
+}
+
+// WithTable changes the table the migration history is recorded in
+func (me *MigrationExecutor) WithTable(table string) *MigrationExecutor {
+	if table != "" {
+		me.table = table
+	}
+	return me
+}
+
+// Table returns the name of the migration history table
+func (me *MigrationExecutor) Table() string {
+	return me.table
+}
+
+// withDB returns a copy of the executor that runs on db, typically a transaction
+func (me *MigrationExecutor) withDB(db *gorm.DB) *MigrationExecutor {
+	return &MigrationExecutor{db: db, config: me.config, table: me.table, limits: me.limits, onRetry: me.onRetry, onBatch: me.onBatch, limited: me.limited}
+}
+
+// WithLimits sets the statement timeout, lock timeout and retries of migration statements
+func (me *MigrationExecutor) WithLimits(limits ExecLimits) *MigrationExecutor {
+	me.limits = limits
+	return me
+}
+
+// OnRetry returns a copy of the executor that calls notify before it retries after a lock conflict
+func (me *MigrationExecutor) OnRetry(notify func(attempt int, wait time.Duration, err error)) *MigrationExecutor {
+	executor := me.withDB(me.db)
+	executor.onRetry = notify
+	return executor
+}
+
+// OnBatchProgress returns a copy of the executor that calls notify as a batched migration works through its table
+func (me *MigrationExecutor) OnBatchProgress(notify func(progress BatchProgress)) *MigrationExecutor {
+	executor := me.withDB(me.db)
+	executor.onBatch = notify
+	return executor
+}
+
+// WithContext returns a copy of the executor whose queries are cancelled with ctx
+func (me *MigrationExecutor) WithContext(ctx context.Context) *MigrationExecutor {
+	return me.withDB(me.db.WithContext(ctx))
+}
+
+// DB returns the connection the executor runs on
+func (me *MigrationExecutor) DB() *gorm.DB {
+	return me.db
+}
+
+// records scopes a query to the migration history table
+func (me *MigrationExecutor) records() *gorm.DB {
+	return me.db.Table(me.table)
+}
+
+// WithConfig attaches the connection configuration the executor was opened with
+func (me *MigrationExecutor) WithConfig(config *DatabaseConfig) *MigrationExecutor {
+	me.config = config
+	return me
+}
+
+// Config returns the connection configuration the executor was opened with, if known
+func (me *MigrationExecutor) Config() *DatabaseConfig {
+	return me.config
 }
 
 // EnsureMigrationTable ensures the migrations table exists
 func (me *MigrationExecutor) EnsureMigrationTable() error {
 	// Check if table already exists by trying to query it
 	var count int64
-	err := me.db.Table(constants.MigrationsTableName).Count(&count).Error
+	err := me.records().Count(&count).Error
 
 	if err == nil {
-		// Table already exists, no need to create
-		return nil
+		// Table already exists, only make sure it has the columns added since it was created
+		return me.upgradeMigrationTable()
 	}
 
-	// Table doesn't exist, create it with appropriate schema
-	// Get database driver name to create appropriate table schema
-	dbType := me.db.Dialector.Name()
+	// Table doesn't exist, create it with the schema of the connected database
+	return me.db.Exec(me.createMigrationTableSQL()).Error
+}
 
-	var createTableSQL string
+// createMigrationTableSQL returns the migrations table definition for the connected driver
+func (me *MigrationExecutor) createMigrationTableSQL() string {
+	return fmt.Sprintf(me.Dialect().CreateMigrationTableSQL(), me.table)
+}
 
-	switch dbType {
-	case constants.DriverMySQL:
-		createTableSQL = constants.MySQLCreateTableSQL
-	case constants.DriverPostgres:
-		createTableSQL = constants.PostgresCreateTableSQL
-	case constants.DriverSQLite:
-		createTableSQL = constants.SQLiteCreateTableSQL
-	default:
-		// Fallback to generic SQL that should work on most databases
-		createTableSQL = constants.GenericCreateTableSQL
+// upgradeMigrationTable adds the batch and out_of_order columns to migrations tables created by older versions.
+// Existing rows get one batch each, so `down --batch` never reverts more than a single migration of them.
+func (me *MigrationExecutor) upgradeMigrationTable() error {
+	if !me.db.Migrator().HasColumn(me.table, constants.BatchField) {
+		err := me.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf(constants.AddBatchColumnSQL, me.table)).Error; err != nil {
+				return fmt.Errorf(constants.ErrFailedUpgradeTable, err)
+			}
+			if err := tx.Exec(fmt.Sprintf(constants.BackfillBatchSQL, me.table)).Error; err != nil {
+				return fmt.Errorf(constants.ErrFailedUpgradeTable, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	return me.db.Exec(createTableSQL).Error
+	if !me.db.Migrator().HasColumn(me.table, constants.OutOfOrderField) {
+		if err := me.db.Exec(fmt.Sprintf(constants.AddOutOfOrderColumnSQL, me.table)).Error; err != nil {
+			return fmt.Errorf(constants.ErrFailedUpgradeTable, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrationTableExists reports whether the migrations table has been created
+func (me *MigrationExecutor) MigrationTableExists() bool {
+	return me.db.Migrator().HasTable(me.table)
 }
 
 // GetAppliedMigrations retrieves all applied migrations
 func (me *MigrationExecutor) GetAppliedMigrations(migrationType string) ([]string, error) {
-	var records []MigrationRecord
-	if err := me.db.Where(constants.TypeField+" = ?", migrationType).Order(constants.AppliedAtField + " DESC").Find(&records).Error; err != nil {
-		return nil, fmt.Errorf(constants.ErrFailedGetMigrations, err)
+	records, err := me.GetAppliedMigrationRecords(migrationType)
+	if err != nil {
+		return nil, err
 	}
 
 	var migrationIDs []string
@@ -82,8 +213,46 @@ func (me *MigrationExecutor) GetAppliedMigrations(migrationType string) ([]strin
 	return migrationIDs, nil
 }
 
+// GetAppliedMigrationRecords retrieves the full records of all applied migrations
+func (me *MigrationExecutor) GetAppliedMigrationRecords(migrationType string) ([]MigrationRecord, error) {
+	var records []MigrationRecord
+	if err := me.records().Where(constants.TypeField+" = ?", migrationType).Order(constants.AppliedAtField + " DESC").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedGetMigrations, err)
+	}
+
+	return records, nil
+}
+
+// NextBatch returns the batch number for a new `up` run, one above the highest recorded batch.
+// Tables that have not been upgraded yet are numbered as if their rows were already backfilled.
+func (me *MigrationExecutor) NextBatch() (int, error) {
+	column := constants.BatchField
+	if !me.db.Migrator().HasColumn(me.table, constants.BatchField) {
+		column = "id"
+	}
+
+	var batch int
+	if err := me.records().Select(fmt.Sprintf("COALESCE(MAX(%s), 0)", column)).Scan(&batch).Error; err != nil {
+		return 0, fmt.Errorf(constants.ErrFailedGetBatch, err)
+	}
+
+	return batch + 1, nil
+}
+
+// UpdateChecksum re-stamps the stored checksum of an applied migration
+func (me *MigrationExecutor) UpdateChecksum(migrationID, checksum string) error {
+	err := me.records().
+		Where(constants.MigrationIDField+" = ?", migrationID).
+		Update(constants.ChecksumField, checksum).Error
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedUpdateChecksum, err)
+	}
+
+	return nil
+}
+
 // RecordMigration records a migration as applied
-func (me *MigrationExecutor) RecordMigration(migrationID, name, migrationType, checksum string, executionTime int64) error {
+func (me *MigrationExecutor) RecordMigration(migrationID, name, migrationType, checksum string, executionTime int64, batch int, outOfOrder bool) error {
 	record := MigrationRecord{
 		MigrationID:   migrationID,
 		Name:          name,
@@ -91,9 +260,11 @@ func (me *MigrationExecutor) RecordMigration(migrationID, name, migrationType, c
 		AppliedAt:     time.Now(),
 		Checksum:      checksum,
 		ExecutionTime: executionTime,
+		Batch:         batch,
+		OutOfOrder:    outOfOrder,
 	}
 
-	if err := me.db.Create(&record).Error; err != nil {
+	if err := me.records().Create(&record).Error; err != nil {
 		return fmt.Errorf(constants.ErrFailedRecord, err)
 	}
 
@@ -102,110 +273,320 @@ func (me *MigrationExecutor) RecordMigration(migrationID, name, migrationType, c
 
 // RemoveMigration removes a migration record (for rollback)
 func (me *MigrationExecutor) RemoveMigration(migrationID string) error {
-	if err := me.db.Where(constants.MigrationIDField+" = ?", migrationID).Delete(&MigrationRecord{}).Error; err != nil {
+	if err := me.records().Where(constants.MigrationIDField+" = ?", migrationID).Delete(&MigrationRecord{}).Error; err != nil {
 		return fmt.Errorf(constants.ErrFailedRemove, err)
 	}
 
 	return nil
 }
 
-// ExecuteMigration executes a migration SQL file
-func (me *MigrationExecutor) ExecuteMigration(sqlContent string, migrationType string) error {
-	// Split SQL content by semicolon and execute each statement
-	statements := splitSQLStatements(sqlContent)
+// ReplaceSquashedRecords collapses the records of squashed migrations into the record of their baseline.
+// The baseline record keeps its batch and apply time and takes over the baseline name and checksum.
+func (me *MigrationExecutor) ReplaceSquashedRecords(baselineID, name, checksum string, squashedIDs []string) error {
+	return me.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(me.table).Where(constants.MigrationIDField+" IN ? AND "+constants.MigrationIDField+" <> ?", squashedIDs, baselineID).
+			Delete(&MigrationRecord{}).Error
+		if err != nil {
+			return fmt.Errorf(constants.ErrFailedRemove, err)
+		}
 
-	for i, statement := range statements {
-		statement = strings.TrimSpace(statement)
-		if statement == "" {
-			continue
+		err = tx.Table(me.table).
+			Where(constants.MigrationIDField+" = ?", baselineID).
+			Updates(map[string]interface{}{constants.NameField: name, constants.ChecksumField: checksum}).Error
+		if err != nil {
+			return fmt.Errorf(constants.ErrFailedUpdateChecksum, err)
 		}
 
-		// Execute the SQL statement
-		if err := me.db.Exec(statement).Error; err != nil {
-			return fmt.Errorf(constants.ErrFailedExecute, i+1, err, statement)
+		return nil
+	})
+}
+
+// Driver returns the name of the connected database driver
+func (me *MigrationExecutor) Driver() string {
+	return me.db.Dialector.Name()
+}
+
+// SupportsTransactionalDDL reports whether the connected database can roll back schema changes
+func (me *MigrationExecutor) SupportsTransactionalDDL() bool {
+	return me.Dialect().TransactionalDDL()
+}
+
+// useTransaction reports whether a migration script will run inside a transaction.
+// Go migrations always receive a transaction, SQL files only where DDL is transactional.
+// Batched files commit every key range on its own instead.
+func (me *MigrationExecutor) useTransaction(script MigrationScript) bool {
+	if script.Func != nil || script.Statements != nil {
+		return true
+	}
+	if HasDirective(script.Content, constants.DirectiveBatch) {
+		return false
+	}
+	return me.SupportsTransactionalDDL() && !HasDirective(script.Content, constants.DirectiveNoTransaction)
+}
+
+// executeScript runs either the Go function or the SQL statements of a migration script
+func (me *MigrationExecutor) executeScript(script MigrationScript) error {
+	if script.Statements != nil {
+		return me.executeStatements(script.Statements, script.Path)
+	}
+	if script.Func == nil {
+		batch, err := ParseBatchDirective(script.Content)
+		if err != nil {
+			return err
 		}
+		if batch != nil {
+			return me.executeBatched(script, batch)
+		}
+		return me.executeStatements(me.Dialect().SplitStatements(script.Content), script.Path)
 	}
 
-	return nil
+	sqlTx, ok := me.db.Statement.ConnPool.(*sql.Tx)
+	if !ok {
+		return fmt.Errorf(constants.ErrGoMigrationNoTransaction)
+	}
+	return script.Func(sqlTx)
+}
+
+// ApplyMigration executes an up migration and records it as applied.
+// Statements and the migration record share one transaction when the database supports it,
+// so a failing statement leaves neither partial changes nor a record behind.
+func (me *MigrationExecutor) ApplyMigration(script MigrationScript) (int64, error) {
+	var executionTime int64
+
+	apply := func(executor *MigrationExecutor) error {
+		startTime := time.Now()
+		if err := executor.executeScript(script); err != nil {
+			return fmt.Errorf(constants.ErrFailedExecuteMigration, err)
+		}
+		executionTime = time.Since(startTime).Milliseconds()
+
+		checksum := GetMigrationChecksum(script.Content)
+		if err := executor.RecordMigration(script.ID, script.Name, script.Type, checksum, executionTime, script.Batch, script.OutOfOrder); err != nil {
+			return err
+		}
+		return executor.finishBatched(script)
+	}
+
+	err := me.withLockTimeout(func(executor *MigrationExecutor) error {
+		if !executor.useTransaction(script) {
+			return apply(executor)
+		}
+		return executor.retryLocked(func() error {
+			return executor.transaction(script, func(tx *gorm.DB) error {
+				return apply(executor.withDB(tx))
+			})
+		})
+	})
+	return executionTime, err
+}
+
+// RollbackMigration executes a down migration and removes its record.
+// Like ApplyMigration, both steps share one transaction when the database supports it.
+func (me *MigrationExecutor) RollbackMigration(script MigrationScript) (int64, error) {
+	var executionTime int64
+
+	rollback := func(executor *MigrationExecutor) error {
+		startTime := time.Now()
+		if err := executor.executeScript(script); err != nil {
+			return fmt.Errorf(constants.ErrFailedRollbackMigration, err)
+		}
+		executionTime = time.Since(startTime).Milliseconds()
+
+		if err := executor.RemoveMigration(script.ID); err != nil {
+			return err
+		}
+		return executor.finishBatched(script)
+	}
+
+	err := me.withLockTimeout(func(executor *MigrationExecutor) error {
+		if !executor.useTransaction(script) {
+			return rollback(executor)
+		}
+		return executor.retryLocked(func() error {
+			return executor.transaction(script, func(tx *gorm.DB) error {
+				return rollback(executor.withDB(tx))
+			})
+		})
+	})
+	return executionTime, err
 }
 
-// splitSQLStatements splits SQL content into individual statements
-func splitSQLStatements(sqlContent string) []string {
-	var statements []string
-	var currentStatement strings.Builder
-	var inDollarQuote bool
-	var dollarTag string
+// transaction runs fn in the transaction of a migration script. A Go migration runs arbitrary code on the *sql.Tx,
+// so the statement timeout becomes the deadline of its whole transaction.
+func (me *MigrationExecutor) transaction(script MigrationScript, fn func(tx *gorm.DB) error) error {
+	if script.Func == nil || me.limits.StatementTimeout <= 0 {
+		return me.db.Transaction(fn)
+	}
+
+	ctx, cancel := context.WithTimeout(me.db.Statement.Context, me.limits.StatementTimeout)
+	defer cancel()
 
-	lines := strings.Split(sqlContent, "\n")
+	err := me.db.WithContext(ctx).Transaction(fn)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf(constants.ErrGoMigrationTimeout, script.ID, script.Name, me.limits.StatementTimeout, err)
+	}
+	return err
+}
+
+// ExecuteMigration executes a migration SQL file
+func (me *MigrationExecutor) ExecuteMigration(sqlContent string, migrationType string) error {
+	// Split SQL content the way the connected database expects and execute each statement
+	return me.executeStatements(me.Dialect().SplitStatements(sqlContent), "")
+}
 
-	for _, line := range lines {
-		line = strings.TrimRight(line, " \t\r")
+// executeStatements runs statements one by one, skipping empty ones.
+// file names the migration in errors and may be empty for SQL that does not come from a file.
+func (me *MigrationExecutor) executeStatements(statements []string, file string) error {
+	return me.withLockTimeout(func(executor *MigrationExecutor) error {
+		inTransaction := isTransaction(executor.db)
 
-		// Check for dollar-quoted strings
-		if !inDollarQuote {
-			// Look for start of dollar quote
-			if idx := strings.Index(line, "$$"); idx != -1 {
-				dollarTag = "$$"
-				inDollarQuote = true
-				currentStatement.WriteString(line)
-				currentStatement.WriteString("\n")
+		for i, statement := range statements {
+			statement = strings.TrimSpace(statement)
+			if statement == "" {
 				continue
 			}
-			// Look for custom dollar quote tags like $tag$
-			if idx := strings.Index(line, "$"); idx != -1 {
-				// Find the end of the tag
-				for i := idx + 1; i < len(line); i++ {
-					if line[i] == '$' {
-						dollarTag = line[idx : i+1]
-						inDollarQuote = true
-						currentStatement.WriteString(line)
-						currentStatement.WriteString("\n")
-						break
-					}
-				}
-				if inDollarQuote {
-					continue
+
+			location := fmt.Sprintf(constants.StatementLocation, i+1)
+			if file != "" {
+				location = fmt.Sprintf(constants.StatementLocationInFile, i+1, file)
+			}
+
+			// A failed statement aborts a transaction, so there the whole migration is retried instead
+			run := func() error { return executor.execStatement(location, statement) }
+			if inTransaction {
+				if err := run(); err != nil {
+					return err
 				}
+				continue
 			}
-		} else {
-			// We're inside a dollar quote, look for the end
-			if strings.Contains(line, dollarTag) {
-				inDollarQuote = false
-				dollarTag = ""
+			if err := executor.retryLocked(run); err != nil {
+				return err
 			}
-			currentStatement.WriteString(line)
-			currentStatement.WriteString("\n")
-			continue
 		}
 
-		// Regular line processing
-		currentStatement.WriteString(line)
-		currentStatement.WriteString("\n")
+		return nil
+	})
+}
+
+// execStatement runs one statement within the statement timeout
+func (me *MigrationExecutor) execStatement(location, statement string, args ...any) error {
+	if me.limits.StatementTimeout <= 0 {
+		if err := me.db.Exec(statement, args...).Error; err != nil {
+			return fmt.Errorf(constants.ErrFailedExecute, location, err, statement)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(me.db.Statement.Context, me.limits.StatementTimeout)
+	defer cancel()
 
-		// Check if this line ends with semicolon (and we're not in a dollar quote)
-		if strings.HasSuffix(strings.TrimSpace(line), ";") {
-			stmt := strings.TrimSpace(currentStatement.String())
-			if stmt != "" {
-				statements = append(statements, stmt)
-			}
-			currentStatement.Reset()
+	if err := me.db.WithContext(ctx).Exec(statement, args...).Error; err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf(constants.ErrStatementTimeout, location, me.limits.StatementTimeout, statement)
+		}
+		return fmt.Errorf(constants.ErrFailedExecute, location, err, statement)
+	}
+	return nil
+}
+
+// withLockTimeout runs fn with an executor whose connection has the lock timeout set.
+// Session settings stay on a connection, so it is reserved from the pool for fn and closed afterwards
+// instead of handing the setting to whatever uses the connection next. A transaction started elsewhere keeps its connection.
+func (me *MigrationExecutor) withLockTimeout(fn func(executor *MigrationExecutor) error) error {
+	if me.limits.LockTimeout <= 0 || me.limited || isTransaction(me.db) {
+		return fn(me)
+	}
+
+	sqlDB, err := me.db.DB()
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedGetDB, err)
+	}
+
+	ctx := me.db.Statement.Context
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedConnect, err)
+	}
+	defer func() {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		conn.Close()
+	}()
+
+	session := me.db.Session(&gorm.Session{Context: ctx})
+	session.Statement.ConnPool = conn
+
+	for _, statement := range me.Dialect().LockTimeoutSQL(me.limits.LockTimeout) {
+		if err := session.Exec(statement).Error; err != nil {
+			return fmt.Errorf(constants.ErrFailedSetLockTimeout, err)
 		}
 	}
 
-	// Handle any remaining statement
-	if currentStatement.Len() > 0 {
-		stmt := strings.TrimSpace(currentStatement.String())
-		if stmt != "" {
-			statements = append(statements, stmt)
+	executor := me.withDB(session)
+	executor.limited = true
+	return fn(executor)
+}
+
+// retryLocked runs fn until it succeeds, fails with an error other than a lock conflict or runs out of retries
+func (me *MigrationExecutor) retryLocked(fn func() error) error {
+	wait := constants.RetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !me.Dialect().IsLockError(err) {
+			return err
+		}
+		if attempt > me.limits.Retries {
+			if attempt > 1 {
+				return fmt.Errorf(constants.ErrLockRetriesExhausted, attempt, err)
+			}
+			return err
 		}
+
+		if me.onRetry != nil {
+			me.onRetry(attempt, wait, err)
+		}
+		time.Sleep(wait)
+		wait = min(wait*2, constants.MaxRetryBackoff)
 	}
+}
+
+// isTransaction reports whether db runs inside a transaction
+func isTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(*sql.Tx)
+	return ok
+}
 
-	return statements
+// MigrationIDLess orders migration IDs numerically when both are sequential, otherwise lexically
+func MigrationIDLess(a, b string) bool {
+	seqA, errA := strconv.Atoi(a)
+	seqB, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return seqA < seqB
+	}
+	return a < b
 }
 
-// GetMigrationChecksum calculates a simple checksum for migration content
+// GetMigrationChecksum returns the hex SHA-256 digest of migration content
 func GetMigrationChecksum(content string) string {
-	// Simple hash for now - in production you might want to use crypto/sha256
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsLegacyChecksum reports whether a recorded checksum predates SHA-256, those were 32-bit djb2 hashes of up to 8 hex digits
+func IsLegacyChecksum(checksum string) bool {
+	return checksum != "" && len(checksum) < sha256.Size*2
+}
+
+// ChecksumMatches reports whether a recorded checksum describes content, in either the SHA-256 or the legacy format
+func ChecksumMatches(recorded, content string) bool {
+	if IsLegacyChecksum(recorded) {
+		return recorded == legacyChecksum(content)
+	}
+	return recorded == GetMigrationChecksum(content)
+}
+
+// legacyChecksum is the djb2 hash elsa recorded before checksums moved to SHA-256
+func legacyChecksum(content string) string {
 	var checksum uint32
 	for _, char := range content {
 		checksum = ((checksum << 5) + checksum) + uint32(char)
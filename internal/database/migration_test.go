@@ -0,0 +1,264 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+// newSQLiteExecutor connects to a fresh SQLite database file with the migrations table in place
+func newSQLiteExecutor(t *testing.T) *MigrationExecutor {
+	t.Helper()
+
+	db, err := Connect(&DatabaseConfig{
+		Driver:   constants.DriverSQLite,
+		Database: filepath.Join(t.TempDir(), "elsa.db"),
+	})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	executor := NewMigrationExecutor(db)
+	if err := executor.EnsureMigrationTable(); err != nil {
+		t.Fatalf("EnsureMigrationTable: %v", err)
+	}
+	return executor
+}
+
+// tableExists reports whether the connected SQLite database has a table
+func tableExists(t *testing.T, executor *MigrationExecutor, table string) bool {
+	t.Helper()
+	return executor.DB().Migrator().HasTable(table)
+}
+
+func TestApplyAndRollbackMigration(t *testing.T) {
+	executor := newSQLiteExecutor(t)
+
+	up := MigrationScript{
+		ID:      "20240101000000",
+		Name:    "create_users",
+		Type:    constants.MigrationTypeDDL,
+		Content: "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\nCREATE INDEX idx_users_name ON users (name);\n",
+		Batch:   1,
+	}
+	if _, err := executor.ApplyMigration(up); err != nil {
+		t.Fatalf("ApplyMigration: %v", err)
+	}
+
+	if !tableExists(t, executor, "users") {
+		t.Fatal("users table was not created")
+	}
+
+	records, err := executor.GetAppliedMigrationRecords(constants.MigrationTypeDDL)
+	if err != nil {
+		t.Fatalf("GetAppliedMigrationRecords: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	record := records[0]
+	if record.MigrationID != up.ID || record.Name != up.Name || record.Batch != 1 {
+		t.Errorf("record = %+v, want id %s, name %s, batch 1", record, up.ID, up.Name)
+	}
+	if record.Checksum != GetMigrationChecksum(up.Content) {
+		t.Errorf("checksum = %q, want %q", record.Checksum, GetMigrationChecksum(up.Content))
+	}
+
+	next, err := executor.NextBatch()
+	if err != nil {
+		t.Fatalf("NextBatch: %v", err)
+	}
+	if next != 2 {
+		t.Errorf("NextBatch() = %d, want 2", next)
+	}
+
+	down := MigrationScript{
+		ID:      up.ID,
+		Name:    up.Name,
+		Type:    constants.MigrationTypeDDL,
+		Content: "DROP TABLE users;",
+	}
+	if _, err := executor.RollbackMigration(down); err != nil {
+		t.Fatalf("RollbackMigration: %v", err)
+	}
+
+	if tableExists(t, executor, "users") {
+		t.Error("users table still exists after rollback")
+	}
+	applied, err := executor.GetAppliedMigrations(constants.MigrationTypeDDL)
+	if err != nil {
+		t.Fatalf("GetAppliedMigrations: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied = %v after rollback, want none", applied)
+	}
+}
+
+func TestApplyMigrationFailureRollsBack(t *testing.T) {
+	executor := newSQLiteExecutor(t)
+
+	script := MigrationScript{
+		ID:      "20240101000000",
+		Name:    "broken",
+		Type:    constants.MigrationTypeDDL,
+		Content: "CREATE TABLE users (id INTEGER PRIMARY KEY);\nINSERT INTO missing VALUES (1);\n",
+		Batch:   1,
+		Path:    "ddl/20240101000000_broken.up.sql",
+	}
+	_, err := executor.ApplyMigration(script)
+	if err == nil {
+		t.Fatal("ApplyMigration succeeded, want an error")
+	}
+	if !strings.Contains(err.Error(), "statement 2 of "+script.Path) {
+		t.Errorf("error %q does not name the failing statement", err)
+	}
+
+	// SQLite DDL is transactional, so the first statement is rolled back with the failing one
+	if tableExists(t, executor, "users") {
+		t.Error("users table exists after a failed migration")
+	}
+	applied, err := executor.GetAppliedMigrations(constants.MigrationTypeDDL)
+	if err != nil {
+		t.Fatalf("GetAppliedMigrations: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied = %v after a failed migration, want none", applied)
+	}
+}
+
+func TestGoMigrationRunsInTransaction(t *testing.T) {
+	executor := newSQLiteExecutor(t)
+
+	failure := errors.New("stop")
+	script := MigrationScript{
+		ID:      "20240101000000",
+		Name:    "go_migration",
+		Type:    constants.MigrationTypeDML,
+		Content: "package migrations",
+		Func: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE notes (id INTEGER PRIMARY KEY)"); err != nil {
+				return err
+			}
+			return failure
+		},
+	}
+	if _, err := executor.ApplyMigration(script); !errors.Is(err, failure) {
+		t.Fatalf("ApplyMigration error = %v, want %v", err, failure)
+	}
+	if tableExists(t, executor, "notes") {
+		t.Error("notes table exists after the Go migration failed")
+	}
+}
+
+func TestMigrationHistoryTable(t *testing.T) {
+	executor := newSQLiteExecutor(t).WithTable("schema_history")
+	if err := executor.EnsureMigrationTable(); err != nil {
+		t.Fatalf("EnsureMigrationTable: %v", err)
+	}
+
+	script := MigrationScript{ID: "20240101000000", Name: "noop", Type: constants.MigrationTypeDML, Content: "SELECT 1;", Batch: 1}
+	if _, err := executor.ApplyMigration(script); err != nil {
+		t.Fatalf("ApplyMigration: %v", err)
+	}
+
+	var count int64
+	if err := executor.DB().Table("schema_history").Count(&count).Error; err != nil {
+		t.Fatalf("counting schema_history: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("schema_history has %d rows, want 1", count)
+	}
+	if err := executor.DB().Table(constants.MigrationsTableName).Count(&count).Error; err != nil {
+		t.Fatalf("counting migrations: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("migrations has %d rows, want 0", count)
+	}
+}
+
+func TestLibSQLFileDatabase(t *testing.T) {
+	// libsql-client-go opens file: URLs through the registered sqlite3 driver, which needs no server
+	sqlDB, err := sql.Open(constants.DriverLibSQL, "file:"+filepath.Join(t.TempDir(), "elsa.db"))
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := ConnectDB(sqlDB, constants.DriverLibSQL)
+	if err != nil {
+		t.Fatalf("ConnectDB: %v", err)
+	}
+
+	executor := NewMigrationExecutor(db)
+	if _, ok := executor.Dialect().(sqliteDialect); !ok {
+		t.Errorf("Dialect() = %T, want sqliteDialect", executor.Dialect())
+	}
+	if err := executor.EnsureMigrationTable(); err != nil {
+		t.Fatalf("EnsureMigrationTable: %v", err)
+	}
+
+	script := MigrationScript{
+		ID:      "20240101000000",
+		Name:    "create_trigger",
+		Type:    constants.MigrationTypeDDL,
+		Content: "CREATE TABLE logs (id INTEGER PRIMARY KEY, trigger TEXT);\nCREATE TABLE counts (n INTEGER);\nCREATE TRIGGER count_logs AFTER INSERT ON logs BEGIN UPDATE counts SET n = n + 1; END;\n",
+		Batch:   1,
+	}
+	if _, err := executor.ApplyMigration(script); err != nil {
+		t.Fatalf("ApplyMigration: %v", err)
+	}
+
+	applied, err := executor.GetAppliedMigrations(constants.MigrationTypeDDL)
+	if err != nil {
+		t.Fatalf("GetAppliedMigrations: %v", err)
+	}
+	if !reflect.DeepEqual(applied, []string{script.ID}) {
+		t.Errorf("applied = %v, want [%s]", applied, script.ID)
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	content := "CREATE TABLE users (id INTEGER PRIMARY KEY);\n"
+
+	checksum := GetMigrationChecksum(content)
+	if len(checksum) != 64 {
+		t.Fatalf("GetMigrationChecksum() = %q, want a SHA-256 hex digest", checksum)
+	}
+	if IsLegacyChecksum(checksum) {
+		t.Errorf("IsLegacyChecksum(%q) = true", checksum)
+	}
+
+	legacy := legacyChecksum(content)
+	if !IsLegacyChecksum(legacy) {
+		t.Errorf("IsLegacyChecksum(%q) = false", legacy)
+	}
+
+	tests := []struct {
+		name     string
+		recorded string
+		content  string
+		want     bool
+	}{
+		{name: "sha256 unchanged", recorded: checksum, content: content, want: true},
+		{name: "sha256 modified", recorded: checksum, content: content + "-- edit\n", want: false},
+		{name: "legacy unchanged", recorded: legacy, content: content, want: true},
+		{name: "legacy modified", recorded: legacy, content: content + "-- edit\n", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChecksumMatches(tt.recorded, tt.content); got != tt.want {
+				t.Errorf("ChecksumMatches(%q) = %v, want %v", tt.recorded, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,534 @@
+package database
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+	"golang.org/x/tools/go/packages"
+	"gorm.io/gorm/schema"
+)
+
+// goFieldKind is the GORM data type of a Go field, with the bit size of numbers
+type goFieldKind struct {
+	name string // one of the modelKind constants
+	bits int
+}
+
+const (
+	modelKindBool   = "bool"
+	modelKindInt    = "int"
+	modelKindUint   = "uint"
+	modelKindFloat  = "float"
+	modelKindString = "string"
+	modelKindTime   = "time"
+	modelKindBytes  = "bytes"
+)
+
+// valueTypeKinds are struct types GORM stores in a single column instead of treating them as relations
+var valueTypeKinds = map[string]goFieldKind{
+	"time.Time":                {name: modelKindTime},
+	"gorm.io/gorm.DeletedAt":   {name: modelKindTime},
+	"database/sql.NullTime":    {name: modelKindTime},
+	"database/sql.NullString":  {name: modelKindString},
+	"database/sql.NullBool":    {name: modelKindBool},
+	"database/sql.NullByte":    {name: modelKindUint, bits: 8},
+	"database/sql.NullInt16":   {name: modelKindInt, bits: 16},
+	"database/sql.NullInt32":   {name: modelKindInt, bits: 32},
+	"database/sql.NullInt64":   {name: modelKindInt, bits: 64},
+	"database/sql.NullFloat64": {name: modelKindFloat, bits: 64},
+}
+
+// modelNamer derives table, column and index names the way GORM's default naming strategy does
+var modelNamer = schema.NamingStrategy{}
+
+// defaultIndexPriority orders composite index columns that do not set priority, as GORM does
+const defaultIndexPriority = 10
+
+// modelField is one column of a model while its table is being assembled
+type modelField struct {
+	goName   string
+	kind     goFieldKind
+	tag      string
+	settings map[string]string
+	column   ColumnSchema
+}
+
+// modelIndexColumn is one column of an index declared in gorm tags
+type modelIndexColumn struct {
+	column   string
+	priority int
+}
+
+// modelLoader reads GORM models from Go packages and renders their columns for one driver
+type modelLoader struct {
+	driver   string
+	warnings []string
+}
+
+// LoadModelSchemas loads the packages matching patterns from dir and returns the tables of their GORM models,
+// with column types as GORM's AutoMigrate would create them on driver. Models are exported structs with
+// gorm tags, an embedded gorm.Model or a TableName method. Fields that cannot be mapped are reported as warnings.
+func LoadModelSchemas(dir, driver string, patterns []string) ([]TableSchema, []string, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedImports | packages.NeedDeps,
+		Dir:  dir,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, nil, fmt.Errorf(constants.ErrFailedLoadModels, err)
+	}
+
+	loader := &modelLoader{driver: driver}
+	var tables []TableSchema
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, nil, fmt.Errorf(constants.ErrModelPackageErrors, pkg.PkgPath, pkg.Errors[0])
+		}
+
+		tableNames := tableNameMethods(pkg)
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			typeName, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || !typeName.Exported() || typeName.IsAlias() {
+				continue
+			}
+			named, ok := typeName.Type().(*types.Named)
+			if !ok || named.TypeParams().Len() > 0 {
+				continue
+			}
+			st, ok := named.Underlying().(*types.Struct)
+			if !ok {
+				continue
+			}
+
+			if table, ok := loader.loadModel(name, st, tableNames[name]); ok {
+				tables = append(tables, table)
+			}
+		}
+	}
+
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables, loader.warnings, nil
+}
+
+// tableNameMethods returns the names returned by TableName methods that return a string literal, by receiver type
+func tableNameMethods(pkg *packages.Package) map[string]string {
+	names := make(map[string]string)
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Name.Name != "TableName" || fn.Recv == nil || len(fn.Recv.List) != 1 || fn.Body == nil || len(fn.Body.List) != 1 {
+				continue
+			}
+			ret, ok := fn.Body.List[0].(*ast.ReturnStmt)
+			if !ok || len(ret.Results) != 1 {
+				continue
+			}
+			lit, ok := ret.Results[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				continue
+			}
+
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			ident, ok := recv.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			if value, err := strconv.Unquote(lit.Value); err == nil {
+				names[ident.Name] = value
+			}
+		}
+	}
+	return names
+}
+
+// loadModel builds the table of one struct; ok is false when the struct is not a GORM model
+func (l *modelLoader) loadModel(structName string, st *types.Struct, tableName string) (TableSchema, bool) {
+	var fields []modelField
+	warnings := len(l.warnings)
+	tagged := l.collectFields(structName, st, "", &fields)
+	if (!tagged && tableName == "") || len(fields) == 0 {
+		// Plain structs such as DTOs are no concern of the diff, neither are their fields
+		l.warnings = l.warnings[:warnings]
+		return TableSchema{}, false
+	}
+
+	table := TableSchema{Name: tableName}
+	if table.Name == "" {
+		table.Name = modelNamer.TableName(structName)
+	}
+
+	// A field named ID is the primary key unless another field claims it
+	primaryKeys := 0
+	for _, field := range fields {
+		if field.column.PrimaryKey {
+			primaryKeys++
+		}
+	}
+	if primaryKeys == 0 {
+		for i := range fields {
+			if fields[i].column.Name == "id" {
+				fields[i].column.PrimaryKey = true
+				primaryKeys++
+				break
+			}
+		}
+	}
+
+	for i := range fields {
+		field := &fields[i]
+		column := &field.column
+
+		if column.PrimaryKey {
+			column.Nullable = false
+			autoIncrement, set := field.settings["AUTOINCREMENT"]
+			isInteger := field.kind.name == modelKindInt || field.kind.name == modelKindUint
+			if set {
+				column.AutoIncrement = !strings.EqualFold(autoIncrement, "false")
+			} else {
+				column.AutoIncrement = primaryKeys == 1 && isInteger && !column.HasDefault && field.settings["TYPE"] == ""
+			}
+		}
+
+		if sqlType := field.settings["TYPE"]; sqlType != "" {
+			column.Type = sqlType
+		} else {
+			column.Type = l.columnType(field)
+		}
+
+		table.Columns = append(table.Columns, *column)
+	}
+
+	table.Indexes = l.modelIndexes(table.Name, fields)
+	return table, true
+}
+
+// collectFields appends the columns of a struct, flattening embedded structs, and reports whether any field has a gorm tag
+func (l *modelLoader) collectFields(structName string, st *types.Struct, prefix string, fields *[]modelField) bool {
+	tagged := false
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		tag, hasTag := reflect.StructTag(st.Tag(i)).Lookup("gorm")
+		settings := schema.ParseTagSetting(tag, ";")
+		if _, ignored := settings["-"]; ignored || !field.Exported() {
+			continue
+		}
+		tagged = tagged || hasTag
+
+		_, embedded := settings["EMBEDDED"]
+		if field.Anonymous() || embedded {
+			if inner, ok := embeddedStruct(field.Type()); ok {
+				tagged = l.collectFields(structName, inner, prefix+settings["EMBEDDEDPREFIX"], fields) || tagged
+				continue
+			}
+		}
+
+		kind, ok := fieldKind(field.Type())
+		if !ok && settings["TYPE"] == "" {
+			// Structs and slices of structs are associations, which live in other tables
+			if !isAssociation(field.Type()) {
+				l.warnings = append(l.warnings, fmt.Sprintf(constants.DiffWarningUnmappedField, structName, field.Name(), field.Type()))
+			}
+			continue
+		}
+
+		column := ColumnSchema{Name: settings["COLUMN"], Nullable: true}
+		if column.Name == "" {
+			column.Name = modelNamer.ColumnName("", field.Name())
+		}
+		column.Name = prefix + column.Name
+		column.PrimaryKey = isTagTrue(settings, "PRIMARYKEY") || isTagTrue(settings, "PRIMARY_KEY")
+		column.Nullable = !isTagTrue(settings, "NOT NULL") && !isTagTrue(settings, "NOTNULL")
+		if value, exists := settings["DEFAULT"]; exists && !strings.EqualFold(value, "null") {
+			column.HasDefault = true
+			column.Default = unquoteDefault(value)
+		}
+
+		*fields = append(*fields, modelField{goName: field.Name(), kind: kind, tag: tag, settings: settings, column: column})
+	}
+	return tagged
+}
+
+// columnType renders the column type GORM's AutoMigrate would choose for a field
+func (l *modelLoader) columnType(field *modelField) string {
+	size, _ := strconv.Atoi(field.settings["SIZE"])
+	precision, _ := strconv.Atoi(field.settings["PRECISION"])
+	scale, _ := strconv.Atoi(field.settings["SCALE"])
+	bits := field.kind.bits
+	if size > 0 && (field.kind.name == modelKindInt || field.kind.name == modelKindUint) {
+		bits = size
+	}
+
+	switch l.driver {
+	case constants.DriverMySQL:
+		return mysqlColumnType(field, bits, size, precision, scale)
+	case constants.DriverPostgres, constants.DriverPostgreSQL:
+		return postgresColumnType(field, bits, size, precision, scale)
+	default:
+		return sqliteColumnType(field)
+	}
+}
+
+func sqliteColumnType(field *modelField) string {
+	switch field.kind.name {
+	case modelKindBool:
+		return "numeric"
+	case modelKindInt, modelKindUint:
+		return "integer"
+	case modelKindFloat:
+		return "real"
+	case modelKindTime:
+		return "datetime"
+	case modelKindBytes:
+		return "blob"
+	default:
+		return "text"
+	}
+}
+
+func mysqlColumnType(field *modelField, bits, size, precision, scale int) string {
+	switch field.kind.name {
+	case modelKindBool:
+		return "boolean"
+	case modelKindInt, modelKindUint:
+		sqlType := "bigint"
+		switch {
+		case bits <= 8:
+			sqlType = "tinyint"
+		case bits <= 16:
+			sqlType = "smallint"
+		case bits <= 24:
+			sqlType = "mediumint"
+		case bits <= 32:
+			sqlType = "int"
+		}
+		if field.kind.name == modelKindUint {
+			sqlType += " unsigned"
+		}
+		return sqlType
+	case modelKindFloat:
+		if precision > 0 {
+			return fmt.Sprintf("decimal(%d, %d)", precision, scale)
+		}
+		if bits <= 32 {
+			return "float"
+		}
+		return "double"
+	case modelKindTime:
+		return "datetime(3)"
+	case modelKindBytes:
+		if size > 0 && size < 65536 {
+			return fmt.Sprintf("varbinary(%d)", size)
+		}
+		return "longblob"
+	default:
+		if size == 0 && (field.column.PrimaryKey || field.column.HasDefault || field.settings["INDEX"] != "" || field.settings["UNIQUE"] != "") {
+			// Indexed columns need a bounded length, 191 characters fit an index key in utf8mb4
+			size = 191
+		}
+		switch {
+		case size == 0 || size > 1<<24:
+			return "longtext"
+		case size >= 65536:
+			return "mediumtext"
+		default:
+			return fmt.Sprintf("varchar(%d)", size)
+		}
+	}
+}
+
+func postgresColumnType(field *modelField, bits, size, precision, scale int) string {
+	switch field.kind.name {
+	case modelKindBool:
+		return "boolean"
+	case modelKindInt, modelKindUint:
+		if field.kind.name == modelKindUint {
+			bits++
+		}
+		switch {
+		case bits <= 16:
+			return "smallint"
+		case bits <= 32:
+			return "integer"
+		default:
+			return "bigint"
+		}
+	case modelKindFloat:
+		if precision > 0 {
+			if scale > 0 {
+				return fmt.Sprintf("numeric(%d, %d)", precision, scale)
+			}
+			return fmt.Sprintf("numeric(%d)", precision)
+		}
+		return "decimal"
+	case modelKindTime:
+		if precision > 0 {
+			return fmt.Sprintf("timestamptz(%d)", precision)
+		}
+		return "timestamptz"
+	case modelKindBytes:
+		return "bytea"
+	default:
+		if size > 0 {
+			return fmt.Sprintf("varchar(%d)", size)
+		}
+		return "text"
+	}
+}
+
+// modelIndexes collects the index, uniqueIndex and unique settings of a table's fields.
+// Columns of composite indexes are ordered by priority, then by field order.
+func (l *modelLoader) modelIndexes(table string, fields []modelField) []IndexSchema {
+	var names []string
+	indexes := make(map[string]*IndexSchema)
+	columns := make(map[string][]modelIndexColumn)
+
+	add := func(name, column string, unique bool, priority int) {
+		if _, exists := indexes[name]; !exists {
+			names = append(names, name)
+			indexes[name] = &IndexSchema{Name: name}
+		}
+		indexes[name].Unique = indexes[name].Unique || unique
+		columns[name] = append(columns[name], modelIndexColumn{column: column, priority: priority})
+	}
+
+	for _, field := range fields {
+		// ParseTagSetting keeps one value per key, a field may declare several indexes
+		for _, setting := range strings.Split(field.tag, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(setting), ":")
+			key = strings.ToUpper(strings.TrimSpace(key))
+			if key != "INDEX" && key != "UNIQUEINDEX" {
+				continue
+			}
+
+			options := strings.Split(value, ",")
+			name := strings.TrimSpace(options[0])
+			if strings.Contains(name, ":") {
+				name, options = "", append([]string{""}, options...)
+			}
+			if name == "" {
+				name = modelNamer.IndexName(table, field.goName)
+			}
+
+			unique := key == "UNIQUEINDEX"
+			priority := defaultIndexPriority
+			for _, option := range options[1:] {
+				optionKey, optionValue, _ := strings.Cut(strings.TrimSpace(option), ":")
+				switch strings.ToUpper(optionKey) {
+				case "UNIQUE":
+					unique = true
+				case "CLASS":
+					unique = unique || strings.EqualFold(optionValue, "UNIQUE")
+				case "PRIORITY":
+					if p, err := strconv.Atoi(optionValue); err == nil {
+						priority = p
+					}
+				}
+			}
+			add(name, field.column.Name, unique, priority)
+		}
+
+		if isTagTrue(field.settings, "UNIQUE") {
+			add(modelNamer.UniqueName(table, field.goName), field.column.Name, true, defaultIndexPriority)
+		}
+	}
+
+	var result []IndexSchema
+	for _, name := range names {
+		indexColumns := columns[name]
+		sort.SliceStable(indexColumns, func(i, j int) bool { return indexColumns[i].priority < indexColumns[j].priority })
+		for _, column := range indexColumns {
+			indexes[name].Columns = append(indexes[name].Columns, column.column)
+		}
+		result = append(result, *indexes[name])
+	}
+	return result
+}
+
+// fieldKind maps a Go type to the GORM data type it is stored as; pointers store their element
+func fieldKind(t types.Type) (goFieldKind, bool) {
+	if pointer, ok := t.(*types.Pointer); ok {
+		t = pointer.Elem()
+	}
+
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil {
+		if kind, ok := valueTypeKinds[named.Obj().Pkg().Path()+"."+named.Obj().Name()]; ok {
+			return kind, true
+		}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.Bool:
+			return goFieldKind{name: modelKindBool}, true
+		case types.Int, types.Int64:
+			return goFieldKind{name: modelKindInt, bits: 64}, true
+		case types.Int8:
+			return goFieldKind{name: modelKindInt, bits: 8}, true
+		case types.Int16:
+			return goFieldKind{name: modelKindInt, bits: 16}, true
+		case types.Int32:
+			return goFieldKind{name: modelKindInt, bits: 32}, true
+		case types.Uint, types.Uint64, types.Uintptr:
+			return goFieldKind{name: modelKindUint, bits: 64}, true
+		case types.Uint8:
+			return goFieldKind{name: modelKindUint, bits: 8}, true
+		case types.Uint16:
+			return goFieldKind{name: modelKindUint, bits: 16}, true
+		case types.Uint32:
+			return goFieldKind{name: modelKindUint, bits: 32}, true
+		case types.Float32:
+			return goFieldKind{name: modelKindFloat, bits: 32}, true
+		case types.Float64:
+			return goFieldKind{name: modelKindFloat, bits: 64}, true
+		case types.String:
+			return goFieldKind{name: modelKindString}, true
+		}
+	case *types.Slice:
+		if elem, ok := u.Elem().Underlying().(*types.Basic); ok && elem.Kind() == types.Byte {
+			return goFieldKind{name: modelKindBytes}, true
+		}
+	}
+	return goFieldKind{}, false
+}
+
+// embeddedStruct returns the struct of an embedded field, unless GORM stores it in a single column
+func embeddedStruct(t types.Type) (*types.Struct, bool) {
+	if _, ok := fieldKind(t); ok {
+		return nil, false
+	}
+	if pointer, ok := t.(*types.Pointer); ok {
+		t = pointer.Elem()
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	return st, ok
+}
+
+// isAssociation reports whether a field refers to other models: a struct, a pointer to one or a slice of them
+func isAssociation(t types.Type) bool {
+	if slice, ok := t.Underlying().(*types.Slice); ok {
+		t = slice.Elem()
+	}
+	if pointer, ok := t.(*types.Pointer); ok {
+		t = pointer.Elem()
+	}
+	_, ok := t.Underlying().(*types.Struct)
+	return ok
+}
+
+// isTagTrue reports whether a gorm tag setting is present and not set to false
+func isTagTrue(settings map[string]string, key string) bool {
+	value, exists := settings[key]
+	return exists && !strings.EqualFold(value, "false")
+}
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+	"gorm.io/gorm"
+)
+
+var (
+	// mysqlAutoIncrementPattern strips the table counter so dumps only change when the schema does
+	mysqlAutoIncrementPattern = regexp.MustCompile(`\s+AUTO_INCREMENT=\d+`)
+	// mysqlDefinerPattern strips the view owner, which rarely exists on the database the dump is loaded into
+	mysqlDefinerPattern = regexp.MustCompile(`\s+DEFINER=\S+`)
+)
+
+// sqliteMasterRow is one object definition from sqlite_master
+type sqliteMasterRow struct {
+	Name    string `gorm:"column:name"`
+	TblName string `gorm:"column:tbl_name"`
+	SQL     string `gorm:"column:sql"`
+}
+
+// postgresTable is one table of the current Postgres schema
+type postgresTable struct {
+	OID        uint32 `gorm:"column:oid"`
+	Name       string `gorm:"column:name"`
+	QuotedName string `gorm:"column:quoted_name"`
+}
+
+// postgresSequence is one standalone or serial sequence of the current Postgres schema
+type postgresSequence struct {
+	CreateSQL  string `gorm:"column:create_sql"`
+	OwnerTable string `gorm:"column:owner_table"`
+	OwnedBySQL string `gorm:"column:owned_by_sql"`
+}
+
+// DumpSchema renders the current schema followed by the contents of the migrations table as one SQL script.
+// Elsa's own tables are left out of the schema part, the migrations table is recreated from its records instead.
+func (me *MigrationExecutor) DumpSchema() (string, error) {
+	var statements []string
+	var err error
+
+	switch me.Driver() {
+	case constants.DriverPostgres:
+		statements, err = me.dumpPostgresSchema()
+	case constants.DriverMySQL:
+		statements, err = me.dumpMySQLSchema()
+	case constants.DriverSQLite:
+		statements, err = me.dumpSQLiteSchema()
+	default:
+		return "", fmt.Errorf(constants.ErrSchemaUnsupportedDriver, me.Driver())
+	}
+	if err != nil {
+		return "", fmt.Errorf(constants.ErrFailedDumpSchema, err)
+	}
+
+	records, err := me.allMigrationRecords()
+	if err != nil {
+		return "", fmt.Errorf(constants.ErrFailedDumpSchema, err)
+	}
+
+	var dump strings.Builder
+	fmt.Fprintf(&dump, constants.SchemaDumpHeader, me.Driver(), time.Now().UTC().Format(time.RFC3339), len(records))
+
+	for _, statement := range statements {
+		writeSchemaStatement(&dump, statement)
+	}
+
+	dump.WriteString(constants.SchemaDumpMigrationsHeader)
+	writeSchemaStatement(&dump, me.createMigrationTableSQL())
+	for _, record := range records {
+		writeSchemaStatement(&dump, fmt.Sprintf(constants.SchemaInsertMigrationSQL, me.table,
+			quoteSQLLiteral(record.MigrationID), quoteSQLLiteral(record.Name), quoteSQLLiteral(record.Type),
+			quoteSQLLiteral(record.AppliedAt.UTC().Format(constants.SchemaTimestampFormat)),
+			quoteSQLLiteral(record.Checksum), record.ExecutionTime, record.Batch, record.OutOfOrder))
+	}
+
+	return dump.String(), nil
+}
+
+// LoadSchema applies a schema dump to an empty database and returns the number of migrations it marked as applied.
+// The dump runs in one transaction where DDL is transactional and on a single connection otherwise,
+// so session settings such as MySQL's FOREIGN_KEY_CHECKS stay in effect for the whole file.
+func (me *MigrationExecutor) LoadSchema(content string) (int64, error) {
+	if err := me.ensureEmptyDatabase(); err != nil {
+		return 0, err
+	}
+
+	load := func(tx *gorm.DB) error {
+		for i, statement := range me.Dialect().SplitStatements(content) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf(constants.ErrFailedExecute, fmt.Sprintf(constants.StatementLocation, i+1), err, statement)
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if me.SupportsTransactionalDDL() {
+		err = me.db.Transaction(load)
+	} else {
+		err = me.db.Connection(load)
+	}
+	if err != nil {
+		return 0, fmt.Errorf(constants.ErrFailedLoadSchema, err)
+	}
+
+	var count int64
+	if err := me.records().Count(&count).Error; err != nil {
+		return 0, fmt.Errorf(constants.ErrFailedLoadSchema, err)
+	}
+
+	return count, nil
+}
+
+// ensureEmptyDatabase refuses to load a dump over existing tables or applied migrations
+func (me *MigrationExecutor) ensureEmptyDatabase() error {
+	tables, err := me.db.Migrator().GetTables()
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedLoadSchema, err)
+	}
+
+	var existing []string
+	for _, table := range tables {
+		// SQLite keeps AUTOINCREMENT counters in sqlite_sequence, which exists as soon as the lock table does
+		if me.isElsaTable(table) || strings.HasPrefix(table, constants.SQLiteInternalTablePrefix) {
+			continue
+		}
+		existing = append(existing, table)
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf(constants.ErrSchemaDatabaseNotEmpty, strings.Join(existing, ", "))
+	}
+
+	if me.MigrationTableExists() {
+		var count int64
+		if err := me.records().Count(&count).Error; err != nil {
+			return fmt.Errorf(constants.ErrFailedLoadSchema, err)
+		}
+		if count > 0 {
+			return fmt.Errorf(constants.ErrSchemaMigrationsApplied, count)
+		}
+	}
+
+	return nil
+}
+
+// allMigrationRecords returns every migration record in apply order
+func (me *MigrationExecutor) allMigrationRecords() ([]MigrationRecord, error) {
+	var records []MigrationRecord
+	if err := me.records().Order("id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedGetMigrations, err)
+	}
+	return records, nil
+}
+
+// dumpSQLiteSchema reads table, index, view and trigger definitions from sqlite_master
+func (me *MigrationExecutor) dumpSQLiteSchema() ([]string, error) {
+	var rows []sqliteMasterRow
+	if err := me.db.Raw(constants.SQLiteSchemaObjectsSQL).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var statements []string
+	for _, row := range rows {
+		if me.isElsaTable(row.TblName) {
+			continue
+		}
+		statements = append(statements, row.SQL)
+	}
+
+	return statements, nil
+}
+
+// dumpMySQLSchema collects SHOW CREATE output for every table and view of the current database
+func (me *MigrationExecutor) dumpMySQLSchema() ([]string, error) {
+	rows, err := me.db.Raw(constants.MySQLShowTablesSQL).Rows()
+	if err != nil {
+		return nil, err
+	}
+
+	var tables, views []string
+	for rows.Next() {
+		var name, tableType string
+		if err := rows.Scan(&name, &tableType); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if me.isElsaTable(name) {
+			continue
+		}
+		if tableType == constants.MySQLViewTableType {
+			views = append(views, name)
+		} else {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+
+	// Tables are created in name order, so foreign keys may point at tables that do not exist yet
+	statements := []string{constants.MySQLDisableForeignKeyChecksSQL}
+
+	for _, table := range tables {
+		var name, createSQL string
+		if err := me.db.Raw(fmt.Sprintf(constants.MySQLShowCreateTableSQL, quoteMySQLIdentifier(table))).Row().Scan(&name, &createSQL); err != nil {
+			return nil, err
+		}
+		statements = append(statements, mysqlAutoIncrementPattern.ReplaceAllString(createSQL, ""))
+	}
+
+	for _, view := range views {
+		var name, createSQL, charset, collation string
+		if err := me.db.Raw(fmt.Sprintf(constants.MySQLShowCreateViewSQL, quoteMySQLIdentifier(view))).Row().Scan(&name, &createSQL, &charset, &collation); err != nil {
+			return nil, err
+		}
+		statements = append(statements, mysqlDefinerPattern.ReplaceAllString(createSQL, ""))
+	}
+
+	return append(statements, constants.MySQLEnableForeignKeyChecksSQL), nil
+}
+
+// dumpPostgresSchema rebuilds the objects of the current schema from the system catalogs in pg_dump order:
+// extensions, types, functions, sequences, tables, indexes, foreign keys, views and triggers
+func (me *MigrationExecutor) dumpPostgresSchema() ([]string, error) {
+	excluded := []string{me.table, me.lockTable(), me.auditTable(), me.checkpointTable()}
+
+	var statements []string
+	for _, query := range []string{constants.PostgresExtensionsSQL, constants.PostgresEnumTypesSQL, constants.PostgresFunctionsSQL} {
+		var definitions []string
+		if err := me.db.Raw(query).Scan(&definitions).Error; err != nil {
+			return nil, err
+		}
+		statements = append(statements, definitions...)
+	}
+
+	var sequences []postgresSequence
+	if err := me.db.Raw(constants.PostgresSequencesSQL).Scan(&sequences).Error; err != nil {
+		return nil, err
+	}
+	var ownedBy []string
+	for _, sequence := range sequences {
+		if me.isElsaTable(sequence.OwnerTable) {
+			continue
+		}
+		statements = append(statements, sequence.CreateSQL)
+		if sequence.OwnedBySQL != "" {
+			ownedBy = append(ownedBy, sequence.OwnedBySQL)
+		}
+	}
+
+	var tables []postgresTable
+	if err := me.db.Raw(constants.PostgresTablesSQL).Scan(&tables).Error; err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		if me.isElsaTable(table.Name) {
+			continue
+		}
+
+		var definitions []string
+		if err := me.db.Raw(constants.PostgresColumnsSQL, table.OID).Scan(&definitions).Error; err != nil {
+			return nil, err
+		}
+		var constraints []string
+		if err := me.db.Raw(constants.PostgresTableConstraintsSQL, table.OID).Scan(&constraints).Error; err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, constraints...)
+
+		statements = append(statements, fmt.Sprintf(constants.PostgresCreateTableFormat, table.QuotedName, strings.Join(definitions, ",\n    ")))
+	}
+	statements = append(statements, ownedBy...)
+
+	for _, query := range []string{constants.PostgresIndexesSQL, constants.PostgresForeignKeysSQL} {
+		var definitions []string
+		if err := me.db.Raw(query, excluded).Scan(&definitions).Error; err != nil {
+			return nil, err
+		}
+		statements = append(statements, definitions...)
+	}
+
+	for _, query := range []string{constants.PostgresViewsSQL, constants.PostgresTriggersSQL} {
+		var definitions []string
+		if err := me.db.Raw(query).Scan(&definitions).Error; err != nil {
+			return nil, err
+		}
+		statements = append(statements, definitions...)
+	}
+
+	return statements, nil
+}
+
+// isElsaTable reports whether a table belongs to Elsa's own bookkeeping
+func (me *MigrationExecutor) isElsaTable(name string) bool {
+	return name == me.table || name == me.lockTable() || name == me.auditTable() || name == me.checkpointTable()
+}
+
+// writeSchemaStatement appends a statement to a dump, terminated so the dialect splitter can read it back
+func writeSchemaStatement(dump *strings.Builder, statement string) {
+	statement = strings.TrimSpace(statement)
+	dump.WriteString(statement)
+	if !strings.HasSuffix(statement, ";") {
+		dump.WriteString(";")
+	}
+	dump.WriteString("\n\n")
+}
+
+// quoteSQLLiteral renders a value as a single-quoted SQL string literal
+func quoteSQLLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// quoteMySQLIdentifier renders a name as a backtick-quoted MySQL identifier
+func quoteMySQLIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
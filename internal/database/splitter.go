@@ -0,0 +1,375 @@
+package database
+
+import (
+	"strings"
+)
+
+// splitRules are the lexical rules of a dialect that decide where one statement ends and the next begins
+type splitRules struct {
+	backslashEscapes bool // MySQL: a backslash escapes the next character inside strings
+	escapeStrings    bool // PostgreSQL: E'...' strings take backslash escapes
+	backtickQuotes   bool // MySQL and SQLite: `identifier`
+	bracketQuotes    bool // SQLite: [identifier]
+	hashComments     bool // MySQL: # comment
+	nestedComments   bool // PostgreSQL: /* outer /* inner */ still a comment */
+	dollarQuotes     bool // PostgreSQL: $$ body $$ and $fn$ body $fn$
+	delimiterCommand bool // MySQL client: DELIMITER // changes the statement terminator
+}
+
+var (
+	ansiSplitRules     = splitRules{}
+	sqliteSplitRules   = splitRules{backtickQuotes: true, bracketQuotes: true}
+	mysqlSplitRules    = splitRules{backslashEscapes: true, backtickQuotes: true, hashComments: true, delimiterCommand: true}
+	postgresSplitRules = splitRules{escapeStrings: true, nestedComments: true, dollarQuotes: true}
+	// ClickHouse quotes and comments like MySQL, without the client's DELIMITER command
+	clickhouseSplitRules = splitRules{backslashEscapes: true, backtickQuotes: true, hashComments: true}
+)
+
+const (
+	// defaultDelimiter terminates statements until a DELIMITER command changes it
+	defaultDelimiter = ";"
+	// delimiterKeyword starts a MySQL client command that changes the statement terminator
+	delimiterKeyword = "DELIMITER"
+	// definerKeyword starts the MySQL DEFINER = user@host clause of a routine definition
+	definerKeyword = "DEFINER"
+)
+
+// routineKeywords follow CREATE in definitions whose body is a BEGIN ... END block of several statements
+var routineKeywords = map[string]bool{"TRIGGER": true, "PROCEDURE": true, "FUNCTION": true, "EVENT": true}
+
+// routineModifiers may stand between CREATE and the routine keyword, e.g. CREATE OR REPLACE TEMP TRIGGER
+var routineModifiers = map[string]bool{
+	"OR": true, "REPLACE": true, "TEMP": true, "TEMPORARY": true, "CONSTRAINT": true, "AGGREGATE": true, definerKeyword: true,
+}
+
+// routineState is what the header of the current statement says about a routine body
+type routineState int
+
+const (
+	// routineUndecided: the header has not yet shown whether the statement defines a routine
+	routineUndecided routineState = iota
+	// routineBody: the statement defines a trigger, procedure, function or event, its BEGIN ... END blocks are tracked
+	routineBody
+	// routineNone: any other statement, a semicolon always ends it
+	routineNone
+)
+
+// controlBlockKeywords close with END IF, END LOOP and so on, without opening a BEGIN block
+var controlBlockKeywords = map[string]bool{"IF": true, "LOOP": true, "WHILE": true, "REPEAT": true}
+
+// sqlSplitter tokenizes a script once, front to back, and collects its statements.
+// Semicolons only end a statement outside of strings, quoted identifiers, comments,
+// dollar quotes and the BEGIN ... END body of a trigger, procedure or function.
+type sqlSplitter struct {
+	rules      splitRules
+	src        string
+	pos        int
+	delimiter  string
+	current    strings.Builder
+	hasCode    bool         // the current statement has more than comments and whitespace
+	keywords   []string     // keywords of the statement header read so far
+	routine    routineState // whether the current statement defines a routine
+	definer    bool         // the header is inside a DEFINER = user@host clause
+	parens     int          // open parentheses of the current statement
+	depth      int          // open BEGIN and CASE blocks of a routine body
+	skipWord   bool         // the next keyword belongs to END CASE and must not open a block
+	statements []string
+}
+
+// splitSQL splits a script into statements, without their terminators, in execution order.
+// Comments before a statement stay attached to it, trailing comments are dropped.
+func splitSQL(content string, rules splitRules) []string {
+	s := &sqlSplitter{rules: rules, src: content, delimiter: defaultDelimiter}
+
+	for s.pos < len(s.src) {
+		if s.rules.delimiterCommand && !s.hasCode && s.atLineStart() && s.readDelimiterCommand() {
+			continue
+		}
+
+		// A custom delimiter is spelled out by the author, so it ends a statement even inside a body
+		if strings.HasPrefix(s.src[s.pos:], s.delimiter) && (s.depth == 0 || s.delimiter != defaultDelimiter) {
+			s.pos += len(s.delimiter)
+			s.flush()
+			continue
+		}
+
+		s.next()
+	}
+	s.flush()
+
+	return s.statements
+}
+
+// next consumes one token starting at the current position
+func (s *sqlSplitter) next() {
+	c := s.src[s.pos]
+	rest := s.src[s.pos:]
+
+	switch {
+	case strings.HasPrefix(rest, "--"), c == '#' && s.rules.hashComments:
+		s.copyUntil(s.lineEnd())
+	case strings.HasPrefix(rest, "/*"):
+		s.copyUntil(s.blockCommentEnd())
+	case c == '\'':
+		s.copyQuoted('\'', s.rules.backslashEscapes || s.rules.escapeStrings && s.isEscapeString())
+	case c == '"':
+		// MySQL reads double quotes as strings, with the same escapes as single quotes
+		s.copyQuoted('"', s.rules.backslashEscapes)
+	case c == '`' && s.rules.backtickQuotes:
+		s.copyQuoted('`', false)
+	case c == '[' && s.rules.bracketQuotes:
+		s.copyQuoted(']', false)
+	case c == '$' && s.rules.dollarQuotes && s.dollarTag() != "":
+		s.copyDollarQuoted(s.dollarTag())
+	case isWordStart(c) && !s.followsWord():
+		s.copyWord()
+	case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		s.copyUntil(s.pos + 1)
+	default:
+		s.hasCode = true
+		switch c {
+		case '(':
+			s.parens++
+		case ')':
+			s.parens--
+		}
+		s.copyUntil(s.pos + 1)
+	}
+}
+
+// flush ends the current statement, dropping it when it holds nothing but comments
+func (s *sqlSplitter) flush() {
+	if statement := strings.TrimSpace(s.current.String()); s.hasCode && statement != "" {
+		s.statements = append(s.statements, statement)
+	}
+	s.current.Reset()
+	s.hasCode = false
+	s.keywords = nil
+	s.routine = routineUndecided
+	s.definer = false
+	s.parens = 0
+	s.depth = 0
+	s.skipWord = false
+}
+
+// copyUntil appends the source up to end to the current statement
+func (s *sqlSplitter) copyUntil(end int) {
+	if end > len(s.src) {
+		end = len(s.src)
+	}
+	s.current.WriteString(s.src[s.pos:end])
+	s.pos = end
+}
+
+// copyQuoted appends a string or quoted identifier; a doubled closing quote is part of it
+func (s *sqlSplitter) copyQuoted(closing byte, backslashEscapes bool) {
+	s.hasCode = true
+	end := s.pos + 1
+	for end < len(s.src) {
+		switch {
+		case backslashEscapes && s.src[end] == '\\':
+			end += 2
+			continue
+		case s.src[end] == closing && end+1 < len(s.src) && s.src[end+1] == closing:
+			end += 2
+			continue
+		case s.src[end] == closing:
+			s.copyUntil(end + 1)
+			return
+		}
+		end++
+	}
+	// An unterminated string runs to the end of the script, the database reports it
+	s.copyUntil(len(s.src))
+}
+
+// copyDollarQuoted appends a dollar-quoted body, which ends only at the same tag
+func (s *sqlSplitter) copyDollarQuoted(tag string) {
+	s.hasCode = true
+	if end := strings.Index(s.src[s.pos+len(tag):], tag); end >= 0 {
+		s.copyUntil(s.pos + len(tag) + end + len(tag))
+		return
+	}
+	s.copyUntil(len(s.src))
+}
+
+// copyWord appends a keyword or identifier and tracks the blocks of routine bodies
+func (s *sqlSplitter) copyWord() {
+	s.hasCode = true
+	start, end := s.pos, s.pos
+	for end < len(s.src) && isWordPart(s.src[end]) {
+		end++
+	}
+	word := strings.ToUpper(s.src[s.pos:end])
+	s.copyUntil(end)
+
+	// Words in parentheses, such as a column named trigger, never belong to the header
+	if s.routine == routineUndecided && s.parens == 0 {
+		s.routine = s.classifyHeader(word, start, end)
+		s.keywords = append(s.keywords, word)
+	}
+	if s.skipWord {
+		s.skipWord = false
+		return
+	}
+	if s.routine != routineBody {
+		return
+	}
+
+	switch word {
+	case "BEGIN":
+		s.depth++
+	case "CASE":
+		// CASE ... END inside a body would otherwise close its BEGIN block early
+		if s.depth > 0 {
+			s.depth++
+		}
+	case "END":
+		following := s.peekWord()
+		if s.depth > 0 && !controlBlockKeywords[following] {
+			s.depth--
+			s.skipWord = following == "CASE"
+		}
+	}
+}
+
+// classifyHeader decides from the next header word whether the statement defines a routine.
+// Only CREATE [OR REPLACE] [DEFINER = user@host] [TEMP] followed straight by a routine keyword does.
+func (s *sqlSplitter) classifyHeader(word string, start, end int) routineState {
+	if len(s.keywords) == 0 {
+		if word == "CREATE" {
+			return routineUndecided
+		}
+		return routineNone
+	}
+
+	switch {
+	case routineKeywords[word]:
+		return routineBody
+	case s.definer && s.isDefinerValue(start, end):
+		return routineUndecided
+	case routineModifiers[word]:
+		s.definer = word == definerKeyword
+		return routineUndecided
+	}
+	return routineNone
+}
+
+// isDefinerValue reports whether the word at start:end is part of an unquoted user@host or CURRENT_USER value
+func (s *sqlSplitter) isDefinerValue(start, end int) bool {
+	before := start - 1
+	for before >= 0 && strings.IndexByte(" \t\r\n", s.src[before]) >= 0 {
+		before--
+	}
+	if before >= 0 && (s.src[before] == '=' || s.src[before] == '@') {
+		return true
+	}
+	return end < len(s.src) && s.src[end] == '@'
+}
+
+// peekWord returns the next keyword after whitespace without consuming it
+func (s *sqlSplitter) peekWord() string {
+	start := s.pos
+	for start < len(s.src) && strings.IndexByte(" \t\r\n", s.src[start]) >= 0 {
+		start++
+	}
+	end := start
+	for end < len(s.src) && isWordPart(s.src[end]) {
+		end++
+	}
+	return strings.ToUpper(s.src[start:end])
+}
+
+// readDelimiterCommand consumes a MySQL DELIMITER line and switches the terminator
+func (s *sqlSplitter) readDelimiterCommand() bool {
+	end := s.lineEnd()
+	fields := strings.Fields(s.src[s.pos:end])
+	if len(fields) != 2 || !strings.EqualFold(fields[0], delimiterKeyword) {
+		return false
+	}
+
+	// The command is for the client and never sent to the database
+	s.flush()
+	s.delimiter = fields[1]
+	s.pos = end
+	return true
+}
+
+// atLineStart reports whether only blanks precede the current position on its line
+func (s *sqlSplitter) atLineStart() bool {
+	for i := s.pos - 1; i >= 0 && s.src[i] != '\n'; i-- {
+		if s.src[i] != ' ' && s.src[i] != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// lineEnd returns the position of the next newline or the end of the script
+func (s *sqlSplitter) lineEnd() int {
+	if end := strings.IndexByte(s.src[s.pos:], '\n'); end >= 0 {
+		return s.pos + end
+	}
+	return len(s.src)
+}
+
+// blockCommentEnd returns the position after the comment starting at the current position
+func (s *sqlSplitter) blockCommentEnd() int {
+	depth := 0
+	for i := s.pos; i+1 < len(s.src); i++ {
+		switch {
+		case s.src[i] == '/' && s.src[i+1] == '*':
+			if depth > 0 && !s.rules.nestedComments {
+				continue
+			}
+			depth++
+			i++
+		case s.src[i] == '*' && s.src[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s.src)
+}
+
+// dollarTag returns the $tag$ starting at the current position, empty for parameters such as $1
+func (s *sqlSplitter) dollarTag() string {
+	if s.followsWord() {
+		return ""
+	}
+	end := s.pos + 1
+	for end < len(s.src) && isWordPart(s.src[end]) {
+		if end == s.pos+1 && !isWordStart(s.src[end]) {
+			return ""
+		}
+		end++
+	}
+	if end < len(s.src) && s.src[end] == '$' {
+		return s.src[s.pos : end+1]
+	}
+	return ""
+}
+
+// isEscapeString reports whether the quote at the current position opens a PostgreSQL E'...' string
+func (s *sqlSplitter) isEscapeString() bool {
+	if s.pos == 0 || (s.src[s.pos-1] != 'E' && s.src[s.pos-1] != 'e') {
+		return false
+	}
+	return s.pos == 1 || !isWordPart(s.src[s.pos-2])
+}
+
+// followsWord reports whether the current position continues an identifier, e.g. the $ in a$b
+func (s *sqlSplitter) followsWord() bool {
+	return s.pos > 0 && (isWordPart(s.src[s.pos-1]) || s.src[s.pos-1] == '$')
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || c >= '0' && c <= '9'
+}
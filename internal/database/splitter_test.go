@@ -0,0 +1,209 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		sql    string
+		want   []string
+	}{
+		// SQLite
+		{
+			name:   "sqlite/plain statements",
+			driver: constants.DriverSQLite,
+			sql:    "CREATE TABLE a (id INTEGER);\nINSERT INTO a VALUES (1);\n",
+			want:   []string{"CREATE TABLE a (id INTEGER)", "INSERT INTO a VALUES (1)"},
+		},
+		{
+			name:   "sqlite/semicolons in strings and quoted identifiers",
+			driver: constants.DriverSQLite,
+			sql:    "INSERT INTO a VALUES ('x;y', 'it''s;'); SELECT [a;b], `c;d`, \"e;f\" FROM a;",
+			want:   []string{"INSERT INTO a VALUES ('x;y', 'it''s;')", "SELECT [a;b], `c;d`, \"e;f\" FROM a"},
+		},
+		{
+			name:   "sqlite/trigger body",
+			driver: constants.DriverSQLite,
+			sql:    "CREATE TRIGGER trg AFTER INSERT ON a BEGIN UPDATE b SET n = n + 1; DELETE FROM c; END;\nSELECT 1;",
+			want:   []string{"CREATE TRIGGER trg AFTER INSERT ON a BEGIN UPDATE b SET n = n + 1; DELETE FROM c; END", "SELECT 1"},
+		},
+		{
+			name:   "sqlite/temp trigger with case expression",
+			driver: constants.DriverSQLite,
+			sql:    "CREATE TEMP TRIGGER IF NOT EXISTS trg AFTER UPDATE ON a BEGIN UPDATE b SET s = CASE WHEN NEW.x > 0 THEN 'up' ELSE 'down' END; END; SELECT 2;",
+			want: []string{
+				"CREATE TEMP TRIGGER IF NOT EXISTS trg AFTER UPDATE ON a BEGIN UPDATE b SET s = CASE WHEN NEW.x > 0 THEN 'up' ELSE 'down' END; END",
+				"SELECT 2",
+			},
+		},
+		{
+			name:   "sqlite/keyword-named columns",
+			driver: constants.DriverSQLite,
+			sql:    "CREATE TABLE logs (id INTEGER, trigger TEXT, begin TEXT); SELECT 1; SELECT 2;",
+			want:   []string{"CREATE TABLE logs (id INTEGER, trigger TEXT, begin TEXT)", "SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "sqlite/index on keyword-named column",
+			driver: constants.DriverSQLite,
+			sql:    "CREATE INDEX idx_logs_trigger ON logs (trigger); UPDATE logs SET begin = 'x' WHERE trigger = 'y'; SELECT 1;",
+			want:   []string{"CREATE INDEX idx_logs_trigger ON logs (trigger)", "UPDATE logs SET begin = 'x' WHERE trigger = 'y'", "SELECT 1"},
+		},
+		{
+			name:   "sqlite/transaction keywords are not a routine",
+			driver: constants.DriverSQLite,
+			sql:    "BEGIN; UPDATE a SET x = 1; END;",
+			want:   []string{"BEGIN", "UPDATE a SET x = 1", "END"},
+		},
+		{
+			name:   "sqlite/comments",
+			driver: constants.DriverSQLite,
+			sql:    "-- header; not a statement\n/* block; comment */ SELECT 1;\n-- trailing comment;",
+			want:   []string{"-- header; not a statement\n/* block; comment */ SELECT 1"},
+		},
+
+		// MySQL
+		{
+			name:   "mysql/delimiter block",
+			driver: constants.DriverMySQL,
+			sql:    "DELIMITER //\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END //\nDELIMITER ;\nSELECT 3;",
+			want:   []string{"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", "SELECT 3"},
+		},
+		{
+			name:   "mysql/delimiter with several statements",
+			driver: constants.DriverMySQL,
+			sql:    "DELIMITER $$\nCREATE FUNCTION f() RETURNS INT DETERMINISTIC BEGIN RETURN 1; END$$\nSELECT f()$$\nDELIMITER ;",
+			want:   []string{"CREATE FUNCTION f() RETURNS INT DETERMINISTIC BEGIN RETURN 1; END", "SELECT f()"},
+		},
+		{
+			name:   "mysql/trigger body with control blocks",
+			driver: constants.DriverMySQL,
+			sql: "CREATE TRIGGER trg BEFORE INSERT ON a FOR EACH ROW BEGIN IF NEW.n < 0 THEN SET NEW.n = 0; END IF; " +
+				"CASE NEW.s WHEN 'x' THEN SET NEW.n = 1; ELSE SET NEW.n = 2; END CASE; END; SELECT 1;",
+			want: []string{
+				"CREATE TRIGGER trg BEFORE INSERT ON a FOR EACH ROW BEGIN IF NEW.n < 0 THEN SET NEW.n = 0; END IF; " +
+					"CASE NEW.s WHEN 'x' THEN SET NEW.n = 1; ELSE SET NEW.n = 2; END CASE; END",
+				"SELECT 1",
+			},
+		},
+		{
+			name:   "mysql/definer clauses",
+			driver: constants.DriverMySQL,
+			sql: "CREATE DEFINER=`root`@`%` PROCEDURE p() BEGIN SELECT 1; END; " +
+				"CREATE DEFINER = root@localhost TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.n = 1; END; " +
+				"CREATE DEFINER=CURRENT_USER EVENT e ON SCHEDULE EVERY 1 DAY DO BEGIN DELETE FROM a; END;",
+			want: []string{
+				"CREATE DEFINER=`root`@`%` PROCEDURE p() BEGIN SELECT 1; END",
+				"CREATE DEFINER = root@localhost TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.n = 1; END",
+				"CREATE DEFINER=CURRENT_USER EVENT e ON SCHEDULE EVERY 1 DAY DO BEGIN DELETE FROM a; END",
+			},
+		},
+		{
+			name:   "mysql/definer view is not a routine",
+			driver: constants.DriverMySQL,
+			sql:    "CREATE DEFINER=`root`@`%` VIEW v AS SELECT `begin`, `end` FROM a; SELECT 1;",
+			want:   []string{"CREATE DEFINER=`root`@`%` VIEW v AS SELECT `begin`, `end` FROM a", "SELECT 1"},
+		},
+		{
+			name:   "mysql/keyword-named columns",
+			driver: constants.DriverMySQL,
+			sql:    "CREATE TABLE events (id INT, event VARCHAR(10), `trigger` TEXT, begin INT); SELECT 1; SELECT 2;",
+			want:   []string{"CREATE TABLE events (id INT, event VARCHAR(10), `trigger` TEXT, begin INT)", "SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "mysql/backslash escapes and double-quoted strings",
+			driver: constants.DriverMySQL,
+			sql:    "INSERT INTO a VALUES ('it\\'s;', \"say \\\";\"); SELECT 1;",
+			want:   []string{"INSERT INTO a VALUES ('it\\'s;', \"say \\\";\")", "SELECT 1"},
+		},
+		{
+			name:   "mysql/hash comments",
+			driver: constants.DriverMySQL,
+			sql:    "# setup; not a statement\nSELECT 1; # trailing;\nSELECT 2;",
+			want:   []string{"# setup; not a statement\nSELECT 1", "# trailing;\nSELECT 2"},
+		},
+
+		// PostgreSQL
+		{
+			name:   "postgres/dollar-quoted function body",
+			driver: constants.DriverPostgres,
+			sql:    "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql;\nSELECT f();",
+			want:   []string{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql", "SELECT f()"},
+		},
+		{
+			name:   "postgres/tagged dollar quotes",
+			driver: constants.DriverPostgres,
+			sql:    "CREATE FUNCTION g() RETURNS text AS $fn$ SELECT $$a;b$$; $fn$ LANGUAGE sql; SELECT 2;",
+			want:   []string{"CREATE FUNCTION g() RETURNS text AS $fn$ SELECT $$a;b$$; $fn$ LANGUAGE sql", "SELECT 2"},
+		},
+		{
+			name:   "postgres/positional parameters are not dollar quotes",
+			driver: constants.DriverPostgres,
+			sql:    "PREPARE p (int) AS SELECT $1; EXECUTE p(1);",
+			want:   []string{"PREPARE p (int) AS SELECT $1", "EXECUTE p(1)"},
+		},
+		{
+			name:   "postgres/nested comments",
+			driver: constants.DriverPostgres,
+			sql:    "/* outer /* inner; */ still comment; */ SELECT 1; SELECT 2;",
+			want:   []string{"/* outer /* inner; */ still comment; */ SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "postgres/escape strings",
+			driver: constants.DriverPostgres,
+			sql:    "SELECT E'it\\'s;'; SELECT e'a\\\\'; SELECT 3;",
+			want:   []string{"SELECT E'it\\'s;'", "SELECT e'a\\\\'", "SELECT 3"},
+		},
+		{
+			name:   "postgres/standard strings keep backslashes",
+			driver: constants.DriverPostgres,
+			sql:    "SELECT 'a\\'; SELECT 2;",
+			want:   []string{"SELECT 'a\\'", "SELECT 2"},
+		},
+		{
+			name:   "postgres/begin atomic body",
+			driver: constants.DriverPostgres,
+			sql:    "CREATE OR REPLACE FUNCTION h() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END; SELECT 3;",
+			want:   []string{"CREATE OR REPLACE FUNCTION h() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END", "SELECT 3"},
+		},
+		{
+			name:   "postgres/keyword-named columns",
+			driver: constants.DriverPostgres,
+			sql:    "CREATE TABLE t (function TEXT, \"trigger\" TEXT, procedure TEXT); SELECT 1; SELECT 2;",
+			want:   []string{"CREATE TABLE t (function TEXT, \"trigger\" TEXT, procedure TEXT)", "SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "postgres/transaction block",
+			driver: constants.DriverPostgres,
+			sql:    "BEGIN; UPDATE a SET x = 1; COMMIT;",
+			want:   []string{"BEGIN", "UPDATE a SET x = 1", "COMMIT"},
+		},
+
+		// ClickHouse
+		{
+			name:   "clickhouse/escaped quote and hash comment",
+			driver: constants.DriverClickHouse,
+			sql:    "CREATE TABLE t (s String DEFAULT 'it\\'s; fine') ENGINE = MergeTree ORDER BY s; # not; a statement\nSELECT 1;",
+			want:   []string{"CREATE TABLE t (s String DEFAULT 'it\\'s; fine') ENGINE = MergeTree ORDER BY s", "# not; a statement\nSELECT 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialect, err := LookupDialect(tt.driver)
+			if err != nil {
+				t.Fatalf("LookupDialect(%q): %v", tt.driver, err)
+			}
+
+			got := dialect.SplitStatements(tt.sql)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitStatements() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
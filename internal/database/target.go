@@ -0,0 +1,146 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// Target is a named database migrated separately from the default one,
+// with its own connection, migration folder and history table
+type Target struct {
+	Name       string `yaml:"-"`
+	Connection string `yaml:"connection"`
+	Path       string `yaml:"path"`
+	Table      string `yaml:"table"`
+	Protected  bool   `yaml:"protected"`
+}
+
+// elsaConfig is the migration section of .elsa-config.yaml
+type elsaConfig struct {
+	Migration struct {
+		Targets   map[string]Target  `yaml:"targets"`
+		Protected []string           `yaml:"protected"`
+		Hooks     map[string]HookSet `yaml:"hooks"`
+	} `yaml:"migration"`
+}
+
+// loadElsaConfig reads .elsa-config.yaml, a missing file is an empty config
+func loadElsaConfig() (elsaConfig, error) {
+	var config elsaConfig
+
+	content, err := os.ReadFile(constants.ElsaConfigFile)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf(constants.ErrFailedReadElsaConfig, constants.ElsaConfigFile, err)
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf(constants.ErrFailedReadElsaConfig, constants.ElsaConfigFile, err)
+	}
+
+	return config, nil
+}
+
+// ProtectedPatterns returns the host and database name patterns listed under migration.protected in .elsa-config.yaml
+func ProtectedPatterns() ([]string, error) {
+	config, err := loadElsaConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Migration.Protected, nil
+}
+
+// ProtectedByEnv reports whether ELSA_PROTECTED marks the current environment, e.g. from .env.production
+func ProtectedByEnv() bool {
+	// Values from .env are only visible once it has been loaded into the environment
+	loadDotEnv()
+
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(constants.ProtectedEnvVar)))
+	return value == "1" || value == "true" || value == "yes"
+}
+
+// LoadTargets returns the targets declared in .elsa-config.yaml and by MIGRATE_CONNECTION_<NAME> variables, sorted by name.
+// Environment variables override the connection, path and table of a target with the same name.
+func LoadTargets() ([]Target, error) {
+	targets := make(map[string]Target)
+
+	config, err := loadElsaConfig()
+	if err != nil {
+		return nil, err
+	}
+	for name, target := range config.Migration.Targets {
+		target.Name = strings.ToLower(name)
+		target.Connection = os.ExpandEnv(target.Connection)
+		targets[target.Name] = target
+	}
+
+	// Values from .env are only visible once it has been loaded into the environment
+	loadDotEnv()
+
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(key, constants.TargetConnectionEnvPrefix) || value == "" {
+			continue
+		}
+
+		suffix := strings.TrimPrefix(key, constants.TargetConnectionEnvPrefix)
+		name := strings.ToLower(suffix)
+		target := targets[name]
+		target.Name = name
+		target.Connection = value
+		if path := os.Getenv(constants.TargetPathEnvPrefix + suffix); path != "" {
+			target.Path = path
+		}
+		if table := os.Getenv(constants.TargetTableEnvPrefix + suffix); table != "" {
+			target.Table = table
+		}
+		targets[name] = target
+	}
+
+	result := make([]Target, 0, len(targets))
+	for _, target := range targets {
+		if target.Path == "" {
+			target.Path = filepath.Join(constants.DefaultMigrationBaseDir, constants.DefaultMigrationDir, target.Name)
+		}
+		if target.Table == "" {
+			target.Table = constants.MigrationsTableName
+		}
+		result = append(result, target)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// LookupTarget returns the configured target with the given name
+func LookupTarget(name string) (*Target, error) {
+	targets, err := LoadTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, target := range targets {
+		if target.Name == strings.ToLower(name) {
+			if target.Connection == "" {
+				return nil, fmt.Errorf(constants.ErrTargetNoConnection, target.Name)
+			}
+			return &target, nil
+		}
+		names = append(names, target.Name)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf(constants.ErrNoTargetsConfigured, constants.ElsaConfigFile, constants.TargetConnectionEnvPrefix)
+	}
+	return nil, fmt.Errorf(constants.ErrUnknownTarget, name, strings.Join(names, ", "))
+}
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS migrations (
+		id UInt64 DEFAULT toUInt64(toUnixTimestamp64Nano(now64(9))),
+		migration_id String,
+		name String,
+		type String,
+		applied_at DateTime64(3),
+		checksum String,
+		execution_time Int64,
+		batch Int32 DEFAULT 0,
+		out_of_order Bool DEFAULT false
+	) ENGINE = MergeTree ORDER BY migration_id;
+
+CREATE TABLE IF NOT EXISTS migrations_audit (
+		id UInt64,
+		command String,
+		operator String,
+		forced Bool,
+		status String,
+		error Nullable(String),
+		started_at DateTime64(3),
+		finished_at Nullable(DateTime64(3))
+	) ENGINE = MergeTree ORDER BY id;
+
+CREATE TABLE IF NOT EXISTS migrations_checkpoints (
+		migration_file String,
+		checksum String,
+		last_key Int64,
+		rows_done Int64,
+		updated_at DateTime64(3)
+	) ENGINE = MergeTree ORDER BY migration_file;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS migrations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		migration_id TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		applied_at DATETIME NOT NULL,
+		checksum TEXT NOT NULL,
+		execution_time INTEGER NOT NULL,
+		batch INTEGER NOT NULL DEFAULT 0,
+		out_of_order BOOLEAN NOT NULL DEFAULT FALSE
+	);
+
+CREATE TABLE IF NOT EXISTS migrations_audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		command TEXT NOT NULL,
+		operator TEXT NOT NULL,
+		forced BOOLEAN NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME
+	);
+
+CREATE TABLE IF NOT EXISTS migrations_checkpoints (
+		migration_file TEXT NOT NULL PRIMARY KEY,
+		checksum TEXT NOT NULL,
+		last_key INTEGER NOT NULL,
+		rows_done INTEGER NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
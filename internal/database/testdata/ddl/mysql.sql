@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS migrations (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		migration_id VARCHAR(255) NOT NULL UNIQUE,
+		name VARCHAR(255) NOT NULL,
+		type VARCHAR(10) NOT NULL,
+		applied_at DATETIME(3) NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		execution_time BIGINT NOT NULL,
+		batch INT NOT NULL DEFAULT 0,
+		out_of_order BOOLEAN NOT NULL DEFAULT FALSE
+	);
+
+CREATE TABLE IF NOT EXISTS migrations_audit (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		command VARCHAR(255) NOT NULL,
+		operator VARCHAR(255) NOT NULL,
+		forced BOOLEAN NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		error TEXT,
+		started_at DATETIME(3) NOT NULL,
+		finished_at DATETIME(3) NULL
+	);
+
+CREATE TABLE IF NOT EXISTS migrations_checkpoints (
+		migration_file VARCHAR(255) NOT NULL PRIMARY KEY,
+		checksum VARCHAR(64) NOT NULL,
+		last_key BIGINT NOT NULL,
+		rows_done BIGINT NOT NULL,
+		updated_at DATETIME(3) NOT NULL
+	);
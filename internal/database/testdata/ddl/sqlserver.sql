@@ -0,0 +1,30 @@
+IF OBJECT_ID(N'migrations', N'U') IS NULL CREATE TABLE migrations (
+		id BIGINT IDENTITY(1,1) PRIMARY KEY,
+		migration_id NVARCHAR(255) NOT NULL UNIQUE,
+		name NVARCHAR(255) NOT NULL,
+		type NVARCHAR(10) NOT NULL,
+		applied_at DATETIME2(3) NOT NULL,
+		checksum NVARCHAR(64) NOT NULL,
+		execution_time BIGINT NOT NULL,
+		batch INT NOT NULL DEFAULT 0,
+		out_of_order BIT NOT NULL DEFAULT 0
+	);
+
+IF OBJECT_ID(N'migrations_audit', N'U') IS NULL CREATE TABLE migrations_audit (
+		id BIGINT IDENTITY(1,1) PRIMARY KEY,
+		command NVARCHAR(255) NOT NULL,
+		operator NVARCHAR(255) NOT NULL,
+		forced BIT NOT NULL,
+		status NVARCHAR(20) NOT NULL,
+		error NVARCHAR(MAX),
+		started_at DATETIME2(3) NOT NULL,
+		finished_at DATETIME2(3) NULL
+	);
+
+IF OBJECT_ID(N'migrations_checkpoints', N'U') IS NULL CREATE TABLE migrations_checkpoints (
+		migration_file NVARCHAR(255) NOT NULL PRIMARY KEY,
+		checksum NVARCHAR(64) NOT NULL,
+		last_key BIGINT NOT NULL,
+		rows_done BIGINT NOT NULL,
+		updated_at DATETIME2(3) NOT NULL
+	);
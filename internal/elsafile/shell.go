@@ -37,6 +37,19 @@ func (se *ShellExecutor) ExecuteCommand(command string) error {
 	return cmd.Run()
 }
 
+// ExecuteCommandWithEnv executes a shell command with extra environment variables on top of the current environment
+func (se *ShellExecutor) ExecuteCommandWithEnv(command string, env []string) error {
+	shell, args := se.GetShellInfo()
+
+	cmd := exec.Command(shell, append(args, command)...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+
+	return cmd.Run()
+}
+
 // ExecuteCommandWithOutput executes a shell command and returns the output
 func (se *ShellExecutor) ExecuteCommandWithOutput(command string) (string, error) {
 	var shell string
@@ -100,17 +100,11 @@ func (tm *TemplateManager) resolveTemplatePath(templateConfig MakeConfig, source
 	templateType := tm.extractTemplateType(templateConfig.Template)
 	templateFile := tm.extractTemplateFile(templateConfig.Template)
 
-	// Priority 1: Local .stub directory (for development/testing)
-	localStubPath := filepath.Join(".", ".stub", templateType, templateFile)
-	if tm.templateExists(localStubPath) {
-		return localStubPath
+	// Priority 1 and 2: Local .stub directory, then the filestub cache unless a refresh is requested
+	if templatePath, found := tm.findTemplatePath(templateType, templateFile, sourceInfo, refresh); found {
+		return templatePath
 	}
-
-	// Priority 2: Filestub cache (new structure)
 	filestubPath := tm.getFilestubCachePath(sourceInfo.GitURL, sourceInfo.GitCommit, templateType, templateFile)
-	if !refresh && tm.templateExists(filestubPath) {
-		return filestubPath
-	}
 
 	// Priority 3: Try to clone .stub if not found in filestub cache or if refresh is requested
 	if refresh {
@@ -152,7 +146,57 @@ func (tm *TemplateManager) resolveTemplatePath(templateConfig MakeConfig, source
 	}
 
 	// Fallback to local .stub
-	return localStubPath
+	return localStubPath(templateType, templateFile)
+}
+
+// findTemplatePath looks a template up without cloning: the local .stub directory first,
+// then the filestub cache of the configured commit unless skipCache is set
+func (tm *TemplateManager) findTemplatePath(templateType, templateFile string, sourceInfo SourceInfo, skipCache bool) (string, bool) {
+	localPath := localStubPath(templateType, templateFile)
+	if tm.templateExists(localPath) {
+		return localPath, true
+	}
+
+	if skipCache {
+		return "", false
+	}
+	filestubPath := tm.getFilestubCachePath(sourceInfo.GitURL, sourceInfo.GitCommit, templateType, templateFile)
+	if filestubPath != "" && tm.templateExists(filestubPath) {
+		return filestubPath, true
+	}
+
+	return "", false
+}
+
+// localStubPath returns the path of a template in the project's own .stub directory
+func localStubPath(templateType, templateFile string) string {
+	return filepath.Join(".", ".stub", templateType, templateFile)
+}
+
+// RenderStub renders a template such as "migration/ddl.up.sql.tmpl" with the given data.
+// It looks the template up like make does, through findTemplatePath, but never clones: found is false when neither has the template, so callers can fall back to built-in content.
+func (tm *TemplateManager) RenderStub(template string, data interface{}) (content []byte, found bool, err error) {
+	var sourceInfo SourceInfo
+	if config, err := tm.LoadProjectConfig("."); err == nil {
+		sourceInfo = config.Source
+	}
+
+	templatePath, found := tm.findTemplatePath(tm.extractTemplateType(template), tm.extractTemplateFile(template), sourceInfo, false)
+	if !found {
+		return nil, false, nil
+	}
+
+	tmpl, err := tm.loadTemplate(templatePath)
+	if err != nil {
+		return nil, true, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, true, fmt.Errorf("failed to execute template %s: %v", templatePath, err)
+	}
+
+	return buf.Bytes(), true, nil
 }
 
 // templateExists checks if template exists
@@ -0,0 +1,243 @@
+package migrate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+// Manifest lists the migrations of a bundle, stored as manifest.json at its root.
+type Manifest struct {
+	CreatedAt  time.Time           `json:"created_at"`
+	Migrations []ManifestMigration `json:"migrations"`
+}
+
+// ManifestMigration is one migration of a bundle.
+type ManifestMigration struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Checksum is what the migration history records when the migration is applied
+	Checksum string `json:"checksum"`
+	// Files maps every file of the migration inside the bundle to its SHA-256
+	Files map[string]string `json:"files"`
+}
+
+// BundleFormat returns the bundle format a file name asks for: tar.gz, tar or zip, empty when the extension is unknown.
+func BundleFormat(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return constants.BundleFormatTarGz
+	case strings.HasSuffix(name, ".tar"):
+		return constants.BundleFormatTar
+	case strings.HasSuffix(name, ".zip"):
+		return constants.BundleFormatZip
+	}
+	return ""
+}
+
+// BuildManifest lists the DDL and DML migrations of fsys with the checksums of their files.
+func BuildManifest(fsys fs.FS) (*Manifest, error) {
+	manifest := &Manifest{CreatedAt: time.Now().UTC()}
+
+	for _, migrationType := range []string{DDL, DML} {
+		migrations, err := Discover(fsys, migrationType)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, migration := range migrations {
+			content, err := fs.ReadFile(fsys, migration.Path)
+			if err != nil {
+				return nil, fmt.Errorf(constants.ErrFailedReadFile, err)
+			}
+
+			entry := ManifestMigration{
+				ID:       migration.ID,
+				Name:     migration.Name,
+				Type:     migrationType,
+				Checksum: database.GetMigrationChecksum(string(content)),
+				Files:    map[string]string{migration.Path: fileDigest(content)},
+			}
+
+			// Go migrations and fixtures keep both directions in one file
+			if downPath := migration.DownPath(); downPath != migration.Path {
+				down, err := fs.ReadFile(fsys, downPath)
+				if err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return nil, fmt.Errorf(constants.ErrFailedReadFile, err)
+				}
+				if err == nil {
+					entry.Files[downPath] = fileDigest(down)
+				}
+			}
+
+			manifest.Migrations = append(manifest.Migrations, entry)
+		}
+	}
+
+	return manifest, nil
+}
+
+// WriteBundle packages the DDL and DML migrations of fsys with their manifest into w,
+// as a gzipped tar, a tar or a zip depending on format. Files outside the migrations, like the
+// squashed/ archive, are left out.
+func WriteBundle(w io.Writer, fsys fs.FS, format string) (*Manifest, error) {
+	manifest, err := BuildManifest(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedWriteBundle, err)
+	}
+
+	var names []string
+	for _, migration := range manifest.Migrations {
+		for name := range migration.Files {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var writeFile func(name string, content []byte) error
+	var closeArchive func() error
+
+	switch format {
+	case constants.BundleFormatZip:
+		zw := zip.NewWriter(w)
+		writeFile = func(name string, content []byte) error {
+			fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: manifest.CreatedAt})
+			if err != nil {
+				return err
+			}
+			_, err = fw.Write(content)
+			return err
+		}
+		closeArchive = zw.Close
+	case constants.BundleFormatTar, constants.BundleFormatTarGz:
+		var gz *gzip.Writer
+		out := w
+		if format == constants.BundleFormatTarGz {
+			gz = gzip.NewWriter(w)
+			out = gz
+		}
+		tw := tar.NewWriter(out)
+		writeFile = func(name string, content []byte) error {
+			header := &tar.Header{
+				Name:    name,
+				Mode:    constants.BundleFilePerm,
+				Size:    int64(len(content)),
+				ModTime: manifest.CreatedAt,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			_, err := tw.Write(content)
+			return err
+		}
+		closeArchive = func() error {
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			if gz != nil {
+				return gz.Close()
+			}
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf(constants.ErrInvalidBundleFormat, format)
+	}
+
+	if err := writeFile(constants.BundleManifestFile, manifestContent); err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedWriteBundle, err)
+	}
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ErrFailedReadFile, err)
+		}
+		if err := writeFile(name, content); err != nil {
+			return nil, fmt.Errorf(constants.ErrFailedWriteBundle, err)
+		}
+	}
+	if err := closeArchive(); err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedWriteBundle, err)
+	}
+
+	return manifest, nil
+}
+
+// VerifyBundle checks a bundle against its manifest: every listed file must be present and unchanged,
+// and every migration found in the bundle must be listed.
+func VerifyBundle(fsys fs.FS) (*Manifest, error) {
+	content, err := fs.ReadFile(fsys, constants.BundleManifestFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.New(constants.ErrBundleNoManifest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrInvalidBundleManifest, err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf(constants.ErrInvalidBundleManifest, err)
+	}
+
+	listed := make(map[string]bool)
+	for _, migration := range manifest.Migrations {
+		listed[migration.Type+"/"+migration.ID] = true
+
+		for name, digest := range migration.Files {
+			file, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, fmt.Errorf(constants.ErrBundleFileMissing, name)
+			}
+			if fileDigest(file) != digest {
+				return nil, fmt.Errorf(constants.ErrBundleFileModified, name)
+			}
+		}
+	}
+
+	bundled := make(map[string]bool)
+	for _, migrationType := range []string{DDL, DML} {
+		migrations, err := Discover(fsys, migrationType)
+		if err != nil {
+			return nil, err
+		}
+		for _, migration := range migrations {
+			if !listed[migrationType+"/"+migration.ID] {
+				return nil, fmt.Errorf(constants.ErrBundleMigrationNotListed, migration.Path)
+			}
+			bundled[migrationType+"/"+migration.ID] = true
+		}
+	}
+
+	// A listed migration whose files are present is still missing when they are not named as a migration
+	for _, migration := range manifest.Migrations {
+		if !bundled[migration.Type+"/"+migration.ID] {
+			return nil, fmt.Errorf(constants.ErrBundleMigrationNotBundled, migration.ID)
+		}
+	}
+
+	return &manifest, nil
+}
+
+// fileDigest returns the hex SHA-256 of a bundled file
+func fileDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
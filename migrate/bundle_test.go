@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+func TestTarGzBundle(t *testing.T) {
+	// Lay the migrations out on disk the way a project does and bundle them from there
+	dir := t.TempDir()
+	for name, file := range testMigrations() {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, file.Data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "ddl", constants.SquashedArchiveDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ddl", constants.SquashedArchiveDir, "00000_old.up.sql"), []byte("SELECT 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "migrations.tar.gz")
+	var buf bytes.Buffer
+	manifest, err := WriteBundle(&buf, os.DirFS(dir), BundleFormat(bundlePath))
+	if err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+	if err := os.WriteFile(bundlePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, migration := range manifest.Migrations {
+		ids = append(ids, migration.Type+"/"+migration.ID)
+		content := testMigrations()["ddl/"+migration.ID+"_"+migration.Name+".up.sql"].Data
+		if migration.Checksum != database.GetMigrationChecksum(string(content)) {
+			t.Errorf("manifest checksum of %s = %q, want the checksum of its up file", migration.ID, migration.Checksum)
+		}
+	}
+	if !reflect.DeepEqual(ids, []string{"ddl/00001", "ddl/00002"}) {
+		t.Errorf("manifest lists %v, want [ddl/00001 ddl/00002]", ids)
+	}
+
+	fsys, err := OpenSource(constants.SourceSchemeTar + bundlePath)
+	if err != nil {
+		t.Fatalf("OpenSource: %v", err)
+	}
+	if migrations, _ := Discover(fsys, DDL); len(migrations) != 2 {
+		t.Errorf("bundle holds %d DDL migrations, want 2 without the squashed archive", len(migrations))
+	}
+
+	m, db := newTestMigrator(t, fsys)
+	result, err := m.Up(context.Background(), DDL, UpOptions{})
+	if err != nil {
+		t.Fatalf("Up from the bundle: %v", err)
+	}
+	if got := executedIDs(result.Applied); !reflect.DeepEqual(got, []string{"00001", "00002"}) {
+		t.Errorf("Up applied %v, want [00001 00002]", got)
+	}
+	if got := tables(t, db); !reflect.DeepEqual(got, []string{"posts", "users"}) {
+		t.Errorf("tables after Up = %v", got)
+	}
+}
+
+func TestBundleRefusesModifiedFile(t *testing.T) {
+	fsys := testMigrations()
+	manifest, err := BuildManifest(fsys)
+	if err != nil {
+		t.Fatalf("BuildManifest: %v", err)
+	}
+	manifestContent, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Edit a migration after the manifest was written
+	fsys["ddl/00002_create_posts.up.sql"] = sqlFile("DROP TABLE users;\n")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := map[string][]byte{constants.BundleManifestFile: manifestContent}
+	for name, file := range fsys {
+		files[name] = file.Data
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenBundle(buf.Bytes())
+	if err == nil || !strings.Contains(err.Error(), "ddl/00002_create_posts.up.sql") {
+		t.Fatalf("OpenBundle error = %v, want the modified file refused", err)
+	}
+}
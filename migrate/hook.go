@@ -0,0 +1,122 @@
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+	"go.risoftinc.com/elsa/internal/elsafile"
+)
+
+// HookPoint is when a hook runs during a run.
+type HookPoint string
+
+// Hook points, registered per migration type with WithHook.
+const (
+	// BeforeUp runs before a run applies its first migration, AfterUp once all of them are applied.
+	// Up, Redo and Refresh apply migrations; a run with nothing to apply runs neither.
+	BeforeUp HookPoint = constants.HookBeforeUp
+	AfterUp  HookPoint = constants.HookAfterUp
+	// BeforeEach and AfterEach run around every migration applied or rolled back
+	BeforeEach HookPoint = constants.HookBeforeEach
+	AfterEach  HookPoint = constants.HookAfterEach
+)
+
+// Hook is code run at a hook point, a failing hook aborts the run.
+// An AfterEach hook runs once the migration is recorded, so its failure leaves the migration applied.
+type Hook struct {
+	// Name identifies the hook in events and errors, e.g. the command it runs
+	Name string
+	Run  func(run HookRun) error
+}
+
+// HookRun describes the moment a hook runs at; which fields are set depends on Point.
+type HookRun struct {
+	Point HookPoint
+	Type  string
+	// Batch is the batch migrations are applied as, unset while rolling back
+	Batch int
+	// Count is the number of migrations a run applies, for BeforeUp and AfterUp
+	Count int
+	// Migration and Direction are set for BeforeEach and AfterEach, Duration for AfterEach
+	Migration Migration
+	Direction string
+	Duration  time.Duration
+
+	executor *database.MigrationExecutor
+}
+
+// Env returns the metadata of the hook run as ELSA_* environment variables, as passed to command hooks.
+func (r HookRun) Env() []string {
+	env := []string{
+		constants.HookEnvPoint + "=" + string(r.Point),
+		constants.HookEnvType + "=" + r.Type,
+	}
+	if r.Batch > 0 {
+		env = append(env, constants.HookEnvBatch+"="+strconv.Itoa(r.Batch))
+	}
+
+	switch r.Point {
+	case BeforeUp, AfterUp:
+		env = append(env, constants.HookEnvCount+"="+strconv.Itoa(r.Count))
+	case BeforeEach, AfterEach:
+		env = append(env,
+			constants.HookEnvID+"="+r.Migration.ID,
+			constants.HookEnvName+"="+r.Migration.Name,
+			constants.HookEnvDirection+"="+r.Direction,
+		)
+		if r.Point == AfterEach {
+			env = append(env, constants.HookEnvDurationMS+"="+strconv.FormatInt(r.Duration.Milliseconds(), 10))
+		}
+	}
+	return env
+}
+
+// Exec runs SQL on the migrated database, split into statements the way the database expects.
+func (r HookRun) Exec(sql string) error {
+	return r.executor.ExecuteMigration(sql, r.Type)
+}
+
+// CommandHook returns a hook that runs a shell command, with the metadata of the hook run in ELSA_* environment variables.
+func CommandHook(command string) Hook {
+	return Hook{
+		Name: command,
+		Run: func(run HookRun) error {
+			return elsafile.NewShellExecutor().ExecuteCommandWithEnv(command, run.Env())
+		},
+	}
+}
+
+// runHooks runs the hooks registered for the point and type of run, stopping at the first failure
+func (m *Migrator) runHooks(executor *database.MigrationExecutor, run HookRun) error {
+	run.executor = executor
+
+	for _, hook := range m.hooks[run.Type][run.Point] {
+		m.notify(Event{Kind: EventHook, Type: run.Type, Migration: run.Migration, HookPoint: run.Point, Hook: hook.Name})
+
+		if err := hook.Run(run); err != nil {
+			if run.Point == BeforeEach || run.Point == AfterEach {
+				return fmt.Errorf(constants.ErrMigrationHookFailed, run.Type, run.Point, hook.Name, run.Migration.ID, run.Migration.Name, err)
+			}
+			return fmt.Errorf(constants.ErrHookFailed, run.Type, run.Point, hook.Name, err)
+		}
+	}
+	return nil
+}
+
+// aroundUp applies migrations between the BeforeUp and AfterUp hooks of their type
+func (m *Migrator) aroundUp(executor *database.MigrationExecutor, migrationType string, count, batch int, apply func() error) error {
+	run := HookRun{Point: BeforeUp, Type: migrationType, Count: count, Batch: batch}
+	if err := m.runHooks(executor, run); err != nil {
+		return err
+	}
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	run.Point = AfterUp
+	return m.runHooks(executor, run)
+}
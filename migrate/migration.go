@@ -0,0 +1,182 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+// Migration is one migration file found in a migration FS.
+type Migration struct {
+	ID   string
+	Name string
+	// Path is the up file inside the migration FS; Go migrations and fixtures keep both directions in it
+	Path string
+	// Kind is sql, go or fixture
+	Kind string
+	// Squashes lists the IDs a squash baseline replaces, including its own
+	Squashes []string
+	// Env and Tags restrict the migration to environments and tag selections
+	Env  []string
+	Tags []string
+}
+
+// DownPath returns the file inside the migration FS the migration is rolled back from.
+func (m Migration) DownPath() string {
+	if m.Kind != constants.MigrationKindSQL {
+		return m.Path
+	}
+	return strings.Replace(m.Path, constants.UpMigrationExtension, constants.DownMigrationExtension, 1)
+}
+
+// Discover lists the migrations of one type, read from the ddl or dml folder at the root of fsys
+// and sorted by ID. A missing folder has no migrations.
+func Discover(fsys fs.FS, migrationType string) ([]Migration, error) {
+	if err := validateType(migrationType); err != nil {
+		return nil, err
+	}
+
+	files, err := fs.ReadDir(fsys, migrationType)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Migration{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		// SQL migrations come in up/down pairs, Go migrations register both directions in one file
+		// and DML fixtures are rolled back by deleting their rows
+		var baseName, kind string
+		switch {
+		case strings.HasSuffix(file.Name(), constants.UpMigrationExtension):
+			baseName = strings.TrimSuffix(file.Name(), constants.UpMigrationExtension)
+			kind = constants.MigrationKindSQL
+		case database.IsGoMigrationFile(file.Name()):
+			baseName = strings.TrimSuffix(file.Name(), constants.GoMigrationExtension)
+			kind = constants.MigrationKindGo
+		case migrationType == constants.MigrationTypeDML && database.FixtureExtension(file.Name()) != "":
+			baseName = strings.TrimSuffix(file.Name(), database.FixtureExtension(file.Name()))
+			kind = constants.MigrationKindFixture
+		default:
+			continue
+		}
+
+		// Parse filename: 00001_create_table.up.sql, 00001_backfill_data.go or 00001_seed_roles.up.yaml
+		parts := strings.Split(baseName, "_")
+		if len(parts) < 2 {
+			continue
+		}
+
+		migration := Migration{
+			ID:   parts[0],
+			Name: strings.Join(parts[1:], "_"),
+			Path: path.Join(migrationType, file.Name()),
+			Kind: kind,
+		}
+
+		if err := readDirectives(fsys, &migration); err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return database.MigrationIDLess(migrations[i].ID, migrations[j].ID)
+	})
+
+	return migrations, nil
+}
+
+// readDirectives fills in what a migration declares about itself: the IDs a squash baseline replaces
+// and the environments and tags it is restricted to. SQL and Go migrations declare them as directives,
+// fixtures as env and tags keys.
+func readDirectives(fsys fs.FS, migration *Migration) error {
+	if migration.Kind == constants.MigrationKindFixture {
+		// A fixture that does not parse is left unfiltered, applying it reports the error
+		fixture, _, err := loadFixture(fsys, migration.Path)
+		if err == nil {
+			migration.Env = fixture.Env
+			migration.Tags = fixture.Tags
+		}
+		return nil
+	}
+
+	content, err := fs.ReadFile(fsys, migration.Path)
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedReadFile, err)
+	}
+
+	// Squash baselines declare the archived IDs they replace in their header
+	if migration.Kind == constants.MigrationKindSQL {
+		migration.Squashes = database.DirectiveList(string(content), constants.DirectiveSquashed)
+	}
+	migration.Env = database.DirectiveList(string(content), constants.DirectiveEnv)
+	migration.Tags = database.DirectiveList(string(content), constants.DirectiveTags)
+	return nil
+}
+
+// loadFixture reads and parses a fixture migration file
+func loadFixture(fsys fs.FS, name string) (*database.Fixture, []byte, error) {
+	content, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf(constants.ErrFailedReadFile, err)
+	}
+
+	fixture, err := database.ParseFixture(content, database.FixtureFormat(name))
+	if err != nil {
+		return nil, nil, fmt.Errorf(constants.ErrInvalidFixtureFile, name, err)
+	}
+	return fixture, content, nil
+}
+
+// SkipReason returns why a migration is left out of a run for the given environment and tags, empty when it runs.
+// Migrations restricted to environments only run under a listed environment,
+// tagged migrations only when one of their tags is selected. Both compare case-insensitively.
+func SkipReason(migration Migration, env string, tags []string) string {
+	if len(migration.Env) > 0 && !containsFold(migration.Env, env) {
+		return constants.SkipReasonEnv
+	}
+	if len(migration.Tags) > 0 && !containsAnyFold(migration.Tags, tags) {
+		return constants.SkipReasonTags
+	}
+	return ""
+}
+
+// validateType checks a migration type is ddl or dml
+func validateType(migrationType string) error {
+	if migrationType != constants.MigrationTypeDDL && migrationType != constants.MigrationTypeDML {
+		return fmt.Errorf(constants.ErrInvalidMigrationType, migrationType)
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyFold(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if containsFold(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,323 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+	"gorm.io/gorm"
+)
+
+// Migration types, the folders of a migration FS.
+const (
+	DDL = constants.MigrationTypeDDL
+	DML = constants.MigrationTypeDML
+)
+
+// Migrator applies and rolls back the migrations of a migration FS on one database.
+// The FS is laid out like database/migration in an elsa project, with a ddl and a dml folder at its root,
+// so an embed.FS narrowed with fs.Sub works as well as os.DirFS.
+// Every run takes the migration lock, so application instances started together apply each migration once.
+type Migrator struct {
+	executor *database.MigrationExecutor
+	fsys     fs.FS
+	env      string
+	tags     []string
+	lockWait time.Duration
+	goRunner GoRunner
+	observer func(Event)
+	hooks    map[string]map[HookPoint][]Hook
+	limits   database.ExecLimits
+
+	// nonTransactionalWarned reports EventNonTransactional only once
+	nonTransactionalWarned bool
+}
+
+// Option configures a Migrator.
+type Option func(*Migrator)
+
+// WithTable records the migration history in table instead of the default migrations table.
+func WithTable(table string) Option {
+	return func(m *Migrator) {
+		m.executor.WithTable(table)
+	}
+}
+
+// WithEnv selects the environment migrations restricted with the elsa:env directive are matched against.
+// Without it only unrestricted migrations run.
+func WithEnv(env string) Option {
+	return func(m *Migrator) {
+		m.env = env
+	}
+}
+
+// WithTags selects the tagged migrations to run besides the untagged ones.
+func WithTags(tags ...string) Option {
+	return func(m *Migrator) {
+		m.tags = tags
+	}
+}
+
+// WithLockWait sets how long a run waits for another migration run to finish, 30 seconds by default.
+func WithLockWait(wait time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockWait = wait
+	}
+}
+
+// WithGoRunner runs Go migrations that are not registered in this process with runner.
+// Without it such a migration fails, since its functions cannot be called.
+func WithGoRunner(runner GoRunner) Option {
+	return func(m *Migrator) {
+		m.goRunner = runner
+	}
+}
+
+// WithObserver calls observer as a run progresses, for logging.
+func WithObserver(observer func(Event)) Option {
+	return func(m *Migrator) {
+		m.observer = observer
+	}
+}
+
+// WithHook runs hook at point in every run of migrationType, after the hooks already registered there.
+func WithHook(migrationType string, point HookPoint, hook Hook) Option {
+	return func(m *Migrator) {
+		if m.hooks == nil {
+			m.hooks = make(map[string]map[HookPoint][]Hook)
+		}
+		if m.hooks[migrationType] == nil {
+			m.hooks[migrationType] = make(map[HookPoint][]Hook)
+		}
+		m.hooks[migrationType][point] = append(m.hooks[migrationType][point], hook)
+	}
+}
+
+// WithStatementTimeout cancels a migration statement that runs longer than timeout.
+func WithStatementTimeout(timeout time.Duration) Option {
+	return func(m *Migrator) {
+		m.limits.StatementTimeout = timeout
+	}
+}
+
+// WithLockTimeout makes a migration statement give up waiting for a lock after timeout,
+// through lock_timeout on PostgreSQL, lock_wait_timeout on MySQL, busy_timeout on SQLite and LOCK_TIMEOUT on SQL Server.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m *Migrator) {
+		m.limits.LockTimeout = timeout
+	}
+}
+
+// WithRetries retries a migration that lost a lock conflict up to retries times, waiting longer before every retry.
+// A migration in a transaction is retried as a whole, otherwise only the failing statement.
+func WithRetries(retries int) Option {
+	return func(m *Migrator) {
+		m.limits.Retries = retries
+	}
+}
+
+// GoRunner applies or rolls back a Go migration and records it in the migration history,
+// returning how long the migration took.
+type GoRunner func(run GoRun) (time.Duration, error)
+
+// GoRun is one direction of a Go migration handed to a GoRunner.
+type GoRun struct {
+	Migration Migration
+	Type      string
+	Direction string
+	// Content is the source file, recorded as the checksum of the migration
+	Content string
+	// Batch and OutOfOrder are only used when applying
+	Batch      int
+	OutOfOrder bool
+	// StatementTimeout, LockTimeout and Retries are the limits of the Migrator, for the runner to apply in turn
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+	Retries          int
+}
+
+// New returns a Migrator for the migrations in fsys on a GORM connection.
+func New(db *gorm.DB, fsys fs.FS, opts ...Option) *Migrator {
+	m := &Migrator{
+		executor: database.NewMigrationExecutor(db),
+		fsys:     fsys,
+		lockWait: constants.DefaultLockWait,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.executor.WithLimits(m.limits)
+	return m
+}
+
+// NewFromSQL returns a Migrator for the migrations in fsys on a database/sql connection pool.
+// driver names the database: sqlite, mysql, postgres, sqlserver, libsql or clickhouse.
+// A ClickHouse pool should be opened with mutations_sync=2, or rolled back migrations stay listed until their mutation finishes.
+func NewFromSQL(db *sql.DB, driver string, fsys fs.FS, opts ...Option) (*Migrator, error) {
+	gormDB, err := database.ConnectDB(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	return New(gormDB, fsys, opts...), nil
+}
+
+// Migrations lists the migrations of one type in the migration FS.
+func (m *Migrator) Migrations(migrationType string) ([]Migration, error) {
+	return Discover(m.fsys, migrationType)
+}
+
+// SkipReason returns why the environment and tags of the Migrator leave a migration out, empty when it runs.
+func (m *Migrator) SkipReason(migration Migration) string {
+	return SkipReason(migration, m.env, m.tags)
+}
+
+// EventKind identifies what an Event reports.
+type EventKind string
+
+// Events reported to the observer of a Migrator.
+const (
+	// EventSkipped: Count migrations are left out by the environment and tags
+	EventSkipped EventKind = "skipped"
+	// EventReconciled: the Count migrations squashed into Migration are recorded as satisfied by it
+	EventReconciled EventKind = "reconciled"
+	// EventChecksumsUpgraded: the legacy checksums of Count unchanged migrations are re-stamped with SHA-256
+	EventChecksumsUpgraded EventKind = "checksums_upgraded"
+	// EventOutOfOrder: Count migrations older than the newest applied migration Newest are applied
+	EventOutOfOrder EventKind = "out_of_order"
+	// EventApplying: Count migrations are about to be applied as Batch
+	EventApplying EventKind = "applying"
+	// EventRollingBack: Count migrations are about to be rolled back
+	EventRollingBack EventKind = "rolling_back"
+	// EventRedoing: Count migrations are about to be rolled back and applied again
+	EventRedoing EventKind = "redoing"
+	// EventApplied: Migration was applied in Duration
+	EventApplied EventKind = "applied"
+	// EventRolledBack: Migration was rolled back in Duration
+	EventRolledBack EventKind = "rolled_back"
+	// EventMissingFile: the applied Migration has no file and is left in place; only its ID is set
+	EventMissingFile EventKind = "missing_file"
+	// EventNonTransactional: Driver cannot roll back a failed SQL migration, reported once per Migrator
+	EventNonTransactional EventKind = "non_transactional"
+	// EventHook: Hook is about to run at HookPoint, for Migration when it runs around one
+	EventHook EventKind = "hook"
+	// EventRetrying: Migration lost a lock conflict with Err and is retried for the Count-th time after Duration
+	EventRetrying EventKind = "retrying"
+	// EventBatchResumed: the batched Migration resumes from its checkpoint with Count of Total rows done
+	EventBatchResumed EventKind = "batch_resumed"
+	// EventBatchProgress: the batched Migration has worked through Count of Total rows
+	EventBatchProgress EventKind = "batch_progress"
+	// EventBatchFinished: the batched Migration worked through all Count rows
+	EventBatchFinished EventKind = "batch_finished"
+)
+
+// Event reports the progress of a run; which fields are set depends on Kind.
+type Event struct {
+	Kind      EventKind
+	Type      string
+	Migration Migration
+	Count     int
+	Total     int
+	Batch     int
+	Duration  time.Duration
+	Newest    string
+	Driver    string
+	HookPoint HookPoint
+	Hook      string
+	Err       error
+}
+
+// notify reports an event to the observer, if any
+func (m *Migrator) notify(event Event) {
+	if m.observer != nil {
+		m.observer(event)
+	}
+}
+
+// Result is what an Up, Down, Redo or Refresh run did.
+type Result struct {
+	Type string
+	// Batch is the batch the applied migrations were recorded under, or the batch Down rolled back
+	Batch      int
+	Applied    []Executed
+	RolledBack []Executed
+	// Pending lists the selected migrations that are still not applied after the run
+	Pending []Migration
+	// Missing lists applied migrations without a file, which Down leaves in place
+	Missing []string
+	// Skipped lists the migrations the environment and tags left out of the run
+	Skipped []Migration
+}
+
+// Executed is one migration applied or rolled back by a run.
+type Executed struct {
+	Migration  Migration
+	Duration   time.Duration
+	OutOfOrder bool
+}
+
+// UpOptions selects the pending migrations Up applies; the zero value applies all of them.
+type UpOptions struct {
+	// Steps applies only the first Steps pending migrations
+	Steps int
+	// To applies the pending migrations up to and including this ID
+	To string
+	// AllowOutOfOrder applies pending migrations older than the newest applied one instead of failing
+	AllowOutOfOrder bool
+}
+
+// DownOptions selects the applied migrations Down rolls back; the zero value rolls back the newest one.
+type DownOptions struct {
+	// All rolls back every applied migration
+	All bool
+	// Batch rolls back the migrations of one batch, LatestBatch for the newest
+	Batch int
+	// Steps rolls back the newest Steps migrations
+	Steps int
+	// From rolls back the migrations from this ID to the newest
+	From string
+}
+
+// LatestBatch selects the newest batch in DownOptions.
+const LatestBatch = constants.LatestBatch
+
+// Step is one migration file a run would execute, as returned by the Plan methods.
+type Step struct {
+	Migration Migration
+	Direction string
+	// Path is the file inside the migration FS the step executes
+	Path string
+	// Statements are the SQL statements in execution order; Go migrations have a comment instead
+	Statements []string
+	// Checksum is recorded for an up step, Batch and OutOfOrder with it
+	Checksum   string
+	Batch      int
+	OutOfOrder bool
+}
+
+// runExecutor returns the executor of one run, cancelled with ctx
+func (m *Migrator) runExecutor(ctx context.Context) *database.MigrationExecutor {
+	return m.executor.WithContext(ctx)
+}
+
+// locked runs fn while holding the migration lock, with the migrations table in place
+func (m *Migrator) locked(ctx context.Context, fn func(executor *database.MigrationExecutor) error) error {
+	executor := m.runExecutor(ctx)
+	if err := executor.EnsureMigrationTable(); err != nil {
+		return fmt.Errorf(constants.ErrFailedEnsureTable, err)
+	}
+
+	lock, err := executor.AcquireLock(m.lockWait)
+	if err != nil {
+		return err
+	}
+
+	runErr := fn(executor)
+	if err := lock.Release(); err != nil && runErr == nil {
+		return err
+	}
+	return runErr
+}
@@ -0,0 +1,281 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+// newTestDB opens a throwaway SQLite database
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "elsa.db"))
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestMigrator returns a Migrator over fsys on a throwaway SQLite database
+func newTestMigrator(t *testing.T, fsys fs.FS, opts ...Option) (*Migrator, *sql.DB) {
+	t.Helper()
+
+	db := newTestDB(t)
+	m, err := NewFromSQL(db, constants.DriverSQLite, fsys, opts...)
+	if err != nil {
+		t.Fatalf("NewFromSQL: %v", err)
+	}
+	return m, db
+}
+
+// sqlFile is one file of a test migration FS
+func sqlFile(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+// testMigrations has two DDL migrations, the second one depending on the first
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"ddl/00001_create_users.up.sql":   sqlFile("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\n"),
+		"ddl/00001_create_users.down.sql": sqlFile("DROP TABLE users;\n"),
+		"ddl/00002_create_posts.up.sql":   sqlFile("CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id));\nCREATE INDEX idx_posts_user ON posts (user_id);\n"),
+		"ddl/00002_create_posts.down.sql": sqlFile("DROP TABLE posts;\n"),
+	}
+}
+
+// tables returns the user tables of the SQLite database, without the ones elsa keeps its history in
+func tables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'migrations%' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		t.Fatalf("listing tables: %v", err)
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("listing tables: %v", err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// executedIDs returns the IDs of the migrations a run applied or rolled back
+func executedIDs(executed []Executed) []string {
+	ids := []string{}
+	for _, e := range executed {
+		ids = append(ids, e.Migration.ID)
+	}
+	return ids
+}
+
+func TestUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t, testMigrations())
+
+	result, err := m.Up(ctx, constants.MigrationTypeDDL, UpOptions{})
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if got := executedIDs(result.Applied); !reflect.DeepEqual(got, []string{"00001", "00002"}) {
+		t.Errorf("Up applied %v, want [00001 00002]", got)
+	}
+	if result.Batch != 1 {
+		t.Errorf("Up batch = %d, want 1", result.Batch)
+	}
+	if got := tables(t, db); !reflect.DeepEqual(got, []string{"posts", "users"}) {
+		t.Errorf("tables after Up = %v", got)
+	}
+
+	// Nothing is pending, so a second Up is a no-op
+	result, err = m.Up(ctx, constants.MigrationTypeDDL, UpOptions{})
+	if err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+	if len(result.Applied) != 0 {
+		t.Errorf("second Up applied %v", executedIDs(result.Applied))
+	}
+
+	result, err = m.Down(ctx, constants.MigrationTypeDDL, DownOptions{})
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if got := executedIDs(result.RolledBack); !reflect.DeepEqual(got, []string{"00002"}) {
+		t.Errorf("Down rolled back %v, want [00002]", got)
+	}
+	if got := tables(t, db); !reflect.DeepEqual(got, []string{"users"}) {
+		t.Errorf("tables after Down = %v", got)
+	}
+
+	if _, err := m.Down(ctx, constants.MigrationTypeDDL, DownOptions{All: true}); err != nil {
+		t.Fatalf("Down All: %v", err)
+	}
+	if got := tables(t, db); len(got) != 0 {
+		t.Errorf("tables after Down All = %v", got)
+	}
+
+	statuses, err := m.Status(ctx, constants.MigrationTypeDDL)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			t.Errorf("%s is still applied after Down All", status.ID)
+		}
+	}
+}
+
+func TestRedo(t *testing.T) {
+	ctx := context.Background()
+	fsys := testMigrations()
+	m, db := newTestMigrator(t, fsys)
+
+	if _, err := m.Up(ctx, constants.MigrationTypeDDL, UpOptions{}); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	// Iterate on the newest migration, then redo it
+	fsys["ddl/00002_create_posts.up.sql"] = sqlFile("CREATE TABLE posts (id INTEGER PRIMARY KEY, title TEXT);\n")
+	result, err := m.Redo(ctx, constants.MigrationTypeDDL, 1)
+	if err != nil {
+		t.Fatalf("Redo: %v", err)
+	}
+	if got := executedIDs(result.RolledBack); !reflect.DeepEqual(got, []string{"00002"}) {
+		t.Errorf("Redo rolled back %v, want [00002]", got)
+	}
+	if got := executedIDs(result.Applied); !reflect.DeepEqual(got, []string{"00002"}) {
+		t.Errorf("Redo applied %v, want [00002]", got)
+	}
+
+	if _, err := db.Exec("INSERT INTO posts (id, title) VALUES (1, 'hello')"); err != nil {
+		t.Errorf("posts does not have the redone title column: %v", err)
+	}
+
+	statuses, err := m.Status(ctx, constants.MigrationTypeDDL)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Modified() {
+			t.Errorf("%s reports a modified file after redo recorded its new checksum", status.ID)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	m, db := newTestMigrator(t, testMigrations())
+
+	steps, err := m.PlanUp(ctx, constants.MigrationTypeDDL, UpOptions{})
+	if err != nil {
+		t.Fatalf("PlanUp: %v", err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("PlanUp returned %d steps, want 2", len(steps))
+	}
+
+	step := steps[1]
+	want := []string{
+		"CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id))",
+		"CREATE INDEX idx_posts_user ON posts (user_id)",
+	}
+	if step.Migration.ID != "00002" || step.Direction != constants.DirectionUp || step.Path != "ddl/00002_create_posts.up.sql" {
+		t.Errorf("step = %+v", step)
+	}
+	if !reflect.DeepEqual(step.Statements, want) {
+		t.Errorf("Statements = %q, want %q", step.Statements, want)
+	}
+	if step.Batch != 1 || step.Checksum == "" {
+		t.Errorf("step batch %d, checksum %q, want batch 1 and a checksum", step.Batch, step.Checksum)
+	}
+
+	// Planning never touches the database
+	if got := tables(t, db); len(got) != 0 {
+		t.Errorf("tables after PlanUp = %v", got)
+	}
+
+	if _, err := m.Up(ctx, constants.MigrationTypeDDL, UpOptions{}); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	steps, err = m.PlanDown(ctx, constants.MigrationTypeDDL, DownOptions{All: true})
+	if err != nil {
+		t.Fatalf("PlanDown: %v", err)
+	}
+	var plan []string
+	for _, step := range steps {
+		plan = append(plan, step.Direction+" "+step.Path)
+	}
+	wantPlan := []string{"down ddl/00002_create_posts.down.sql", "down ddl/00001_create_users.down.sql"}
+	if !reflect.DeepEqual(plan, wantPlan) {
+		t.Errorf("PlanDown = %v, want %v", plan, wantPlan)
+	}
+}
+
+func TestEventOrder(t *testing.T) {
+	ctx := context.Background()
+
+	var events []string
+	observer := func(event Event) {
+		events = append(events, string(event.Kind)+" "+event.Migration.ID)
+	}
+	m, _ := newTestMigrator(t, testMigrations(), WithObserver(observer))
+
+	if _, err := m.Up(ctx, constants.MigrationTypeDDL, UpOptions{}); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if _, err := m.Down(ctx, constants.MigrationTypeDDL, DownOptions{Steps: 2}); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+
+	want := []string{
+		"applying ",
+		"applied 00001",
+		"applied 00002",
+		"rolling_back ",
+		"rolled_back 00002",
+		"rolled_back 00001",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events =\n%q\nwant\n%q", events, want)
+	}
+}
+
+func TestFailingMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	fsys := testMigrations()
+	fsys["ddl/00003_broken.up.sql"] = sqlFile("CREATE TABLE comments (id INTEGER PRIMARY KEY);\nINSERT INTO missing VALUES (1);\n")
+	fsys["ddl/00003_broken.down.sql"] = sqlFile("DROP TABLE comments;\n")
+	m, db := newTestMigrator(t, fsys)
+
+	result, err := m.Up(ctx, constants.MigrationTypeDDL, UpOptions{})
+	if err == nil {
+		t.Fatal("Up succeeded, want the broken migration to fail")
+	}
+	if !strings.Contains(err.Error(), "statement 2 of ddl/00003_broken.up.sql") {
+		t.Errorf("error %q does not name the failing statement", err)
+	}
+
+	// The migrations before the failure stay applied, the failing one leaves nothing behind
+	if got := executedIDs(result.Applied); !reflect.DeepEqual(got, []string{"00001", "00002"}) {
+		t.Errorf("Up applied %v, want [00001 00002]", got)
+	}
+	if got := tables(t, db); !reflect.DeepEqual(got, []string{"posts", "users"}) {
+		t.Errorf("tables after the failed Up = %v", got)
+	}
+	if len(result.Pending) != 1 || result.Pending[0].ID != "00003" {
+		t.Errorf("Pending = %v, want [00003]", result.Pending)
+	}
+}
@@ -0,0 +1,1021 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"go.risoftinc.com/elsa"
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+// Up applies the pending migrations of one type selected by opts as a new batch,
+// stopping at the first failure.
+func (m *Migrator) Up(ctx context.Context, migrationType string, opts UpOptions) (*Result, error) {
+	available, selected, result, err := m.prepare(migrationType)
+	if err != nil {
+		return result, err
+	}
+	m.notifySkipped(result)
+
+	err = m.locked(ctx, func(executor *database.MigrationExecutor) error {
+		if err := m.reconcile(executor, migrationType, available); err != nil {
+			return err
+		}
+
+		records, err := executor.GetAppliedMigrationRecords(migrationType)
+		if err != nil {
+			return fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+		}
+
+		pending := pendingMigrations(selected, records)
+		result.Pending = pending
+
+		toApply := selectMigrationsToApply(pending, opts)
+		if len(toApply) == 0 {
+			return nil
+		}
+
+		// A migration merged from a branch can sort before history that already ran, refuse it unless asked for
+		outOfOrder, err := checkOutOfOrder(toApply, records, opts.AllowOutOfOrder)
+		if err != nil {
+			return err
+		}
+		if len(outOfOrder) > 0 {
+			m.notify(Event{Kind: EventOutOfOrder, Type: migrationType, Count: len(outOfOrder), Newest: newestAppliedID(records)})
+		}
+
+		return m.applyBatch(executor, migrationType, toApply, outOfOrder, result)
+	})
+
+	result.Pending = withoutExecuted(result.Pending, result.Applied)
+	return result, err
+}
+
+// Down rolls back the applied migrations of one type selected by opts, newest first.
+// Applied migrations whose file is gone are reported as missing and left in place.
+func (m *Migrator) Down(ctx context.Context, migrationType string, opts DownOptions) (*Result, error) {
+	if opts.Batch < 0 && opts.Batch != LatestBatch {
+		return nil, fmt.Errorf(constants.ErrInvalidBatch, opts.Batch)
+	}
+
+	available, _, result, err := m.prepare(migrationType)
+	if err != nil {
+		return result, err
+	}
+	m.notifySkipped(result)
+
+	err = m.locked(ctx, func(executor *database.MigrationExecutor) error {
+		if err := m.reconcile(executor, migrationType, available); err != nil {
+			return err
+		}
+
+		records, err := m.selectedRecords(executor, migrationType, available)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		ids, batch := selectMigrationsToRollback(records, opts)
+		result.Batch = batch
+		if len(ids) == 0 {
+			return nil
+		}
+
+		m.notify(Event{Kind: EventRollingBack, Type: migrationType, Count: len(ids)})
+
+		idToMigration := migrationsByID(available)
+		for _, id := range ids {
+			migration, exists := idToMigration[id]
+			if !exists {
+				m.notify(Event{Kind: EventMissingFile, Type: migrationType, Migration: Migration{ID: id}})
+				result.Missing = append(result.Missing, id)
+				continue
+			}
+
+			if err := m.rollbackOne(executor, migrationType, migration, result); err != nil {
+				return fmt.Errorf(constants.ErrFailedRollbackMigrationID, id, err)
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// Redo rolls back the newest steps applied migrations of one type and applies them again as a new batch,
+// so edits to their files take effect and their checksums are recorded anew.
+// Every one of them needs its file, otherwise it could be rolled back but never applied again.
+func (m *Migrator) Redo(ctx context.Context, migrationType string, steps int) (*Result, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf(constants.ErrInvalidRedoStep, steps)
+	}
+
+	available, _, result, err := m.prepare(migrationType)
+	if err != nil {
+		return result, err
+	}
+	m.notifySkipped(result)
+
+	err = m.locked(ctx, func(executor *database.MigrationExecutor) error {
+		if err := m.reconcile(executor, migrationType, available); err != nil {
+			return err
+		}
+
+		records, err := m.selectedRecords(executor, migrationType, available)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		migrations, err := selectMigrationsToRedo(records, available, steps)
+		if err != nil {
+			return err
+		}
+
+		outOfOrder := make(map[string]bool)
+		for _, record := range records {
+			outOfOrder[record.MigrationID] = record.OutOfOrder
+		}
+
+		m.notify(Event{Kind: EventRedoing, Type: migrationType, Count: len(migrations)})
+
+		// Roll back newest first
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if err := m.rollbackOne(executor, migrationType, migrations[i], result); err != nil {
+				return redoFailure(migrationType, migrations[i], constants.DirectionDown, err, result, migrations)
+			}
+		}
+
+		// Re-apply oldest first as one new batch, recording the checksum of the current files
+		batch, err := executor.NextBatch()
+		if err != nil {
+			return redoFailure(migrationType, migrations[0], constants.DirectionUp, err, result, migrations)
+		}
+		result.Batch = batch
+
+		return m.aroundUp(executor, migrationType, len(migrations), batch, func() error {
+			for _, migration := range migrations {
+				if err := m.applyOne(executor, migrationType, migration, batch, outOfOrder[migration.ID], result); err != nil {
+					return redoFailure(migrationType, migration, constants.DirectionUp, err, result, migrations)
+				}
+			}
+			return nil
+		})
+	})
+
+	return result, err
+}
+
+// Refresh rolls back every applied migration of one type and applies all of them again as one batch.
+func (m *Migrator) Refresh(ctx context.Context, migrationType string) (*Result, error) {
+	available, selected, result, err := m.prepare(migrationType)
+	if err != nil {
+		return result, err
+	}
+	m.notifySkipped(result)
+
+	err = m.locked(ctx, func(executor *database.MigrationExecutor) error {
+		if err := m.reconcile(executor, migrationType, available); err != nil {
+			return err
+		}
+
+		records, err := m.selectedRecords(executor, migrationType, available)
+		if err != nil {
+			return err
+		}
+
+		ids, _ := selectMigrationsToRollback(records, DownOptions{All: true})
+		if len(ids) > 0 {
+			m.notify(Event{Kind: EventRollingBack, Type: migrationType, Count: len(ids)})
+		}
+
+		idToMigration := migrationsByID(available)
+		for _, id := range ids {
+			migration, exists := idToMigration[id]
+			if !exists {
+				m.notify(Event{Kind: EventMissingFile, Type: migrationType, Migration: Migration{ID: id}})
+				result.Missing = append(result.Missing, id)
+				continue
+			}
+
+			if err := m.rollbackOne(executor, migrationType, migration, result); err != nil {
+				return fmt.Errorf(constants.ErrFailedRollbackAll, fmt.Errorf(constants.ErrFailedRollbackMigrationID, id, err))
+			}
+		}
+
+		records, err = executor.GetAppliedMigrationRecords(migrationType)
+		if err != nil {
+			return fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+		}
+
+		// Everything selected starts over, so nothing counts as out of order
+		toApply := pendingMigrations(selected, records)
+		result.Pending = toApply
+		if len(toApply) == 0 {
+			return nil
+		}
+		if err := m.applyBatch(executor, migrationType, toApply, nil, result); err != nil {
+			return fmt.Errorf(constants.ErrFailedApplyAll, err)
+		}
+		return nil
+	})
+
+	result.Pending = withoutExecuted(result.Pending, result.Applied)
+	return result, err
+}
+
+// Reconcile records squash baselines as applied on a database that applied the migrations they replace,
+// and re-stamps checksums recorded in the legacy format with SHA-256.
+// Up, Down, Redo and Refresh reconcile first, so it is only needed right after squashing.
+func (m *Migrator) Reconcile(ctx context.Context, migrationType string) error {
+	available, err := Discover(m.fsys, migrationType)
+	if err != nil {
+		return err
+	}
+
+	return m.locked(ctx, func(executor *database.MigrationExecutor) error {
+		return m.reconcile(executor, migrationType, available)
+	})
+}
+
+// PlanUp returns the steps Up would execute with opts, without changing the database.
+func (m *Migrator) PlanUp(ctx context.Context, migrationType string, opts UpOptions) ([]Step, error) {
+	_, selected, _, err := m.prepare(migrationType)
+	if err != nil {
+		return nil, err
+	}
+
+	executor := m.runExecutor(ctx)
+	records, err := planRecords(executor, migrationType)
+	if err != nil {
+		return nil, err
+	}
+
+	toApply := selectMigrationsToApply(pendingMigrations(selected, records), opts)
+	outOfOrder, err := checkOutOfOrder(toApply, records, opts.AllowOutOfOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.planApply(executor, migrationType, toApply, outOfOrder)
+}
+
+// PlanDown returns the steps Down would execute with opts, without changing the database.
+func (m *Migrator) PlanDown(ctx context.Context, migrationType string, opts DownOptions) ([]Step, error) {
+	if opts.Batch < 0 && opts.Batch != LatestBatch {
+		return nil, fmt.Errorf(constants.ErrInvalidBatch, opts.Batch)
+	}
+
+	available, _, _, err := m.prepare(migrationType)
+	if err != nil {
+		return nil, err
+	}
+
+	executor := m.runExecutor(ctx)
+	records, err := planRecords(executor, migrationType)
+	if err != nil {
+		return nil, err
+	}
+	records = m.filterRecords(records, available)
+
+	var ids []string
+	if len(records) > 0 {
+		ids, _ = selectMigrationsToRollback(records, opts)
+	}
+	return m.planRollback(executor, migrationType, ids, available)
+}
+
+// PlanRedo returns the steps Redo would execute, without changing the database.
+func (m *Migrator) PlanRedo(ctx context.Context, migrationType string, steps int) ([]Step, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf(constants.ErrInvalidRedoStep, steps)
+	}
+
+	available, _, _, err := m.prepare(migrationType)
+	if err != nil {
+		return nil, err
+	}
+
+	executor := m.runExecutor(ctx)
+	records, err := planRecords(executor, migrationType)
+	if err != nil {
+		return nil, err
+	}
+	records = m.filterRecords(records, available)
+
+	var migrations []Migration
+	if len(records) > 0 {
+		migrations, err = selectMigrationsToRedo(records, available, steps)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ids []string
+	for i := len(migrations) - 1; i >= 0; i-- {
+		ids = append(ids, migrations[i].ID)
+	}
+	rollback, err := m.planRollback(executor, migrationType, ids, available)
+	if err != nil {
+		return nil, err
+	}
+
+	apply, err := m.planApply(executor, migrationType, migrations, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(rollback, apply...), nil
+}
+
+// PlanRefresh returns the steps Refresh would execute, without changing the database.
+func (m *Migrator) PlanRefresh(ctx context.Context, migrationType string) ([]Step, error) {
+	available, selected, _, err := m.prepare(migrationType)
+	if err != nil {
+		return nil, err
+	}
+
+	executor := m.runExecutor(ctx)
+	records, err := planRecords(executor, migrationType)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, _ := selectMigrationsToRollback(m.filterRecords(records, available), DownOptions{All: true})
+	rollback, err := m.planRollback(executor, migrationType, ids, available)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every selected migration is rolled back first, so all of them are applied again
+	apply, err := m.planApply(executor, migrationType, selected, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(rollback, apply...), nil
+}
+
+// prepare discovers the migrations of a type and splits off those the environment and tags leave out
+func (m *Migrator) prepare(migrationType string) ([]Migration, []Migration, *Result, error) {
+	result := &Result{Type: migrationType}
+
+	available, err := Discover(m.fsys, migrationType)
+	if err != nil {
+		return nil, nil, result, err
+	}
+
+	var selected []Migration
+	for _, migration := range available {
+		if m.SkipReason(migration) != "" {
+			result.Skipped = append(result.Skipped, migration)
+			continue
+		}
+		selected = append(selected, migration)
+	}
+	return available, selected, result, nil
+}
+
+// notifySkipped reports the migrations a run leaves out; plans stay quiet so their SQL output can be piped
+func (m *Migrator) notifySkipped(result *Result) {
+	if len(result.Skipped) > 0 {
+		m.notify(Event{Kind: EventSkipped, Type: result.Type, Count: len(result.Skipped)})
+	}
+}
+
+// selectedRecords reads the applied migrations of a type, leaving out those the environment and tags do not select
+func (m *Migrator) selectedRecords(executor *database.MigrationExecutor, migrationType string, available []Migration) ([]database.MigrationRecord, error) {
+	records, err := executor.GetAppliedMigrationRecords(migrationType)
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+	}
+	return m.filterRecords(records, available), nil
+}
+
+// filterRecords drops applied records whose migration the environment and tags do not select,
+// so a rollback never touches them. Records without a file are kept for the missing file report.
+func (m *Migrator) filterRecords(records []database.MigrationRecord, available []Migration) []database.MigrationRecord {
+	idToMigration := migrationsByID(available)
+
+	var selected []database.MigrationRecord
+	for _, record := range records {
+		if migration, exists := idToMigration[record.MigrationID]; exists && m.SkipReason(migration) != "" {
+			continue
+		}
+		selected = append(selected, record)
+	}
+	return selected
+}
+
+// planRecords reads applied migrations without creating the migrations table
+func planRecords(executor *database.MigrationExecutor, migrationType string) ([]database.MigrationRecord, error) {
+	if !executor.MigrationTableExists() {
+		return nil, nil
+	}
+
+	records, err := executor.GetAppliedMigrationRecords(migrationType)
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+	}
+	return records, nil
+}
+
+// applyBatch applies migrations in order as the next batch
+func (m *Migrator) applyBatch(executor *database.MigrationExecutor, migrationType string, migrations []Migration, outOfOrder map[string]bool, result *Result) error {
+	// Every run is recorded as its own batch so Down can revert it as a whole
+	batch, err := executor.NextBatch()
+	if err != nil {
+		return err
+	}
+	result.Batch = batch
+
+	m.notify(Event{Kind: EventApplying, Type: migrationType, Count: len(migrations), Batch: batch})
+
+	return m.aroundUp(executor, migrationType, len(migrations), batch, func() error {
+		for _, migration := range migrations {
+			if err := m.applyOne(executor, migrationType, migration, batch, outOfOrder[migration.ID], result); err != nil {
+				return fmt.Errorf(constants.ErrFailedApplyMigration, migration.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// applyOne applies a migration and records it under batch, flagged when it is applied out of order
+func (m *Migrator) applyOne(executor *database.MigrationExecutor, migrationType string, migration Migration, batch int, outOfOrder bool, result *Result) error {
+	script, err := m.migrationScript(executor, migration, migrationType, constants.DirectionUp)
+	if err != nil {
+		return err
+	}
+	script.Batch = batch
+	script.OutOfOrder = outOfOrder
+
+	run := HookRun{Point: BeforeEach, Type: migrationType, Batch: batch, Migration: migration, Direction: constants.DirectionUp}
+	if err := m.runHooks(executor, run); err != nil {
+		return err
+	}
+
+	duration, err := m.execute(executor, migration, migrationType, constants.DirectionUp, script)
+	if err != nil {
+		return err
+	}
+
+	result.Applied = append(result.Applied, Executed{Migration: migration, Duration: duration, OutOfOrder: outOfOrder})
+	m.notify(Event{Kind: EventApplied, Type: migrationType, Migration: migration, Batch: batch, Duration: duration})
+
+	run.Point = AfterEach
+	run.Duration = duration
+	return m.runHooks(executor, run)
+}
+
+// rollbackOne rolls back a migration and removes its record
+func (m *Migrator) rollbackOne(executor *database.MigrationExecutor, migrationType string, migration Migration, result *Result) error {
+	script, err := m.migrationScript(executor, migration, migrationType, constants.DirectionDown)
+	if err != nil {
+		return err
+	}
+
+	run := HookRun{Point: BeforeEach, Type: migrationType, Migration: migration, Direction: constants.DirectionDown}
+	if err := m.runHooks(executor, run); err != nil {
+		return err
+	}
+
+	duration, err := m.execute(executor, migration, migrationType, constants.DirectionDown, script)
+	if err != nil {
+		return err
+	}
+
+	result.RolledBack = append(result.RolledBack, Executed{Migration: migration, Duration: duration})
+	m.notify(Event{Kind: EventRolledBack, Type: migrationType, Migration: migration, Duration: duration})
+
+	run.Point = AfterEach
+	run.Duration = duration
+	return m.runHooks(executor, run)
+}
+
+// execute runs a migration script in one direction and updates the migration history.
+// Go migrations registered in this process run directly, others are handed to the GoRunner.
+func (m *Migrator) execute(executor *database.MigrationExecutor, migration Migration, migrationType, direction string, script database.MigrationScript) (time.Duration, error) {
+	if migration.Kind == constants.MigrationKindGo {
+		registered, exists := elsa.LookupMigration(migration.ID)
+		if !exists {
+			if m.goRunner == nil {
+				return 0, fmt.Errorf(constants.ErrGoMigrationNotRegistered, migration.ID)
+			}
+			return m.goRunner(GoRun{
+				Migration:        migration,
+				Type:             migrationType,
+				Direction:        direction,
+				Content:          script.Content,
+				Batch:            script.Batch,
+				OutOfOrder:       script.OutOfOrder,
+				StatementTimeout: m.limits.StatementTimeout,
+				LockTimeout:      m.limits.LockTimeout,
+				Retries:          m.limits.Retries,
+			})
+		}
+
+		script.Func = registered.Up
+		if direction == constants.DirectionDown {
+			script.Func = registered.Down
+		}
+		if script.Func == nil {
+			return 0, fmt.Errorf(constants.ErrGoMigrationMissingFunc, migration.ID, direction)
+		}
+	}
+
+	// Fixtures and Go migrations always run in a transaction, SQL files only where DDL is transactional
+	if migration.Kind == constants.MigrationKindSQL && !executor.SupportsTransactionalDDL() && !m.nonTransactionalWarned {
+		m.nonTransactionalWarned = true
+		m.notify(Event{Kind: EventNonTransactional, Type: migrationType, Driver: executor.Driver()})
+	}
+
+	executor = executor.OnRetry(func(attempt int, wait time.Duration, err error) {
+		m.notify(Event{Kind: EventRetrying, Type: migrationType, Migration: migration, Count: attempt, Duration: wait, Err: err})
+	})
+	executor = executor.OnBatchProgress(func(progress database.BatchProgress) {
+		event := Event{Kind: EventBatchProgress, Type: migrationType, Migration: migration, Count: int(progress.Done), Total: int(progress.Total)}
+		switch {
+		case progress.Resumed:
+			event.Kind = EventBatchResumed
+			m.notify(event)
+			event.Kind = EventBatchProgress
+		case progress.Finished:
+			event.Kind = EventBatchFinished
+		}
+		m.notify(event)
+	})
+
+	var executionTime int64
+	var err error
+	if direction == constants.DirectionDown {
+		executionTime, err = executor.RollbackMigration(script)
+	} else {
+		executionTime, err = executor.ApplyMigration(script)
+	}
+	return time.Duration(executionTime) * time.Millisecond, err
+}
+
+// migrationScript reads the file of a migration for one direction.
+// Fixtures are rendered to statements here, their content stays the file so checksums follow it.
+func (m *Migrator) migrationScript(executor *database.MigrationExecutor, migration Migration, migrationType, direction string) (database.MigrationScript, error) {
+	script := database.MigrationScript{
+		ID:   migration.ID,
+		Name: migration.Name,
+		Type: migrationType,
+	}
+
+	name := migration.Path
+	if direction == constants.DirectionDown {
+		name = migration.DownPath()
+	}
+	script.Path = name
+
+	if migration.Kind == constants.MigrationKindFixture {
+		fixture, content, err := loadFixture(m.fsys, name)
+		if err != nil {
+			return script, err
+		}
+		script.Content = string(content)
+		script.Statements = executor.FixtureStatements(fixture, direction)
+		return script, nil
+	}
+
+	content, err := fs.ReadFile(m.fsys, name)
+	if err != nil {
+		return script, fmt.Errorf(constants.ErrFailedReadFile, err)
+	}
+	script.Content = string(content)
+	return script, nil
+}
+
+// planApply resolves the statements of each up file in execution order
+func (m *Migrator) planApply(executor *database.MigrationExecutor, migrationType string, migrations []Migration, outOfOrder map[string]bool) ([]Step, error) {
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+
+	batch := 1
+	if executor.MigrationTableExists() {
+		next, err := executor.NextBatch()
+		if err != nil {
+			return nil, err
+		}
+		batch = next
+	}
+
+	var steps []Step
+	for _, migration := range migrations {
+		step, err := m.planStep(executor, migration, migrationType, constants.DirectionUp)
+		if err != nil {
+			return nil, err
+		}
+		step.Batch = batch
+		step.OutOfOrder = outOfOrder[migration.ID]
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// planRollback resolves the statements of each down file for the given applied IDs in order
+func (m *Migrator) planRollback(executor *database.MigrationExecutor, migrationType string, ids []string, available []Migration) ([]Step, error) {
+	idToMigration := migrationsByID(available)
+
+	var steps []Step
+	for _, id := range ids {
+		migration, exists := idToMigration[id]
+		if !exists {
+			m.notify(Event{Kind: EventMissingFile, Type: migrationType, Migration: Migration{ID: id}})
+			continue
+		}
+
+		step, err := m.planStep(executor, migration, migrationType, constants.DirectionDown)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// planStep splits a migration file exactly like the executor does
+func (m *Migrator) planStep(executor *database.MigrationExecutor, migration Migration, migrationType, direction string) (Step, error) {
+	step := Step{Migration: migration, Direction: direction, Path: migration.Path}
+	if direction == constants.DirectionDown {
+		step.Path = migration.DownPath()
+	}
+
+	script, err := m.migrationScript(executor, migration, migrationType, direction)
+	if err != nil {
+		return step, err
+	}
+	if direction == constants.DirectionUp {
+		step.Checksum = database.GetMigrationChecksum(script.Content)
+	}
+
+	switch migration.Kind {
+	case constants.MigrationKindGo:
+		step.Statements = []string{fmt.Sprintf(constants.PlanGoMigrationStatement, direction)}
+	case constants.MigrationKindFixture:
+		step.Statements = script.Statements
+	default:
+		step.Statements = executor.Dialect().SplitStatements(script.Content)
+	}
+	return step, nil
+}
+
+// reconcile brings the migration history up to date with the files before a run changes it
+func (m *Migrator) reconcile(executor *database.MigrationExecutor, migrationType string, available []Migration) error {
+	if err := m.reconcileSquashed(executor, migrationType, available); err != nil {
+		return err
+	}
+	return m.upgradeChecksums(executor, migrationType, available)
+}
+
+// upgradeChecksums re-stamps the legacy checksums of applied migrations whose files are unchanged with SHA-256,
+// a legacy checksum that no longer matches is left for verify to report as drift
+func (m *Migrator) upgradeChecksums(executor *database.MigrationExecutor, migrationType string, available []Migration) error {
+	records, err := executor.GetAppliedMigrationRecords(migrationType)
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+	}
+	idToMigration := make(map[string]Migration)
+	for _, migration := range available {
+		idToMigration[migration.ID] = migration
+	}
+
+	upgraded := 0
+	for _, record := range records {
+		if !database.IsLegacyChecksum(record.Checksum) {
+			continue
+		}
+		migration, exists := idToMigration[record.MigrationID]
+		if !exists {
+			continue
+		}
+
+		content, err := fs.ReadFile(m.fsys, migration.Path)
+		if err != nil || !database.ChecksumMatches(record.Checksum, string(content)) {
+			continue
+		}
+		if err := executor.UpdateChecksum(record.MigrationID, database.GetMigrationChecksum(string(content))); err != nil {
+			return err
+		}
+		upgraded++
+	}
+
+	if upgraded > 0 {
+		m.notify(Event{Kind: EventChecksumsUpgraded, Type: migrationType, Count: upgraded})
+	}
+	return nil
+}
+
+// reconcileSquashed rewrites the records of databases that applied the original files of a baseline,
+// so the baseline counts as applied without executing it and the archived IDs no longer show up as orphans
+func (m *Migrator) reconcileSquashed(executor *database.MigrationExecutor, migrationType string, available []Migration) error {
+	var baselines []Migration
+	for _, migration := range available {
+		if len(migration.Squashes) > 0 {
+			baselines = append(baselines, migration)
+		}
+	}
+	if len(baselines) == 0 {
+		return nil
+	}
+
+	records, err := executor.GetAppliedMigrationRecords(migrationType)
+	if err != nil {
+		return fmt.Errorf(constants.ErrFailedGetAppliedMigrations, err)
+	}
+	recordMap := make(map[string]database.MigrationRecord)
+	for _, record := range records {
+		recordMap[record.MigrationID] = record
+	}
+
+	for _, baseline := range baselines {
+		var applied []string
+		for _, id := range baseline.Squashes {
+			if _, exists := recordMap[id]; exists {
+				applied = append(applied, id)
+			}
+		}
+
+		// Fresh database: the baseline is simply pending
+		if len(applied) == 0 {
+			continue
+		}
+
+		// Squashed ranges always start at the first migration, so a database that applied the last squashed ID
+		// applied the whole range (or a previous baseline covering its start)
+		record, exists := recordMap[baseline.ID]
+		if !exists {
+			return fmt.Errorf(constants.ErrSquashPartiallyApplied, baseline.ID, len(applied), len(baseline.Squashes))
+		}
+
+		// Already reconciled on an earlier run
+		if len(applied) == 1 && record.Name == baseline.Name {
+			continue
+		}
+
+		content, err := fs.ReadFile(m.fsys, baseline.Path)
+		if err != nil {
+			return fmt.Errorf(constants.ErrFailedReadFile, err)
+		}
+
+		if err := executor.ReplaceSquashedRecords(baseline.ID, baseline.Name, database.GetMigrationChecksum(string(content)), baseline.Squashes); err != nil {
+			return err
+		}
+		m.notify(Event{Kind: EventReconciled, Type: migrationType, Migration: baseline, Count: len(baseline.Squashes)})
+	}
+
+	return nil
+}
+
+// pendingMigrations returns the migrations without an applied record
+func pendingMigrations(available []Migration, records []database.MigrationRecord) []Migration {
+	applied := make(map[string]bool)
+	for _, record := range records {
+		applied[record.MigrationID] = true
+	}
+
+	var pending []Migration
+	for _, migration := range available {
+		if !applied[migration.ID] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+// selectMigrationsToApply applies the Steps and To options to the pending migrations
+func selectMigrationsToApply(pending []Migration, opts UpOptions) []Migration {
+	if opts.Steps > 0 {
+		if opts.Steps > len(pending) {
+			return pending
+		}
+		return pending[:opts.Steps]
+	}
+
+	if opts.To != "" {
+		var result []Migration
+		for _, migration := range pending {
+			result = append(result, migration)
+			if migration.ID == opts.To {
+				break
+			}
+		}
+		return result
+	}
+
+	return pending
+}
+
+// newestAppliedID returns the highest applied migration ID, empty when nothing is applied
+func newestAppliedID(records []database.MigrationRecord) string {
+	newest := ""
+	for _, record := range records {
+		if newest == "" || database.MigrationIDLess(newest, record.MigrationID) {
+			newest = record.MigrationID
+		}
+	}
+	return newest
+}
+
+// outOfOrderMigrations returns the pending migrations whose ID sorts before the newest applied one
+func outOfOrderMigrations(pending []Migration, records []database.MigrationRecord) []Migration {
+	newest := newestAppliedID(records)
+	if newest == "" {
+		return nil
+	}
+
+	var result []Migration
+	for _, migration := range pending {
+		if database.MigrationIDLess(migration.ID, newest) {
+			result = append(result, migration)
+		}
+	}
+	return result
+}
+
+// checkOutOfOrder refuses out-of-order migrations unless they are allowed,
+// and returns the IDs that have to be recorded as applied out of order
+func checkOutOfOrder(toApply []Migration, records []database.MigrationRecord, allow bool) (map[string]bool, error) {
+	offending := outOfOrderMigrations(toApply, records)
+	if len(offending) == 0 {
+		return nil, nil
+	}
+
+	if !allow {
+		var files []string
+		for _, migration := range offending {
+			files = append(files, "  "+migration.Path)
+		}
+		return nil, fmt.Errorf(constants.ErrOutOfOrder, len(offending), newestAppliedID(records), strings.Join(files, "\n"))
+	}
+
+	outOfOrder := make(map[string]bool)
+	for _, migration := range offending {
+		outOfOrder[migration.ID] = true
+	}
+	return outOfOrder, nil
+}
+
+// selectMigrationsToRollback applies the Down options to the applied migrations and returns their IDs newest first,
+// with the batch that was selected
+func selectMigrationsToRollback(records []database.MigrationRecord, opts DownOptions) ([]string, int) {
+	// Records come back newest applied first, the options below expect ascending ID order
+	applied := sortedRecordIDs(records)
+
+	var ids []string
+	batch := 0
+	switch {
+	case opts.All:
+		ids = applied
+	case opts.Batch != 0:
+		batch = resolveBatch(records, opts.Batch)
+		for _, record := range records {
+			if record.Batch == batch {
+				ids = append(ids, record.MigrationID)
+			}
+		}
+	case opts.Steps > 0:
+		steps := opts.Steps
+		if steps > len(applied) {
+			steps = len(applied)
+		}
+		ids = applied[len(applied)-steps:]
+	case opts.From != "":
+		found := false
+		for _, id := range applied {
+			if id == opts.From {
+				found = true
+			}
+			if found {
+				ids = append(ids, id)
+			}
+		}
+	default:
+		if len(applied) > 0 {
+			ids = applied[len(applied)-1:]
+		}
+	}
+
+	// Newest first for rollback
+	sort.Slice(ids, func(i, j int) bool {
+		return database.MigrationIDLess(ids[j], ids[i])
+	})
+	return ids, batch
+}
+
+// resolveBatch returns the selected batch, looking up the newest one for LatestBatch
+func resolveBatch(records []database.MigrationRecord, batch int) int {
+	if batch != LatestBatch {
+		return batch
+	}
+
+	latest := 0
+	for _, record := range records {
+		if record.Batch > latest {
+			latest = record.Batch
+		}
+	}
+	return latest
+}
+
+// selectMigrationsToRedo returns the files of the newest steps applied migrations in ascending ID order
+func selectMigrationsToRedo(records []database.MigrationRecord, available []Migration, steps int) ([]Migration, error) {
+	applied := sortedRecordIDs(records)
+	if steps > len(applied) {
+		steps = len(applied)
+	}
+
+	idToMigration := migrationsByID(available)
+
+	var migrations []Migration
+	for _, id := range applied[len(applied)-steps:] {
+		migration, exists := idToMigration[id]
+		if !exists {
+			return nil, fmt.Errorf(constants.ErrRedoMissingFile, id)
+		}
+		migrations = append(migrations, migration)
+	}
+	return migrations, nil
+}
+
+// redoFailure summarises where a redo stopped, so the database state is clear without a status check
+func redoFailure(migrationType string, failed Migration, direction string, err error, result *Result, migrations []Migration) error {
+	reapplied := make(map[string]bool)
+	for _, executed := range result.Applied {
+		reapplied[executed.Migration.ID] = true
+	}
+	var notApplied []Migration
+	for _, executed := range result.RolledBack {
+		if !reapplied[executed.Migration.ID] {
+			notApplied = append(notApplied, executed.Migration)
+		}
+	}
+	sort.Slice(notApplied, func(i, j int) bool {
+		return database.MigrationIDLess(notApplied[i].ID, notApplied[j].ID)
+	})
+
+	return fmt.Errorf(constants.ErrRedoFailed, failed.ID, failed.Name, direction, err,
+		len(result.RolledBack), len(migrations), len(result.Applied), len(migrations),
+		migrationNames(notApplied), migrationType)
+}
+
+// migrationNames lists migrations as <id>_<name> for messages
+func migrationNames(migrations []Migration) string {
+	if len(migrations) == 0 {
+		return constants.NoMigrationsListed
+	}
+
+	names := make([]string, len(migrations))
+	for i, migration := range migrations {
+		names[i] = migration.ID + "_" + migration.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// sortedRecordIDs returns the IDs of applied records in ascending ID order
+func sortedRecordIDs(records []database.MigrationRecord) []string {
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.MigrationID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return database.MigrationIDLess(ids[i], ids[j])
+	})
+	return ids
+}
+
+// migrationsByID indexes migrations by their ID
+func migrationsByID(migrations []Migration) map[string]Migration {
+	idToMigration := make(map[string]Migration)
+	for _, migration := range migrations {
+		idToMigration[migration.ID] = migration
+	}
+	return idToMigration
+}
+
+// withoutExecuted drops the migrations a run applied
+func withoutExecuted(migrations []Migration, executed []Executed) []Migration {
+	done := make(map[string]bool)
+	for _, e := range executed {
+		done[e.Migration.ID] = true
+	}
+
+	var result []Migration
+	for _, migration := range migrations {
+		if !done[migration.ID] {
+			result = append(result, migration)
+		}
+	}
+	return result
+}
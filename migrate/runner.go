@@ -0,0 +1,48 @@
+// Package migrate exposes Elsa's migration runner to Go code.
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"go.risoftinc.com/elsa"
+	"go.risoftinc.com/elsa/constants"
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+// RunGoMigrationMain is the entry point of the runner program that `elsa migration up`
+// generates to execute Go migrations registered with elsa.RegisterMigration.
+// It reads the request from stdin and writes the result to stdout.
+func RunGoMigrationMain() {
+	if err := runGoMigration(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runGoMigration decodes a runner request, executes the registered function and encodes the result
+func runGoMigration(input io.Reader, output io.Writer) error {
+	var request database.GoMigrationRequest
+	if err := json.NewDecoder(input).Decode(&request); err != nil {
+		return fmt.Errorf(constants.ErrFailedDecodeGoRequest, err)
+	}
+
+	migration, exists := elsa.LookupMigration(request.Script.ID)
+	if !exists {
+		return fmt.Errorf(constants.ErrGoMigrationNotRegistered, request.Script.ID)
+	}
+
+	fn := migration.Up
+	if request.Direction == constants.DirectionDown {
+		fn = migration.Down
+	}
+
+	result, err := database.RunGoMigrationRequest(request, fn)
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(output).Encode(result)
+}
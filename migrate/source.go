@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"go.risoftinc.com/elsa/constants"
+)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// OpenSource opens the migration FS a source points at: file://dir for a folder,
+// tar://bundle.tar.gz for a tar bundle, gzipped or not, and zip://bundle.zip for a zip bundle.
+// Bundles are read into memory and verified against their manifest, see OpenBundle.
+func OpenSource(source string) (fs.FS, error) {
+	if dir, ok := strings.CutPrefix(source, constants.SourceSchemeFile); ok && dir != "" {
+		return os.DirFS(dir), nil
+	}
+
+	name, ok := strings.CutPrefix(source, constants.SourceSchemeTar)
+	if !ok {
+		name, ok = strings.CutPrefix(source, constants.SourceSchemeZip)
+	}
+	if !ok || name == "" {
+		return nil, fmt.Errorf(constants.ErrInvalidSource, source)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedReadBundle, name, err)
+	}
+
+	fsys, err := OpenBundle(data)
+	if err != nil {
+		return nil, fmt.Errorf(constants.ErrFailedReadBundle, name, err)
+	}
+	return fsys, nil
+}
+
+// OpenBundle returns the migration FS of a bundle written by WriteBundle, a zip or a tar that may be gzipped.
+// The bundle must match its manifest, so the reviewed set of migrations is exactly what runs.
+// Embedding a bundle with go:embed ships the migrations inside the binary.
+func OpenBundle(data []byte) (fs.FS, error) {
+	fsys, err := readArchive(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := VerifyBundle(fsys); err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// readArchive serves the files of a zip or tar archive, told apart by their leading bytes
+func readArchive(data []byte) (fs.FS, error) {
+	if bytes.HasPrefix(data, zipMagic) {
+		return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(data, gzipMagic) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return tarFS(r)
+}
+
+// tarFS copies the regular files of a tar stream into an in-memory zip, which serves them as an fs.FS
+func tarFS(r io.Reader) (fs.FS, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Archives made with `tar -C dir .` prefix every name with ./
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     path.Clean(header.Name),
+			Method:   zip.Store,
+			Modified: header.ModTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"context"
+	"io/fs"
+	"time"
+
+	"go.risoftinc.com/elsa/internal/database"
+)
+
+// MigrationStatus is the state of one migration file on the database.
+type MigrationStatus struct {
+	Migration
+	Applied bool
+	// Skipped is env or tags when the environment and tags leave the pending migration out
+	Skipped       string
+	Batch         int
+	AppliedAt     *time.Time
+	ExecutionTime time.Duration
+	// OutOfOrder is recorded for applied migrations; pending ones are flagged when they sort before the newest applied one
+	OutOfOrder bool
+	// Checksum is the checksum of the file, AppliedChecksum the one recorded when it was applied.
+	// AppliedChecksum stays empty while a squash baseline still carries the record of its original file.
+	// AppliedChecksum is in the legacy format until the next run re-stamps it.
+	Checksum        string
+	AppliedChecksum string
+	modified        bool
+}
+
+// Modified reports whether the file of an applied migration changed after it was applied.
+func (s MigrationStatus) Modified() bool {
+	return s.modified
+}
+
+// Status compares the migration files of one type with the migration history, in ID order.
+// It does not create the migrations table, every migration is pending on a fresh database.
+func (m *Migrator) Status(ctx context.Context, migrationType string) ([]MigrationStatus, error) {
+	available, err := Discover(m.fsys, migrationType)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := planRecords(m.runExecutor(ctx), migrationType)
+	if err != nil {
+		return nil, err
+	}
+	recordMap := make(map[string]database.MigrationRecord)
+	for _, record := range records {
+		recordMap[record.MigrationID] = record
+	}
+
+	// Pending gaps in the history are flagged here, applied migrations report their recorded flag below
+	var selected []Migration
+	for _, migration := range available {
+		if m.SkipReason(migration) == "" {
+			selected = append(selected, migration)
+		}
+	}
+	gaps := make(map[string]bool)
+	for _, migration := range outOfOrderMigrations(pendingMigrations(selected, records), records) {
+		gaps[migration.ID] = true
+	}
+
+	statuses := make([]MigrationStatus, 0, len(available))
+	for _, migration := range available {
+		status := MigrationStatus{
+			Migration:  migration,
+			Skipped:    m.SkipReason(migration),
+			OutOfOrder: gaps[migration.ID],
+		}
+		content, readErr := fs.ReadFile(m.fsys, migration.Path)
+		if readErr == nil {
+			status.Checksum = database.GetMigrationChecksum(string(content))
+		}
+
+		if record, exists := recordMap[migration.ID]; exists {
+			appliedAt := record.AppliedAt
+			status.Applied = true
+			status.Skipped = ""
+			status.Batch = record.Batch
+			status.AppliedAt = &appliedAt
+			status.ExecutionTime = time.Duration(record.ExecutionTime) * time.Millisecond
+			status.OutOfOrder = record.OutOfOrder
+
+			// A baseline keeps the record of the original file until the next run reconciles it
+			if len(migration.Squashes) == 0 || record.Name == migration.Name {
+				status.AppliedChecksum = record.Checksum
+				status.modified = readErr != nil || !database.ChecksumMatches(record.Checksum, string(content))
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
@@ -0,0 +1,64 @@
+package elsa
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MigrationFunc runs one direction of a Go migration inside the migration transaction.
+type MigrationFunc func(tx *sql.Tx) error
+
+// GoMigration is a migration implemented in Go instead of a SQL file.
+type GoMigration struct {
+	ID   string
+	Up   MigrationFunc
+	Down MigrationFunc
+}
+
+var (
+	migrationsMu sync.RWMutex
+	migrations   = make(map[string]GoMigration)
+)
+
+// RegisterMigration registers a Go migration under the given ID.
+// It is meant to be called from the init function of a migration file generated by
+// `elsa migration create dml <name> --go`, so the ID must match the file name prefix.
+// Registering the same ID twice panics, since it would make the migration order ambiguous.
+func RegisterMigration(id string, up, down MigrationFunc) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+
+	if _, exists := migrations[id]; exists {
+		panic(fmt.Sprintf("elsa: migration %s registered twice", id))
+	}
+
+	migrations[id] = GoMigration{ID: id, Up: up, Down: down}
+}
+
+// LookupMigration returns the Go migration registered under the given ID.
+func LookupMigration(id string) (GoMigration, bool) {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+
+	migration, exists := migrations[id]
+	return migration, exists
+}
+
+// RegisteredMigrations returns all registered Go migrations sorted by ID.
+func RegisteredMigrations() []GoMigration {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+
+	result := make([]GoMigration, 0, len(migrations))
+	for _, migration := range migrations {
+		result = append(result, migration)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}